@@ -1,40 +1,186 @@
 package main
 
 import (
+	"database/sql"
+	"fakereddit/redditclone/pkg/cascade"
+	"fakereddit/redditclone/pkg/category"
 	"fakereddit/redditclone/pkg/comment"
 	"fakereddit/redditclone/pkg/handlers"
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/media"
 	"fakereddit/redditclone/pkg/middleware"
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/paging"
 	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/prefs"
+	"fakereddit/redditclone/pkg/saved"
+	"fakereddit/redditclone/pkg/search"
 	"fakereddit/redditclone/pkg/session"
+	"fakereddit/redditclone/pkg/trash"
+	"fakereddit/redditclone/pkg/unfurl"
 	"fakereddit/redditclone/pkg/user"
+	"flag"
+	"fmt"
 	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 var (
-	postsRepo = post.NewPostsRepo()
-	userRepo  = user.NewUsersRepo()
-	commRepo  = comment.NewCommentsRepo()
+	storage = flag.String("storage", "memory", "storage backend: memory or sqlite")
+	dbPath  = flag.String("db", "redditclone.db", "path to the sqlite database file")
+
+	journalDir    = flag.String("journal", "", "directory for the memory storage journal, empty disables it")
+	snapshotEvery = flag.Duration("snapshot", 5*time.Minute, "how often the journal is compacted into a snapshot")
+
+	admins         = flag.String("admins", "", "comma separated logins of admins")
+	trashRetention = flag.Duration("trash-retention", 30*24*time.Hour, "how long deleted posts and comments can be restored")
+	purgeEvery     = flag.Duration("purge", time.Hour, "how often expired trash is purged")
+
+	linkEditWindow    = flag.Duration("link-edit-window", 10*time.Minute, "how long after posting the url of a link post can be changed")
+	duplicateWindow   = flag.Duration("duplicate-window", 30*24*time.Hour, "how long a link counts as already submitted to its category, 0 disables the check")
+	commentEditWindow = flag.Duration("comment-edit-window", 0, "how long comments can be edited, 0 means no limit")
+
+	pageTTL = flag.Duration("page-ttl", 15*time.Minute, "how long cursors of ranked listings stay valid")
+
+	unfurlTimeout = flag.Duration("unfurl-timeout", unfurl.DefaultTimeout, "how long fetching a link preview may take")
+	unfurlMaxSize = flag.Int64("unfurl-max-size", unfurl.DefaultMaxBytes, "how many bytes of a linked page are read for its preview")
+
+	mediaDir       = flag.String("media", "media", "directory for uploaded images")
+	mediaMaxSize   = flag.Int64("media-max-size", media.DefaultMaxBytes, "biggest image upload in bytes")
+	mediaMaxSide   = flag.Int("media-max-side", media.DefaultMaxSide, "biggest width or height of an uploaded image")
+	mediaMaxPixels = flag.Int64("media-max-pixels", media.DefaultMaxPixels, "most pixels of an uploaded image, of all frames of a gif")
+	mediaMaxFrames = flag.Int("media-max-frames", media.DefaultMaxFrames, "most frames of an uploaded gif")
 )
 
 func main() {
-	sm := session.NewSessionsManager()
+	flag.Parse()
+
+	var (
+		postsRepo post.PostsRepo
+		commRepo  comment.CommentsRepo
+		userRepo  user.UsersRepo
+		catRepo   category.CategoriesRepo
+		savedRepo saved.SavedRepo
+		mutesRepo mute.MutesRepo
+		prefsRepo prefs.PrefsRepo
+		sm        session.Manager
+		err       error
+	)
+	if *journalDir != "" {
+		if *storage != "memory" {
+			log.Fatalf("journal works with memory storage only")
+		}
+		postsRepo, commRepo, userRepo, catRepo, savedRepo, mutesRepo, prefsRepo, sm, err = newDurableRepos(*journalDir)
+	} else {
+		postsRepo, commRepo, userRepo, catRepo, savedRepo, mutesRepo, prefsRepo, err = newRepos(*storage)
+		sm = session.NewSessionsManager()
+	}
+	if err != nil {
+		log.Fatalf("can't init %v storage: %v", *storage, err)
+	}
+	if err = category.Seed(catRepo); err != nil {
+		log.Fatalf("can't create default categories: %v", err)
+	}
+
+	mediaStorage, err := media.NewFileStorage(*mediaDir)
+	if err != nil {
+		log.Fatalf("can't init media storage: %v", err)
+	}
+	images := &media.Images{
+		Storage:   mediaStorage,
+		MaxBytes:  *mediaMaxSize,
+		MaxSide:   *mediaMaxSide,
+		MaxPixels: *mediaMaxPixels,
+		MaxFrames: *mediaMaxFrames,
+	}
+
+	unfurler := unfurl.NewUnfurler(&unfurl.Fetcher{
+		Timeout:  *unfurlTimeout,
+		MaxBytes: *unfurlMaxSize,
+	}, 100)
+	go unfurler.Run(nil)
+
+	// the types change only the content of posts, which is not indexed,
+	// so they get the repo before the index wraps it
+	imageType := &posttype.Image{Images: images, Posts: postsRepo}
+	types := posttype.NewRegistry(
+		posttype.Text{},
+		&posttype.Link{
+			Posts:           postsRepo,
+			EditWindow:      *linkEditWindow,
+			DuplicateWindow: *duplicateWindow,
+			Unfurler:        unfurler,
+		},
+		imageType,
+		&posttype.Poll{Posts: postsRepo},
+	)
+
+	index := search.NewIndex(types)
+	postsRepo = search.NewIndexedPostsRepo(postsRepo, index)
+	commRepo = search.NewIndexedCommentsRepo(commRepo, index)
+	if err = index.Build(postsRepo, commRepo); err != nil {
+		log.Fatalf("can't build search index: %v", err)
+	}
 
 	userHandler := &handlers.UserHandler{
 		UserRepo: userRepo,
 		Sessions: sm,
 	}
 
+	deleter := cascade.NewDeleter(postsRepo)
+	deleter.Register("comments", commRepo)
+	deleter.Register("saved", savedRepo)
+	deleter.Register("hidden", mutesRepo)
+	deleter.Register("media", imageType)
+
 	handler := &handlers.PostHandler{
 		Sessions:    sm,
 		PostRepo:    postsRepo,
 		CommentRepo: commRepo,
+		Categories:  catRepo,
+		UserRepo:    userRepo,
+		Saved:       savedRepo,
+		Mutes:       mutesRepo,
+		Prefs:       prefsRepo,
+		Deleter:     deleter,
+		Admins:      make(map[string]bool),
+
+		CommentEditWindow: *commentEditWindow,
+		Snapshots:         paging.NewSnapshots(*pageTTL, 1000),
+		SearchIndex:       index,
+		Types:             types,
+	}
+	for _, login := range strings.Split(*admins, ",") {
+		if login != "" {
+			handler.Admins[login] = true
+		}
+	}
+
+	categoryHandler := &handlers.CategoryHandler{
+		Categories: catRepo,
+		Sessions:   sm,
+		Types:      types,
+	}
+
+	purger := &trash.Purger{
+		Posts:     postsRepo,
+		Comments:  commRepo,
+		Saved:     savedRepo,
+		Deleter:   deleter,
+		Retention: *trashRetention,
 	}
+	go purger.Every(*purgeEvery, nil)
 
 	Handler := http.StripPrefix("/static/", http.FileServer(http.Dir("../../static/")))
 
 	r := mux.NewRouter()
 	r.PathPrefix("/static/").Handler(Handler)
+	r.PathPrefix(media.Prefix).Handler(&media.Server{Storage: mediaStorage}).Methods("GET", "HEAD")
 	r.HandleFunc("/", userHandler.Index)
 	r.HandleFunc("/api/register", userHandler.Register).Methods("POST")
 	r.HandleFunc("/api/login", userHandler.Login).Methods("POST")
@@ -44,11 +190,51 @@ func main() {
 	r.HandleFunc("/api/post/{POST_ID}", handler.Get).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}", handler.NewComm).Methods("POST")
 	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", handler.DeleteComm).Methods("DELETE")
+	r.HandleFunc("/api/post/{POST_ID}/restore", handler.RestorePost).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/restore", handler.RestoreComm).Methods("POST")
 	r.HandleFunc("/api/post/{POST_ID}/upvote", handler.Upvote).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}/downvote", handler.DownVote).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}/unvote", handler.UnVote).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/upvote", handler.UpvoteComm).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/downvote", handler.DownVoteComm).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/unvote", handler.UnVoteComm).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}", handler.DeletePost).Methods("DELETE")
+	r.HandleFunc("/api/post/{POST_ID}", handler.EditPost).Methods("PATCH")
+	r.HandleFunc("/api/post/{POST_ID}/revisions", handler.GetRevisions).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", handler.EditComm).Methods("PATCH")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/revisions", handler.GetCommRevisions).Methods("GET")
 	r.HandleFunc("/api/user/{USER_LOGIN}", handler.GetByUser).Methods("GET")
+	r.HandleFunc("/api/user/{USER_LOGIN}/trash", handler.GetUserTrash).Methods("GET")
+	r.HandleFunc("/api/trash", handler.GetTrash).Methods("GET")
+	r.HandleFunc("/api/search", handler.Search).Methods("GET")
+	r.HandleFunc("/api/categories/", categoryHandler.List).Methods("GET")
+	r.HandleFunc("/api/categories", categoryHandler.Create).Methods("POST")
+	r.HandleFunc("/api/category/{CATEGORY_NAME}", categoryHandler.Get).Methods("GET")
+	r.HandleFunc("/api/category/{CATEGORY_NAME}/subscribe", categoryHandler.Subscribe).Methods("POST")
+	r.HandleFunc("/api/category/{CATEGORY_NAME}/unsubscribe", categoryHandler.Unsubscribe).Methods("POST")
+	r.HandleFunc("/api/subscriptions", categoryHandler.Subscriptions).Methods("GET")
+	r.HandleFunc("/api/feed", handler.Feed).Methods("GET")
+	r.HandleFunc("/api/feed/following", handler.FollowingFeed).Methods("GET")
+	r.HandleFunc("/api/user/{USER_LOGIN}/follow", userHandler.Follow).Methods("POST")
+	r.HandleFunc("/api/user/{USER_LOGIN}/unfollow", userHandler.Unfollow).Methods("POST")
+	r.HandleFunc("/api/user/{USER_LOGIN}/followers", userHandler.Followers).Methods("GET")
+	r.HandleFunc("/api/user/{USER_LOGIN}/following", userHandler.Following).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/save", handler.Save).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/unsave", handler.Unsave).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/save", handler.Save).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/unsave", handler.Unsave).Methods("POST")
+	r.HandleFunc("/api/user/{USER_LOGIN}/saved", handler.GetSaved).Methods("GET")
+	r.HandleFunc("/api/user/{USER_LOGIN}/saved/folders", handler.GetSavedFolders).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/hide", handler.Hide).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/unhide", handler.Unhide).Methods("POST")
+	r.HandleFunc("/api/mutes", handler.GetMutes).Methods("GET")
+	r.HandleFunc("/api/mutes", handler.AddMute).Methods("POST")
+	r.HandleFunc("/api/mutes/{KIND}/{VALUE}", handler.DeleteMute).Methods("DELETE")
+	r.HandleFunc("/api/tags/{TAG}", handler.GetByTag).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/mark", handler.Mark).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/poll", handler.VotePoll).Methods("POST")
+	r.HandleFunc("/api/preferences", handler.GetPrefs).Methods("GET")
+	r.HandleFunc("/api/preferences", handler.EditPrefs).Methods("PATCH")
 	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "../../static/html/index.html")
 	})
@@ -57,8 +243,100 @@ func main() {
 	muxer = middleware.AccessLog(muxer)
 
 	addr := ":8081"
-	err := http.ListenAndServe(addr, muxer)
+	err = http.ListenAndServe(addr, muxer)
 	if err != nil {
 		return
 	}
 }
+
+func newRepos(kind string) (post.PostsRepo, comment.CommentsRepo, user.UsersRepo, category.CategoriesRepo, saved.SavedRepo, mute.MutesRepo, prefs.PrefsRepo, error) {
+	switch kind {
+	case "memory":
+		return post.NewPostsRepo(), comment.NewCommentsRepo(), user.NewUsersRepo(), category.NewCategoriesRepo(), saved.NewSavedRepo(), mute.NewMutesRepo(), prefs.NewPrefsRepo(), nil
+	case "sqlite":
+		// one connection serializes writers and keeps foreign_keys pragma applied
+		db, err := sql.Open("sqlite3", "file:"+*dbPath+"?_foreign_keys=on&_busy_timeout=5000")
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		db.SetMaxOpenConns(1)
+
+		userRepo, err := user.NewUsersSQLiteRepo(db)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		postsRepo, err := post.NewPostsSQLiteRepo(db)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		commRepo, err := comment.NewCommentsSQLiteRepo(db)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		catRepo, err := category.NewCategoriesSQLiteRepo(db)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		savedRepo, err := saved.NewSavedSQLiteRepo(db)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		mutesRepo, err := mute.NewMutesSQLiteRepo(db)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		prefsRepo, err := prefs.NewPrefsSQLiteRepo(db)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
+		}
+		return postsRepo, commRepo, userRepo, catRepo, savedRepo, mutesRepo, prefsRepo, nil
+	}
+	return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("unknown storage %q", kind)
+}
+
+func newDurableRepos(dir string) (post.PostsRepo, comment.CommentsRepo, user.UsersRepo, category.CategoriesRepo, saved.SavedRepo, mute.MutesRepo, prefs.PrefsRepo, session.Manager, error) {
+	journals := make(map[string]*journal.Journal)
+	for _, name := range []string{"posts", "comments", "users", "categories", "saved", "mutes", "preferences", "sessions"} {
+		j, err := journal.Open(dir, name)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, nil, err
+		}
+		journals[name] = j
+	}
+
+	postsRepo, err := post.NewDurablePostsRepo(journals["posts"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	commRepo, err := comment.NewDurableCommentsRepo(journals["comments"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	userRepo, err := user.NewDurableUsersRepo(journals["users"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	catRepo, err := category.NewDurableCategoriesRepo(journals["categories"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	savedRepo, err := saved.NewDurableSavedRepo(journals["saved"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	mutesRepo, err := mute.NewDurableMutesRepo(journals["mutes"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	prefsRepo, err := prefs.NewDurablePrefsRepo(journals["preferences"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	sm, err := session.NewDurableSessionsManager(journals["sessions"])
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+
+	go journal.Every(*snapshotEvery, nil, postsRepo, commRepo, userRepo, catRepo, savedRepo, mutesRepo, prefsRepo, sm)
+	return postsRepo, commRepo, userRepo, catRepo, savedRepo, mutesRepo, prefsRepo, sm, nil
+}
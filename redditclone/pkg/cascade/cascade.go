@@ -0,0 +1,113 @@
+package cascade
+
+import (
+	"fakereddit/redditclone/pkg/post"
+	"log"
+	"sync"
+)
+
+// Dependent is a store keeping data which hangs off a post, like comments.
+// DeleteByPost must be idempotent: deleting twice removes nothing the second time.
+type Dependent interface {
+	DeleteByPost(postID uint32) (int, error)
+}
+
+type dependent struct {
+	name string
+	repo Dependent
+}
+
+// Deleter deletes a post together with everything registered as depending
+// on it. Dependents are cleaned before the post itself, so when one of them
+// fails the post is still there and the delete can simply be retried.
+//
+// Whoever adds data to a post, like a new comment, checks that the post is
+// there and adds the data under Lock, a delete of the post waits for it.
+type Deleter struct {
+	mu    *sync.Mutex
+	posts post.PostsRepo
+	deps  []dependent
+	locks map[uint32]*postLock
+}
+
+// postLock is the lock of one post, users counts who holds or waits for it.
+type postLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+type Report struct {
+	PostID  uint32         `json:"post"`
+	Removed map[string]int `json:"removed"`
+}
+
+func NewDeleter(posts post.PostsRepo) *Deleter {
+	return &Deleter{
+		mu:    &sync.Mutex{},
+		posts: posts,
+		locks: make(map[uint32]*postLock),
+	}
+}
+
+// Register adds a store to clean on delete, name is its key in the Report.
+func (d *Deleter) Register(name string, repo Dependent) {
+	d.mu.Lock()
+	d.deps = append(d.deps, dependent{name: name, repo: repo})
+	d.mu.Unlock()
+}
+
+// Lock locks the post against deletes until unlock is called.
+func (d *Deleter) Lock(postID uint32) (unlock func()) {
+	d.mu.Lock()
+	l, ok := d.locks[postID]
+	if !ok {
+		l = &postLock{}
+		d.locks[postID] = l
+	}
+	l.users++
+	d.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		d.mu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(d.locks, postID)
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *Deleter) Delete(postID uint32) (*Report, error) {
+	unlock := d.Lock(postID)
+	defer unlock()
+	d.mu.Lock()
+	deps := d.deps
+	d.mu.Unlock()
+
+	p, err := d.posts.Read(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		PostID:  postID,
+		Removed: map[string]int{"votes": len(p.Votes)},
+	}
+	for _, dep := range deps {
+		n, err := dep.repo.DeleteByPost(postID)
+		if err != nil {
+			log.Printf("ERROR: cascade delete of post %v: %v: %v", postID, dep.name, err)
+			return nil, err
+		}
+		report.Removed[dep.name] = n
+	}
+
+	_, err = d.posts.Delete(postID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Cascade deleted post %v: %v", postID, report.Removed)
+	return report, nil
+}
@@ -0,0 +1,132 @@
+package cascade_test
+
+import (
+	"errors"
+	"fakereddit/redditclone/pkg/cascade"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/saved"
+	"fakereddit/redditclone/pkg/user"
+	"sync"
+	"testing"
+)
+
+var alex = &user.User{ID: 1, Username: "alex"}
+
+func mustPost(t *testing.T, posts post.PostsRepo) uint32 {
+	t.Helper()
+	id, err := posts.Create(&post.Post{Author: alex, Type: "text", Title: "title", Category: "music", Data: "text"})
+	if err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	return id
+}
+
+// failing is a Dependent which fails until it is fixed.
+type failing struct {
+	fixed bool
+}
+
+var errFailing = errors.New("failing dependent")
+
+func (f *failing) DeleteByPost(postID uint32) (int, error) {
+	if !f.fixed {
+		return 0, errFailing
+	}
+	return 0, nil
+}
+
+func TestDeletePurges(t *testing.T) {
+	posts := post.NewPostsRepo()
+	comments := comment.NewCommentsRepo()
+	savedRepo := saved.NewSavedRepo()
+	dep := &failing{}
+	d := cascade.NewDeleter(posts)
+	d.Register("failing", dep)
+	d.Register("comments", comments)
+	d.Register("saved", savedRepo)
+
+	id := mustPost(t, posts)
+	other := mustPost(t, posts)
+	posts.UpVote(id, alex)
+	for _, postID := range []uint32{id, id, other} {
+		if _, err := comments.Create(&comment.Comment{PostID: postID, Author: alex, Body: "body"}); err != nil {
+			t.Fatalf("Create comment: %v", err)
+		}
+	}
+	savedRepo.Save(&saved.Item{UserID: alex.ID, PostID: id})
+	savedRepo.Save(&saved.Item{UserID: alex.ID, PostID: other})
+
+	if _, err := d.Delete(id); err != errFailing {
+		t.Fatalf("Delete with a failing dependent: got %v, want %v", err, errFailing)
+	}
+	if _, err := posts.Read(id); err != nil {
+		t.Fatalf("Read after a failed delete: %v", err)
+	}
+
+	dep.fixed = true
+	report, err := d.Delete(id)
+	if err != nil {
+		t.Fatalf("Delete retried: %v", err)
+	}
+	want := map[string]int{"votes": 1, "comments": 2, "saved": 1, "failing": 0}
+	for name, n := range want {
+		if report.Removed[name] != n {
+			t.Fatalf("Removed %v: got %v, want %v", name, report.Removed[name], n)
+		}
+	}
+	if _, err = posts.Read(id); err != post.ErrNoPost {
+		t.Fatalf("Read deleted post: got %v, want %v", err, post.ErrNoPost)
+	}
+	if _, err = d.Delete(id); err != post.ErrNoPost {
+		t.Fatalf("Delete deleted post: got %v, want %v", err, post.ErrNoPost)
+	}
+
+	left, _ := comments.ReadAll(other)
+	items, _ := savedRepo.List(alex.ID, "")
+	if len(left) != 1 || len(items) != 1 || items[0].PostID != other {
+		t.Fatalf("Delete reached another post: got %v comments, saved %+v", len(left), items)
+	}
+}
+
+// TestDeleteWhileCommenting creates comments the way the handler does, under
+// Lock, while the post is deleted. No comment may outlive the post.
+func TestDeleteWhileCommenting(t *testing.T) {
+	const rounds = 50
+	posts := post.NewPostsRepo()
+	comments := comment.NewCommentsRepo()
+	d := cascade.NewDeleter(posts)
+	d.Register("comments", comments)
+
+	for i := 0; i < rounds; i++ {
+		id := mustPost(t, posts)
+		wg := &sync.WaitGroup{}
+		wg.Add(2)
+		errs := make(chan error, 2)
+		go func() {
+			defer wg.Done()
+			unlock := d.Lock(id)
+			defer unlock()
+			if _, err := posts.Read(id); err != nil {
+				return
+			}
+			_, err := comments.Create(&comment.Comment{PostID: id, Author: alex, Body: "body"})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := d.Delete(id)
+			errs <- err
+		}()
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("round %v: %v", i, err)
+			}
+		}
+		if left, _ := comments.ReadAll(id); len(left) != 0 {
+			t.Fatalf("round %v: comments outlived the post: %+v", i, left)
+		}
+	}
+}
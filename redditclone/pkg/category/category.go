@@ -0,0 +1,79 @@
+package category
+
+import "fakereddit/redditclone/pkg/user"
+
+// Category is a community posts are published in.
+type Category struct {
+	Name        string     `json:"name"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Creator     *user.User `json:"creator"`
+	Created     string     `json:"created"`
+	Rules       []string   `json:"rules"`
+	// PostTypes are the post types allowed here, empty allows all
+	PostTypes []string `json:"postTypes"`
+	// Flairs are the labels posts here can choose from
+	Flairs []*Flair `json:"flairs"`
+}
+
+// Flair is a post label, Color is #rrggbb.
+type Flair struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// Defaults are the categories the frontend knows about, they exist
+// without a creator.
+var Defaults = []*Category{
+	{Name: "music", Title: "Music"},
+	{Name: "funny", Title: "Funny"},
+	{Name: "videos", Title: "Videos"},
+	{Name: "programming", Title: "Programming"},
+	{Name: "news", Title: "News"},
+	{Name: "fashion", Title: "Fashion"},
+}
+
+type CategoriesRepo interface {
+	Create(c *Category) error
+	Get(name string) (*Category, error)
+	List() ([]*Category, error)
+	Subscribe(name string, u *user.User) error
+	Unsubscribe(name string, u *user.User) error
+	// Subscriptions are names of the categories the user follows, sorted
+	Subscriptions(userID uint32) ([]string, error)
+}
+
+// Allows tells if posts of the type can be published in the category.
+func (c *Category) Allows(postType string) bool {
+	if len(c.PostTypes) == 0 {
+		return true
+	}
+	for _, elem := range c.PostTypes {
+		if elem == postType {
+			return true
+		}
+	}
+	return false
+}
+
+// Flair finds the flair of the category by name, nil if there is none.
+func (c *Category) Flair(name string) *Flair {
+	for _, elem := range c.Flairs {
+		if elem.Name == name {
+			return elem
+		}
+	}
+	return nil
+}
+
+// Seed creates the default categories missing in the repo.
+func Seed(repo CategoriesRepo) error {
+	for _, elem := range Defaults {
+		c := *elem
+		err := repo.Create(&c)
+		if err != nil && err != ErrAlreadyExist {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package category
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/user"
+	"sync"
+)
+
+const (
+	opCreate      = "create"
+	opSubscribe   = "subscribe"
+	opUnsubscribe = "unsubscribe"
+)
+
+// DurableCategoriesRepo is a CategoriesDataRepo which logs every created
+// category to a journal and restores itself from it on start.
+type DurableCategoriesRepo struct {
+	*CategoriesDataRepo
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+type categoriesSnapshot struct {
+	Data        []*Category                `json:"data"`
+	Subscribers map[string]map[uint32]bool `json:"subscribers"`
+}
+
+type subscribeEntry struct {
+	Name   string `json:"name"`
+	UserID uint32 `json:"user"`
+}
+
+func NewDurableCategoriesRepo(j *journal.Journal) (*DurableCategoriesRepo, error) {
+	repo := &DurableCategoriesRepo{
+		CategoriesDataRepo: NewCategoriesRepo(),
+		mu:                 &sync.Mutex{},
+		journal:            j,
+	}
+
+	err := j.Load(repo.restore, repo.apply)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (dr *DurableCategoriesRepo) restore(state json.RawMessage) error {
+	snap := &categoriesSnapshot{}
+	if err := json.Unmarshal(state, snap); err != nil {
+		return err
+	}
+	for _, c := range snap.Data {
+		dr.Data[c.Name] = withFlairs(c)
+	}
+	if snap.Subscribers != nil {
+		dr.Subscribers = snap.Subscribers
+	}
+	return nil
+}
+
+func (dr *DurableCategoriesRepo) apply(op string, data json.RawMessage) error {
+	if op == opCreate {
+		c := &Category{}
+		if err := json.Unmarshal(data, c); err != nil {
+			return err
+		}
+		dr.Data[c.Name] = withFlairs(c)
+		return nil
+	}
+
+	e := &subscribeEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return err
+	}
+	switch op {
+	case opSubscribe:
+		return dr.CategoriesDataRepo.Subscribe(e.Name, &user.User{ID: e.UserID})
+	case opUnsubscribe:
+		return dr.CategoriesDataRepo.Unsubscribe(e.Name, &user.User{ID: e.UserID})
+	}
+	return nil
+}
+
+func (dr *DurableCategoriesRepo) Create(c *Category) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.CategoriesDataRepo.Create(c); err != nil {
+		return err
+	}
+	return dr.journal.Append(opCreate, c)
+}
+
+func (dr *DurableCategoriesRepo) Subscribe(name string, u *user.User) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.CategoriesDataRepo.Subscribe(name, u); err != nil {
+		return err
+	}
+	return dr.journal.Append(opSubscribe, &subscribeEntry{Name: name, UserID: u.ID})
+}
+
+func (dr *DurableCategoriesRepo) Unsubscribe(name string, u *user.User) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.CategoriesDataRepo.Unsubscribe(name, u); err != nil {
+		return err
+	}
+	return dr.journal.Append(opUnsubscribe, &subscribeEntry{Name: name, UserID: u.ID})
+}
+
+func (dr *DurableCategoriesRepo) Snapshot() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.CategoriesDataRepo.mu.RLock()
+	snap := &categoriesSnapshot{
+		Data:        make([]*Category, 0, len(dr.Data)),
+		Subscribers: dr.Subscribers,
+	}
+	for _, c := range dr.Data {
+		snap.Data = append(snap.Data, c)
+	}
+	err := dr.journal.Compact(snap)
+	dr.CategoriesDataRepo.mu.RUnlock()
+	return err
+}
+
+// withFlairs fills flairs of categories logged before they had any.
+func withFlairs(c *Category) *Category {
+	if c.Flairs == nil {
+		c.Flairs = []*Flair{}
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+package category
+
+import (
+	"errors"
+	"fakereddit/redditclone/pkg/user"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoCategory   = errors.New("no category found")
+	ErrAlreadyExist = errors.New("category already exists")
+)
+
+type CategoriesDataRepo struct {
+	mu   *sync.RWMutex
+	Data map[string]*Category
+	// Subscribers are user ids by category name
+	Subscribers map[string]map[uint32]bool
+}
+
+func NewCategoriesRepo() *CategoriesDataRepo {
+	log.Printf("NewCategoriesRepo: created CategoriesDataRepo")
+	return &CategoriesDataRepo{
+		Data:        make(map[string]*Category),
+		Subscribers: make(map[string]map[uint32]bool),
+		mu:          &sync.RWMutex{},
+	}
+}
+
+func (cr *CategoriesDataRepo) Create(c *Category) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if _, ok := cr.Data[c.Name]; ok {
+		log.Printf("ERROR: Create category, name already exists: '%v'", c.Name)
+		return ErrAlreadyExist
+	}
+	if c.Created == "" {
+		c.Created = time.Now().Format(time.RFC3339)
+	}
+	c.Rules, c.PostTypes = nonNil(c.Rules), nonNil(c.PostTypes)
+	if c.Flairs == nil {
+		c.Flairs = []*Flair{}
+	}
+	cr.Data[c.Name] = c
+	log.Printf("Created category: '%v'", c.Name)
+	return nil
+}
+
+func (cr *CategoriesDataRepo) Get(name string) (*Category, error) {
+	cr.mu.RLock()
+	elem, ok := cr.Data[name]
+	cr.mu.RUnlock()
+	if !ok {
+		log.Printf("Get category: no category '%v'", name)
+		return nil, ErrNoCategory
+	}
+	return elem, nil
+}
+
+// List returns all categories sorted by name.
+func (cr *CategoriesDataRepo) List() ([]*Category, error) {
+	cr.mu.RLock()
+	res := make([]*Category, 0, len(cr.Data))
+	for _, elem := range cr.Data {
+		res = append(res, elem)
+	}
+	cr.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	log.Printf("List categories: %v", len(res))
+	return res, nil
+}
+
+// Subscribe is a no-op for a user already subscribed.
+func (cr *CategoriesDataRepo) Subscribe(name string, u *user.User) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if _, ok := cr.Data[name]; !ok {
+		log.Printf("ERROR: Subscribe: no category '%v'", name)
+		return ErrNoCategory
+	}
+	if cr.Subscribers[name] == nil {
+		cr.Subscribers[name] = make(map[uint32]bool)
+	}
+	cr.Subscribers[name][u.ID] = true
+	log.Printf("Subscribe: user %v to '%v'", u.ID, name)
+	return nil
+}
+
+func (cr *CategoriesDataRepo) Unsubscribe(name string, u *user.User) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if _, ok := cr.Data[name]; !ok {
+		log.Printf("ERROR: Unsubscribe: no category '%v'", name)
+		return ErrNoCategory
+	}
+	delete(cr.Subscribers[name], u.ID)
+	log.Printf("Unsubscribe: user %v from '%v'", u.ID, name)
+	return nil
+}
+
+func (cr *CategoriesDataRepo) Subscriptions(userID uint32) ([]string, error) {
+	res := make([]string, 0)
+	cr.mu.RLock()
+	for name, users := range cr.Subscribers {
+		if users[userID] {
+			res = append(res, name)
+		}
+	}
+	cr.mu.RUnlock()
+	sort.Strings(res)
+	return res, nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,218 @@
+package category
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fakereddit/redditclone/pkg/sqlite"
+	"fakereddit/redditclone/pkg/user"
+	"log"
+	"strings"
+	"time"
+)
+
+// rules, post types and flairs are short lists, they are stored as json
+const categoriesSchema = `
+CREATE TABLE IF NOT EXISTS categories (
+	name        TEXT    PRIMARY KEY,
+	title       TEXT    NOT NULL,
+	description TEXT    NOT NULL DEFAULT '',
+	creator_id  INTEGER REFERENCES users (id),
+	created     TEXT    NOT NULL,
+	rules       TEXT    NOT NULL DEFAULT '[]',
+	post_types  TEXT    NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE IF NOT EXISTS category_subscriptions (
+	category TEXT    NOT NULL REFERENCES categories (name),
+	user_id  INTEGER NOT NULL REFERENCES users (id),
+	PRIMARY KEY (category, user_id)
+);
+CREATE INDEX IF NOT EXISTS category_subscriptions_user ON category_subscriptions (user_id);`
+
+// columns added after the first schema version
+var categoriesColumns = [][2]string{
+	{"flairs", "TEXT NOT NULL DEFAULT '[]'"},
+}
+
+const selectCategories = `
+SELECT c.name, c.title, c.description, c.created, c.rules, c.post_types, c.flairs, u.id, u.username
+FROM categories c LEFT JOIN users u ON u.id = c.creator_id`
+
+type CategoriesSQLiteRepo struct {
+	db *sql.DB
+}
+
+func NewCategoriesSQLiteRepo(db *sql.DB) (*CategoriesSQLiteRepo, error) {
+	if _, err := db.Exec(categoriesSchema); err != nil {
+		return nil, err
+	}
+	for _, col := range categoriesColumns {
+		if err := sqlite.AddColumn(db, "categories", col[0], col[1]); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("NewCategoriesSQLiteRepo: created CategoriesSQLiteRepo")
+	return &CategoriesSQLiteRepo{db: db}, nil
+}
+
+func (cr *CategoriesSQLiteRepo) Create(c *Category) error {
+	if c.Created == "" {
+		c.Created = time.Now().Format(time.RFC3339)
+	}
+	rules, err := json.Marshal(nonNil(c.Rules))
+	if err != nil {
+		return err
+	}
+	postTypes, err := json.Marshal(nonNil(c.PostTypes))
+	if err != nil {
+		return err
+	}
+	if c.Flairs == nil {
+		c.Flairs = []*Flair{}
+	}
+	flairs, err := json.Marshal(c.Flairs)
+	if err != nil {
+		return err
+	}
+	var creatorID sql.NullInt64
+	if c.Creator != nil {
+		creatorID = sql.NullInt64{Int64: int64(c.Creator.ID), Valid: true}
+	}
+
+	_, err = cr.db.Exec(`INSERT INTO categories (name, title, description, creator_id, created, rules, post_types, flairs)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Name, c.Title, c.Description, creatorID, c.Created, string(rules), string(postTypes), string(flairs))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			log.Printf("ERROR: Create category, name already exists: '%v'", c.Name)
+			return ErrAlreadyExist
+		}
+		return err
+	}
+	log.Printf("Created category: '%v'", c.Name)
+	return nil
+}
+
+func (cr *CategoriesSQLiteRepo) Get(name string) (*Category, error) {
+	c, err := scanCategory(cr.db.QueryRow(selectCategories+` WHERE c.name = ?`, name))
+	if err == sql.ErrNoRows {
+		log.Printf("Get category: no category '%v'", name)
+		return nil, ErrNoCategory
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// List returns all categories sorted by name.
+func (cr *CategoriesSQLiteRepo) List() ([]*Category, error) {
+	rows, err := cr.db.Query(selectCategories + ` ORDER BY c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Category, 0)
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	log.Printf("List categories: %v", len(res))
+	return res, nil
+}
+
+// Subscribe is a no-op for a user already subscribed.
+func (cr *CategoriesSQLiteRepo) Subscribe(name string, u *user.User) error {
+	if err := cr.exists(name); err != nil {
+		log.Printf("ERROR: Subscribe: no category '%v'", name)
+		return err
+	}
+	_, err := cr.db.Exec(`INSERT OR IGNORE INTO category_subscriptions (category, user_id) VALUES (?, ?)`, name, u.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Subscribe: user %v to '%v'", u.ID, name)
+	return nil
+}
+
+func (cr *CategoriesSQLiteRepo) Unsubscribe(name string, u *user.User) error {
+	if err := cr.exists(name); err != nil {
+		log.Printf("ERROR: Unsubscribe: no category '%v'", name)
+		return err
+	}
+	_, err := cr.db.Exec(`DELETE FROM category_subscriptions WHERE category = ? AND user_id = ?`, name, u.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Unsubscribe: user %v from '%v'", u.ID, name)
+	return nil
+}
+
+func (cr *CategoriesSQLiteRepo) Subscriptions(userID uint32) ([]string, error) {
+	rows, err := cr.db.Query(`SELECT category FROM category_subscriptions WHERE user_id = ? ORDER BY category`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		res = append(res, name)
+	}
+	return res, rows.Err()
+}
+
+func (cr *CategoriesSQLiteRepo) exists(name string) error {
+	var n int
+	err := cr.db.QueryRow(`SELECT count(*) FROM categories WHERE name = ?`, name).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoCategory
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCategory(row scanner) (*Category, error) {
+	var (
+		c           = &Category{}
+		rules       string
+		postTypes   string
+		flairs      string
+		creatorID   sql.NullInt64
+		creatorName sql.NullString
+	)
+	err := row.Scan(&c.Name, &c.Title, &c.Description, &c.Created, &rules, &postTypes, &flairs, &creatorID, &creatorName)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(rules), &c.Rules); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(postTypes), &c.PostTypes); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(flairs), &c.Flairs); err != nil {
+		return nil, err
+	}
+	if creatorID.Valid {
+		c.Creator = &user.User{ID: uint32(creatorID.Int64), Username: creatorName.String}
+	}
+	return c, nil
+}
@@ -4,17 +4,56 @@ import (
 	"fakereddit/redditclone/pkg/user"
 )
 
+const (
+	UpVote   = 1
+	NoVote   = 0
+	DownVote = -1
+)
+
 type Comment struct {
-	ID      uint32     `json:"id"`
-	Author  *user.User `json:"author"`
-	Created string     `json:"created"`
+	ID               uint32     `json:"id"`
+	Author           *user.User `json:"author"`
+	Created          string     `json:"created"`
+	Body             string     `json:"body"`
+	PostID           uint32     `json:"-"`
+	DeletedAt        string     `json:"deletedAt,omitempty"`
+	DeletedBy        *user.User `json:"deletedBy,omitempty"`
+	Edited           string     `json:"edited,omitempty"`
+	Score            int        `json:"score"`
+	UpvotePercentage int        `json:"upvotePercentage"`
+	Votes            []*Vote    `json:"votes"`
+	// ParentID is the comment this one replies to, 0 for top level comments
+	ParentID uint32 `json:"parent,omitempty"`
+	// Depth is set by Thread, it is not stored
+	Depth int `json:"depth"`
+}
+
+type Vote struct {
+	UserID uint32 `json:"user"`
+	Vote   int    `json:"vote"`
+}
+
+// Revision is one version of the comment body, Author is who wrote it.
+type Revision struct {
+	Version int        `json:"version"`
 	Body    string     `json:"body"`
-	PostID  uint32     `json:"-"`
+	Created string     `json:"created"`
+	Author  *user.User `json:"author"`
 }
 
 type CommentsRepo interface {
 	Create(comm *Comment) (uint32, error)
 	ReadAll(postID uint32) ([]*Comment, error)
+	ReadUser(login string) ([]*Comment, error)
 	Delete(postID, commentID uint32) (bool, error)
+	DeleteByPost(postID uint32) (int, error)
 	List() (map[uint32][]*Comment, error)
+	Trash(postID, commentID uint32, by *user.User) (*Comment, error)
+	Restore(postID, commentID uint32) (*Comment, error)
+	ReadTrash() ([]*Comment, error)
+	Update(postID, commentID uint32, body string, editor *user.User) (*Comment, error)
+	ReadRevisions(postID, commentID uint32) ([]*Revision, error)
+	UpVote(postID, commentID uint32, u *user.User) (*Comment, error)
+	DownVote(postID, commentID uint32, u *user.User) (*Comment, error)
+	UnVote(postID, commentID uint32, u *user.User) (*Comment, error)
 }
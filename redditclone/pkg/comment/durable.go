@@ -0,0 +1,227 @@
+package comment
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/user"
+	"sync"
+)
+
+const (
+	opCreate       = "create"
+	opDelete       = "delete"
+	opDeleteByPost = "deletepost"
+	opTrash        = "trash"
+	opRestore      = "restore"
+	opUpdate       = "update"
+	opUpVote       = "upvote"
+	opDownVote     = "downvote"
+	opUnVote       = "unvote"
+)
+
+// DurableCommentsRepo is a CommentsDataRepo which logs every mutation to
+// a journal and restores itself from it on start.
+type DurableCommentsRepo struct {
+	*CommentsDataRepo
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+type commentsSnapshot struct {
+	LastID    map[uint32]uint32                 `json:"lastID"`
+	Data      map[uint32][]*Comment             `json:"data"`
+	Revisions map[uint32]map[uint32][]*Revision `json:"revisions"`
+}
+
+// Comment.PostID is hidden from json, so the entries carry it separately.
+type commentEntry struct {
+	PostID    uint32     `json:"post"`
+	CommentID uint32     `json:"comment,omitempty"`
+	Comment   *Comment   `json:"data,omitempty"`
+	DeletedAt string     `json:"deletedAt,omitempty"`
+	DeletedBy *user.User `json:"deletedBy,omitempty"`
+	Body      string     `json:"body,omitempty"`
+	Editor    *user.User `json:"editor,omitempty"`
+	Edited    string     `json:"edited,omitempty"`
+	User      *user.User `json:"user,omitempty"`
+}
+
+func NewDurableCommentsRepo(j *journal.Journal) (*DurableCommentsRepo, error) {
+	repo := &DurableCommentsRepo{
+		CommentsDataRepo: NewCommentsRepo(),
+		mu:               &sync.Mutex{},
+		journal:          j,
+	}
+
+	err := j.Load(repo.restore, repo.apply)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (dr *DurableCommentsRepo) restore(state json.RawMessage) error {
+	snap := &commentsSnapshot{}
+	if err := json.Unmarshal(state, snap); err != nil {
+		return err
+	}
+	for postID, comments := range snap.Data {
+		for _, comm := range comments {
+			comm.PostID = postID
+		}
+	}
+	if snap.LastID != nil {
+		dr.LastID = snap.LastID
+	}
+	if snap.Data != nil {
+		dr.Data = snap.Data
+	}
+	if snap.Revisions != nil {
+		dr.Revisions = snap.Revisions
+	}
+	return nil
+}
+
+func (dr *DurableCommentsRepo) apply(op string, data json.RawMessage) error {
+	e := &commentEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return err
+	}
+
+	switch op {
+	case opCreate:
+		e.Comment.PostID = e.PostID
+		dr.Data[e.PostID] = append(dr.Data[e.PostID], e.Comment)
+		dr.LastID[e.PostID] = e.Comment.ID
+	case opDelete:
+		_, err := dr.CommentsDataRepo.Delete(e.PostID, e.CommentID)
+		return err
+	case opDeleteByPost:
+		_, err := dr.CommentsDataRepo.DeleteByPost(e.PostID)
+		return err
+	case opTrash, opRestore:
+		// replayed by hand to keep the logged deletion time
+		if dr.trash(e.PostID, e.CommentID, e.DeletedAt, e.DeletedBy) == nil {
+			return ErrNoComm
+		}
+	case opUpdate:
+		if dr.update(e.PostID, e.CommentID, e.Body, e.Editor, e.Edited) == nil {
+			return ErrNoComm
+		}
+	case opUpVote:
+		_, err := dr.CommentsDataRepo.UpVote(e.PostID, e.CommentID, e.User)
+		return err
+	case opDownVote:
+		_, err := dr.CommentsDataRepo.DownVote(e.PostID, e.CommentID, e.User)
+		return err
+	case opUnVote:
+		_, err := dr.CommentsDataRepo.UnVote(e.PostID, e.CommentID, e.User)
+		return err
+	}
+	return nil
+}
+
+func (dr *DurableCommentsRepo) Create(comm *Comment) (uint32, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	id, err := dr.CommentsDataRepo.Create(comm)
+	if err != nil {
+		return 0, err
+	}
+	return id, dr.journal.Append(opCreate, &commentEntry{PostID: comm.PostID, Comment: comm})
+}
+
+func (dr *DurableCommentsRepo) Delete(postID, commentID uint32) (bool, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	ok, err := dr.CommentsDataRepo.Delete(postID, commentID)
+	if err != nil {
+		return ok, err
+	}
+	return ok, dr.journal.Append(opDelete, &commentEntry{PostID: postID, CommentID: commentID})
+}
+
+func (dr *DurableCommentsRepo) DeleteByPost(postID uint32) (int, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	n, err := dr.CommentsDataRepo.DeleteByPost(postID)
+	if err != nil {
+		return n, err
+	}
+	return n, dr.journal.Append(opDeleteByPost, &commentEntry{PostID: postID})
+}
+
+func (dr *DurableCommentsRepo) Trash(postID, commentID uint32, by *user.User) (*Comment, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	comm, err := dr.CommentsDataRepo.Trash(postID, commentID, by)
+	if err != nil {
+		return nil, err
+	}
+	return comm, dr.journal.Append(opTrash, &commentEntry{
+		PostID:    postID,
+		CommentID: commentID,
+		DeletedAt: comm.DeletedAt,
+		DeletedBy: comm.DeletedBy,
+	})
+}
+
+func (dr *DurableCommentsRepo) Restore(postID, commentID uint32) (*Comment, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	comm, err := dr.CommentsDataRepo.Restore(postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	return comm, dr.journal.Append(opRestore, &commentEntry{PostID: postID, CommentID: commentID})
+}
+
+func (dr *DurableCommentsRepo) Update(postID, commentID uint32, body string, editor *user.User) (*Comment, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	comm, err := dr.CommentsDataRepo.Update(postID, commentID, body, editor)
+	if err != nil {
+		return nil, err
+	}
+	return comm, dr.journal.Append(opUpdate, &commentEntry{
+		PostID:    postID,
+		CommentID: commentID,
+		Body:      body,
+		Editor:    editor,
+		Edited:    comm.Edited,
+	})
+}
+
+func (dr *DurableCommentsRepo) UpVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return dr.vote(opUpVote, dr.CommentsDataRepo.UpVote, postID, commentID, u)
+}
+
+func (dr *DurableCommentsRepo) DownVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return dr.vote(opDownVote, dr.CommentsDataRepo.DownVote, postID, commentID, u)
+}
+
+func (dr *DurableCommentsRepo) UnVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return dr.vote(opUnVote, dr.CommentsDataRepo.UnVote, postID, commentID, u)
+}
+
+func (dr *DurableCommentsRepo) vote(op string, do func(uint32, uint32, *user.User) (*Comment, error), postID, commentID uint32, u *user.User) (*Comment, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	comm, err := do(postID, commentID, u)
+	if err != nil {
+		return nil, err
+	}
+	return comm, dr.journal.Append(op, &commentEntry{PostID: postID, CommentID: commentID, User: u})
+}
+
+func (dr *DurableCommentsRepo) Snapshot() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.CommentsDataRepo.mu.RLock()
+	defer dr.CommentsDataRepo.mu.RUnlock()
+	return dr.journal.Compact(&commentsSnapshot{
+		LastID:    dr.LastID,
+		Data:      dr.Data,
+		Revisions: dr.Revisions,
+	})
+}
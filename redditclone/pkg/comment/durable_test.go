@@ -0,0 +1,85 @@
+package comment_test
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/user"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openComments(t *testing.T, dir string) (*comment.DurableCommentsRepo, *journal.Journal) {
+	t.Helper()
+	j, err := journal.Open(dir, "comments")
+	if err != nil {
+		t.Fatalf("Open journal: %v", err)
+	}
+	repo, err := comment.NewDurableCommentsRepo(j)
+	if err != nil {
+		t.Fatalf("NewDurableCommentsRepo: %v", err)
+	}
+	return repo, j
+}
+
+func commentsState(t *testing.T, repo *comment.DurableCommentsRepo) string {
+	t.Helper()
+	raw, err := json.Marshal(struct {
+		LastID    map[uint32]uint32
+		Data      map[uint32][]*comment.Comment
+		Revisions map[uint32]map[uint32][]*comment.Revision
+	}{repo.LastID, repo.Data, repo.Revisions})
+	if err != nil {
+		t.Fatalf("Marshal state: %v", err)
+	}
+	return string(raw)
+}
+
+func TestDurableCommentsReplay(t *testing.T) {
+	dir := t.TempDir()
+	repo, j := openComments(t, dir)
+	alex := &user.User{ID: 1, Username: "alex"}
+	bob := &user.User{ID: 2, Username: "bob"}
+
+	first, _ := repo.Create(&comment.Comment{PostID: 1, Author: alex, Body: "first"})
+	reply, _ := repo.Create(&comment.Comment{PostID: 1, ParentID: first, Author: bob, Body: "reply"})
+	other, _ := repo.Create(&comment.Comment{PostID: 2, Author: bob, Body: "other"})
+	repo.UpVote(1, first, bob)
+	if err := repo.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	repo.DownVote(1, first, alex)
+	repo.Update(1, reply, "reply 2", bob)
+	repo.Trash(1, reply, bob)
+	repo.Delete(2, other)
+	repo.Create(&comment.Comment{PostID: 3, Author: alex, Body: "third"})
+	repo.DeleteByPost(3)
+	want := commentsState(t, repo)
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close journal: %v", err)
+	}
+
+	reopened, j := openComments(t, dir)
+	if got := commentsState(t, reopened); got != want {
+		t.Fatalf("Replayed state:\n got %v\nwant %v", got, want)
+	}
+	j.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, "comments.log"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Open log: %v", err)
+	}
+	f.WriteString(`{"seq":99,"op":"create","data":{"bo`)
+	f.Close()
+
+	reopened, j = openComments(t, dir)
+	defer j.Close()
+	if got := commentsState(t, reopened); got != want {
+		t.Fatalf("State with a truncated record:\n got %v\nwant %v", got, want)
+	}
+	if _, err = reopened.Create(&comment.Comment{PostID: 1, Author: alex, Body: "next"}); err != nil {
+		t.Fatalf("Create after the truncated record: %v", err)
+	}
+}
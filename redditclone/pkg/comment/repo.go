@@ -2,7 +2,9 @@ package comment
 
 import (
 	"errors"
+	"fakereddit/redditclone/pkg/user"
 	"log"
+	"sort"
 	"sync"
 	"time"
 )
@@ -15,14 +17,17 @@ type CommentsDataRepo struct {
 	mu     *sync.RWMutex
 	LastID map[uint32]uint32
 	Data   map[uint32][]*Comment
+	// Revisions of edited comments by post and comment id
+	Revisions map[uint32]map[uint32][]*Revision
 }
 
 func NewCommentsRepo() *CommentsDataRepo {
 	log.Printf("NewCommentsRepo: created CommentsDataRepo")
 	return &CommentsDataRepo{
-		Data:   make(map[uint32][]*Comment),
-		mu:     &sync.RWMutex{},
-		LastID: make(map[uint32]uint32),
+		Data:      make(map[uint32][]*Comment),
+		mu:        &sync.RWMutex{},
+		LastID:    make(map[uint32]uint32),
+		Revisions: make(map[uint32]map[uint32][]*Revision),
 	}
 }
 
@@ -31,29 +36,63 @@ func (cr *CommentsDataRepo) Create(comm *Comment) (uint32, error) {
 	cr.LastID[comm.PostID]++
 	comm.ID = cr.LastID[comm.PostID]
 	comm.Created = time.Now().Format(time.RFC3339)
+	comm.Votes = make([]*Vote, 0)
 	cr.Data[comm.PostID] = append(cr.Data[comm.PostID], comm)
+	id := comm.ID
 	cr.mu.Unlock()
-	log.Printf("Created comment: %v", comm.ID)
-	return cr.LastID[comm.PostID], nil
+	log.Printf("Created comment: %v", id)
+	return id, nil
 }
 
 func (cr *CommentsDataRepo) ReadAll(postID uint32) ([]*Comment, error) {
+	cr.mu.RLock()
+	res := make([]*Comment, len(cr.Data[postID]))
+	copy(res, cr.Data[postID])
+	cr.mu.RUnlock()
 	log.Printf("List comments, post %v", postID)
-	return cr.Data[postID], nil
+	return res, nil
+}
+
+// ReadUser lists comments of the user that are not in the trash, by post
+// and comment id.
+func (cr *CommentsDataRepo) ReadUser(login string) ([]*Comment, error) {
+	res := make([]*Comment, 0)
+	cr.mu.RLock()
+	for _, comments := range cr.Data {
+		for _, elem := range comments {
+			if elem.Author.Username == login && elem.DeletedAt == "" {
+				res = append(res, elem)
+			}
+		}
+	}
+	cr.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].PostID < res[j].PostID || res[i].PostID == res[j].PostID && res[i].ID < res[j].ID
+	})
+	log.Printf("List comments of '%v'", login)
+	return res, nil
 }
 
 func (cr *CommentsDataRepo) List() (map[uint32][]*Comment, error) {
+	cr.mu.RLock()
+	res := make(map[uint32][]*Comment, len(cr.Data))
+	for postID, comments := range cr.Data {
+		res[postID] = make([]*Comment, len(comments))
+		copy(res[postID], comments)
+	}
+	cr.mu.RUnlock()
 	log.Printf("List comments")
-	return cr.Data, nil
+	return res, nil
 }
 
 func (cr *CommentsDataRepo) Delete(postID, commentID uint32) (bool, error) {
 	cr.mu.Lock()
+	defer cr.mu.Unlock()
 	detect := -1
 	for idx, elem := range cr.Data[postID] {
 		if elem.ID == commentID {
 			detect = idx
-			continue
+			break
 		}
 	}
 	if detect < 0 {
@@ -61,12 +100,251 @@ func (cr *CommentsDataRepo) Delete(postID, commentID uint32) (bool, error) {
 		return false, ErrNoComm
 	}
 
+	// replies move up to the parent of the deleted comment
+	parentID := cr.Data[postID][detect].ParentID
+	for idx, elem := range cr.Data[postID] {
+		if elem.ParentID == commentID {
+			moved := *elem
+			moved.ParentID = parentID
+			cr.Data[postID][idx] = &moved
+		}
+	}
+
 	if detect < len(cr.Data[postID])-1 {
 		copy(cr.Data[postID][detect:], cr.Data[postID][detect+1:])
 	}
 	cr.Data[postID][len(cr.Data[postID])-1] = nil
 	cr.Data[postID] = cr.Data[postID][:len(cr.Data[postID])-1]
-	cr.mu.Unlock()
+	delete(cr.Revisions[postID], commentID)
 	log.Printf("Deleted post comment: postID %v, commID %v", postID, commentID)
 	return true, nil
 }
+
+// DeleteByPost removes all comments of the post together with its id counter.
+func (cr *CommentsDataRepo) DeleteByPost(postID uint32) (int, error) {
+	cr.mu.Lock()
+	n := len(cr.Data[postID])
+	delete(cr.Data, postID)
+	delete(cr.LastID, postID)
+	delete(cr.Revisions, postID)
+	cr.mu.Unlock()
+	log.Printf("Deleted %v comments of post %v", n, postID)
+	return n, nil
+}
+
+// Trash marks the comment as deleted, threads show it as a placeholder.
+func (cr *CommentsDataRepo) Trash(postID, commentID uint32, by *user.User) (*Comment, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	comm := cr.find(postID, commentID)
+	if comm == nil {
+		log.Printf("ERROR: Comment Trash, can't find post %v, id %v", postID, commentID)
+		return nil, ErrNoComm
+	}
+	if comm.DeletedAt == "" {
+		comm = cr.trash(postID, commentID, time.Now().Format(time.RFC3339), by)
+	}
+	log.Printf("Trashed post comment: postID %v, commID %v", postID, commentID)
+	return comm, nil
+}
+
+func (cr *CommentsDataRepo) Restore(postID, commentID uint32) (*Comment, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	comm := cr.trash(postID, commentID, "", nil)
+	if comm == nil {
+		log.Printf("ERROR: Comment Restore, can't find post %v, id %v", postID, commentID)
+		return nil, ErrNoComm
+	}
+	log.Printf("Restored post comment: postID %v, commID %v", postID, commentID)
+	return comm, nil
+}
+
+// trash sets the deletion marks of the comment, empty at restores it. Like
+// update it replaces the comment with a copy. The caller holds mu.
+func (cr *CommentsDataRepo) trash(postID, commentID uint32, at string, by *user.User) *Comment {
+	for idx, elem := range cr.Data[postID] {
+		if elem.ID != commentID {
+			continue
+		}
+		trashed := *elem
+		trashed.DeletedAt = at
+		trashed.DeletedBy = by
+		cr.Data[postID][idx] = &trashed
+		return &trashed
+	}
+	return nil
+}
+
+func (cr *CommentsDataRepo) ReadTrash() ([]*Comment, error) {
+	res := make([]*Comment, 0)
+	cr.mu.RLock()
+	for _, comments := range cr.Data {
+		for _, comm := range comments {
+			if comm.DeletedAt != "" {
+				res = append(res, comm)
+			}
+		}
+	}
+	cr.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].PostID != res[j].PostID {
+			return res[i].PostID < res[j].PostID
+		}
+		return res[i].ID < res[j].ID
+	})
+	log.Printf("ReadTrash comments")
+	return res, nil
+}
+
+// Update replaces the body of the comment, the previous versions are kept
+// as revisions.
+func (cr *CommentsDataRepo) Update(postID, commentID uint32, body string, editor *user.User) (*Comment, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	comm := cr.update(postID, commentID, body, editor, time.Now().Format(time.RFC3339))
+	if comm == nil {
+		log.Printf("ERROR: Comment Update, can't find post %v, id %v", postID, commentID)
+		return nil, ErrNoComm
+	}
+	log.Printf("Updated post comment: postID %v, commID %v", postID, commentID)
+	return comm, nil
+}
+
+// ReadRevisions returns all versions of the comment, the current one last.
+func (cr *CommentsDataRepo) ReadRevisions(postID, commentID uint32) ([]*Revision, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	comm := cr.find(postID, commentID)
+	if comm == nil {
+		log.Printf("ERROR: Comment ReadRevisions, can't find post %v, id %v", postID, commentID)
+		return nil, ErrNoComm
+	}
+	revs := cr.Revisions[postID][commentID]
+	if len(revs) == 0 {
+		revs = []*Revision{firstRevision(comm)}
+	}
+	res := make([]*Revision, len(revs))
+	copy(res, revs)
+	return res, nil
+}
+
+// update replaces the comment with an edited copy, so that slices handed
+// out by ReadAll keep the old version. The caller holds mu.
+func (cr *CommentsDataRepo) update(postID, commentID uint32, body string, editor *user.User, at string) *Comment {
+	for idx, elem := range cr.Data[postID] {
+		if elem.ID != commentID {
+			continue
+		}
+		if cr.Revisions[postID] == nil {
+			cr.Revisions[postID] = make(map[uint32][]*Revision)
+		}
+		revs := cr.Revisions[postID][commentID]
+		if len(revs) == 0 {
+			revs = append(revs, firstRevision(elem))
+		}
+		cr.Revisions[postID][commentID] = append(revs, &Revision{
+			Version: len(revs) + 1,
+			Body:    body,
+			Created: at,
+			Author:  editor,
+		})
+
+		edited := *elem
+		edited.Body = body
+		edited.Edited = at
+		cr.Data[postID][idx] = &edited
+		return &edited
+	}
+	return nil
+}
+
+func (cr *CommentsDataRepo) UpVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return cr.vote(postID, commentID, u, UpVote)
+}
+
+func (cr *CommentsDataRepo) DownVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return cr.vote(postID, commentID, u, DownVote)
+}
+
+func (cr *CommentsDataRepo) UnVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return cr.vote(postID, commentID, u, NoVote)
+}
+
+// vote stores the user's vote, NoVote removes it. Like update it replaces
+// the comment with a copy.
+func (cr *CommentsDataRepo) vote(postID, commentID uint32, u *user.User, vote int) (*Comment, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for idx, elem := range cr.Data[postID] {
+		if elem.ID != commentID {
+			continue
+		}
+
+		voted := *elem
+		voted.Votes = make([]*Vote, 0, len(elem.Votes)+1)
+		for _, v := range elem.Votes {
+			if v.UserID != u.ID {
+				voted.Votes = append(voted.Votes, v)
+			}
+		}
+		if vote != NoVote {
+			voted.Votes = append(voted.Votes, &Vote{UserID: u.ID, Vote: vote})
+		}
+		voted.Score = SetScore(&voted)
+		voted.UpvotePercentage = UpVotePer(&voted)
+		cr.Data[postID][idx] = &voted
+
+		log.Printf("Voted %v for post comment: postID %v, commID %v", vote, postID, commentID)
+		return &voted, nil
+	}
+	log.Printf("ERROR: Comment vote, can't find post %v, id %v", postID, commentID)
+	return nil, ErrNoComm
+}
+
+func UpVotePer(comm *Comment) int {
+	count := 0
+	for _, elem := range comm.Votes {
+		if elem.Vote == UpVote {
+			count++
+		}
+	}
+
+	if len(comm.Votes) == 0 {
+		return 0
+	}
+
+	return int(float32(count) / float32(len(comm.Votes)) * 100)
+}
+
+func SetScore(comm *Comment) int {
+	count := 0
+	for _, elem := range comm.Votes {
+		if elem.Vote == UpVote {
+			count++
+		} else {
+			count--
+		}
+	}
+
+	return count
+}
+
+func firstRevision(comm *Comment) *Revision {
+	return &Revision{
+		Version: 1,
+		Body:    comm.Body,
+		Created: comm.Created,
+		Author:  comm.Author,
+	}
+}
+
+// find returns the comment or nil, the caller holds mu.
+func (cr *CommentsDataRepo) find(postID, commentID uint32) *Comment {
+	for _, elem := range cr.Data[postID] {
+		if elem.ID == commentID {
+			return elem
+		}
+	}
+	return nil
+}
@@ -0,0 +1,487 @@
+package comment
+
+import (
+	"database/sql"
+	"fakereddit/redditclone/pkg/sqlite"
+	"fakereddit/redditclone/pkg/user"
+	"log"
+	"time"
+)
+
+// Comment ids are allocated per post like in CommentsDataRepo, so the last
+// used id is kept in comment_ids and survives deletion of the comment.
+const commentsSchema = `
+CREATE TABLE IF NOT EXISTS comment_ids (
+	post_id INTEGER PRIMARY KEY REFERENCES posts (id) ON DELETE CASCADE,
+	last_id INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+	post_id   INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	id        INTEGER NOT NULL,
+	author_id INTEGER NOT NULL REFERENCES users (id),
+	body      TEXT    NOT NULL,
+	created   TEXT    NOT NULL,
+	PRIMARY KEY (post_id, id)
+);
+CREATE INDEX IF NOT EXISTS comments_author ON comments (author_id);
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+	post_id    INTEGER NOT NULL,
+	comment_id INTEGER NOT NULL,
+	version    INTEGER NOT NULL,
+	body       TEXT    NOT NULL,
+	created    TEXT    NOT NULL,
+	editor_id  INTEGER NOT NULL REFERENCES users (id),
+	PRIMARY KEY (post_id, comment_id, version),
+	FOREIGN KEY (post_id, comment_id) REFERENCES comments (post_id, id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS comment_votes (
+	post_id    INTEGER NOT NULL,
+	comment_id INTEGER NOT NULL,
+	user_id    INTEGER NOT NULL REFERENCES users (id),
+	vote       INTEGER NOT NULL,
+	PRIMARY KEY (post_id, comment_id, user_id),
+	FOREIGN KEY (post_id, comment_id) REFERENCES comments (post_id, id) ON DELETE CASCADE
+);`
+
+// columns added after the first schema version
+var commentsColumns = [][2]string{
+	{"deleted_at", "TEXT NOT NULL DEFAULT ''"},
+	{"deleted_by", "INTEGER REFERENCES users (id)"},
+	{"edited", "TEXT NOT NULL DEFAULT ''"},
+	{"parent_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"score", "INTEGER NOT NULL DEFAULT 0"},
+	{"upvote_percentage", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+const selectComments = `
+SELECT c.post_id, c.id, c.body, c.created, u.id, u.username, c.deleted_at, d.id, d.username,
+	c.edited, c.parent_id, c.score, c.upvote_percentage
+FROM comments c JOIN users u ON u.id = c.author_id LEFT JOIN users d ON d.id = c.deleted_by`
+
+type CommentsSQLiteRepo struct {
+	db *sql.DB
+}
+
+func NewCommentsSQLiteRepo(db *sql.DB) (*CommentsSQLiteRepo, error) {
+	if _, err := db.Exec(commentsSchema); err != nil {
+		return nil, err
+	}
+	for _, col := range commentsColumns {
+		if err := sqlite.AddColumn(db, "comments", col[0], col[1]); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("NewCommentsSQLiteRepo: created CommentsSQLiteRepo")
+	return &CommentsSQLiteRepo{db: db}, nil
+}
+
+func (cr *CommentsSQLiteRepo) Create(comm *Comment) (uint32, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO comment_ids (post_id, last_id) VALUES (?, 1)
+		ON CONFLICT (post_id) DO UPDATE SET last_id = last_id + 1`, comm.PostID)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.QueryRow(`SELECT last_id FROM comment_ids WHERE post_id = ?`, comm.PostID).Scan(&comm.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	comm.Created = time.Now().Format(time.RFC3339)
+	comm.Votes = make([]*Vote, 0)
+	_, err = tx.Exec(`INSERT INTO comments (post_id, id, author_id, body, created, parent_id) VALUES (?, ?, ?, ?, ?, ?)`,
+		comm.PostID, comm.ID, comm.Author.ID, comm.Body, comm.Created, comm.ParentID)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	log.Printf("Created comment: %v", comm.ID)
+	return comm.ID, nil
+}
+
+func (cr *CommentsSQLiteRepo) ReadAll(postID uint32) ([]*Comment, error) {
+	log.Printf("List comments, post %v", postID)
+	return cr.query(selectComments+` WHERE c.post_id = ? ORDER BY c.id`, postID)
+}
+
+func (cr *CommentsSQLiteRepo) ReadUser(login string) ([]*Comment, error) {
+	log.Printf("List comments of '%v'", login)
+	return cr.query(selectComments+` WHERE u.username = ? AND c.deleted_at = '' ORDER BY c.post_id, c.id`, login)
+}
+
+func (cr *CommentsSQLiteRepo) List() (map[uint32][]*Comment, error) {
+	log.Printf("List comments")
+	rows, err := cr.db.Query(selectComments + ` ORDER BY c.post_id, c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[uint32][]*Comment)
+	all := make([]*Comment, 0)
+	for rows.Next() {
+		comm, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		res[comm.PostID] = append(res[comm.PostID], comm)
+		all = append(all, comm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err = cr.readVotes(all); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Delete removes the comment, its replies move up to its parent.
+func (cr *CommentsSQLiteRepo) Delete(postID, commentID uint32) (bool, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var parentID uint32
+	err = tx.QueryRow(`SELECT parent_id FROM comments WHERE post_id = ? AND id = ?`, postID, commentID).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		log.Printf("ERROR: Comment Delete, can't find post %v, id %v", postID, commentID)
+		return false, ErrNoComm
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`UPDATE comments SET parent_id = ? WHERE post_id = ? AND parent_id = ?`, parentID, postID, commentID)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`DELETE FROM comments WHERE post_id = ? AND id = ?`, postID, commentID)
+	if err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	log.Printf("Deleted post comment: postID %v, commID %v", postID, commentID)
+	return true, nil
+}
+
+func (cr *CommentsSQLiteRepo) DeleteByPost(postID uint32) (int, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM comments WHERE post_id = ?`, postID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`DELETE FROM comment_ids WHERE post_id = ?`, postID)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	log.Printf("Deleted %v comments of post %v", n, postID)
+	return int(n), nil
+}
+
+func (cr *CommentsSQLiteRepo) Trash(postID, commentID uint32, by *user.User) (*Comment, error) {
+	_, err := cr.db.Exec(`UPDATE comments SET deleted_at = ?, deleted_by = ? WHERE post_id = ? AND id = ? AND deleted_at = ''`,
+		time.Now().Format(time.RFC3339), by.ID, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	comm, err := cr.read(postID, commentID)
+	if err != nil {
+		log.Printf("ERROR: Comment Trash, can't find post %v, id %v", postID, commentID)
+		return nil, err
+	}
+	log.Printf("Trashed post comment: postID %v, commID %v", postID, commentID)
+	return comm, nil
+}
+
+func (cr *CommentsSQLiteRepo) Restore(postID, commentID uint32) (*Comment, error) {
+	_, err := cr.db.Exec(`UPDATE comments SET deleted_at = '', deleted_by = NULL WHERE post_id = ? AND id = ?`,
+		postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	comm, err := cr.read(postID, commentID)
+	if err != nil {
+		log.Printf("ERROR: Comment Restore, can't find post %v, id %v", postID, commentID)
+		return nil, err
+	}
+	log.Printf("Restored post comment: postID %v, commID %v", postID, commentID)
+	return comm, nil
+}
+
+func (cr *CommentsSQLiteRepo) ReadTrash() ([]*Comment, error) {
+	log.Printf("ReadTrash comments")
+	return cr.query(selectComments + ` WHERE c.deleted_at != '' ORDER BY c.post_id, c.id`)
+}
+
+// Update replaces the body of the comment, the first edit also stores the
+// original version so that revisions always start with v1.
+func (cr *CommentsSQLiteRepo) Update(postID, commentID uint32, body string, editor *user.User) (*Comment, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM comment_revisions WHERE post_id = ? AND comment_id = ?`,
+		postID, commentID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		res, err := tx.Exec(`INSERT INTO comment_revisions (post_id, comment_id, version, body, created, editor_id)
+			SELECT post_id, id, 1, body, created, author_id FROM comments WHERE post_id = ? AND id = ?`,
+			postID, commentID)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			log.Printf("ERROR: Comment Update, can't find post %v, id %v", postID, commentID)
+			return nil, ErrNoComm
+		}
+		count = 1
+	}
+
+	edited := time.Now().Format(time.RFC3339)
+	_, err = tx.Exec(`INSERT INTO comment_revisions (post_id, comment_id, version, body, created, editor_id)
+		VALUES (?, ?, ?, ?, ?, ?)`, postID, commentID, count+1, body, edited, editor.ID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE comments SET body = ?, edited = ? WHERE post_id = ? AND id = ?`,
+		body, edited, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	log.Printf("Updated post comment: postID %v, commID %v", postID, commentID)
+	return cr.read(postID, commentID)
+}
+
+func (cr *CommentsSQLiteRepo) ReadRevisions(postID, commentID uint32) ([]*Revision, error) {
+	comm, err := cr.read(postID, commentID)
+	if err != nil {
+		log.Printf("ERROR: Comment ReadRevisions, can't find post %v, id %v", postID, commentID)
+		return nil, err
+	}
+	rows, err := cr.db.Query(`SELECT r.version, r.body, r.created, u.id, u.username
+		FROM comment_revisions r JOIN users u ON u.id = r.editor_id
+		WHERE r.post_id = ? AND r.comment_id = ? ORDER BY r.version`, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Revision, 0)
+	for rows.Next() {
+		r := &Revision{Author: &user.User{}}
+		if err = rows.Scan(&r.Version, &r.Body, &r.Created, &r.Author.ID, &r.Author.Username); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		res = append(res, firstRevision(comm))
+	}
+	return res, nil
+}
+
+func (cr *CommentsSQLiteRepo) UpVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return cr.vote(postID, commentID, u, UpVote)
+}
+
+func (cr *CommentsSQLiteRepo) DownVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return cr.vote(postID, commentID, u, DownVote)
+}
+
+func (cr *CommentsSQLiteRepo) UnVote(postID, commentID uint32, u *user.User) (*Comment, error) {
+	return cr.vote(postID, commentID, u, NoVote)
+}
+
+// vote stores the user's vote (NoVote removes it) and recalculates score
+// and upvote percentage of the comment in one transaction.
+func (cr *CommentsSQLiteRepo) vote(postID, commentID uint32, u *user.User, vote int) (*Comment, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM comments WHERE post_id = ? AND id = ?`, postID, commentID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		log.Printf("ERROR: Comment vote, can't find post %v, id %v", postID, commentID)
+		return nil, ErrNoComm
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if vote == NoVote {
+		_, err = tx.Exec(`DELETE FROM comment_votes WHERE post_id = ? AND comment_id = ? AND user_id = ?`,
+			postID, commentID, u.ID)
+	} else {
+		_, err = tx.Exec(`INSERT INTO comment_votes (post_id, comment_id, user_id, vote) VALUES (?, ?, ?, ?)
+			ON CONFLICT (post_id, comment_id, user_id) DO UPDATE SET vote = excluded.vote`,
+			postID, commentID, u.ID, vote)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	comm := &Comment{Votes: make([]*Vote, 0)}
+	rows, err := tx.Query(`SELECT user_id, vote FROM comment_votes WHERE post_id = ? AND comment_id = ?`,
+		postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		v := &Vote{}
+		if err = rows.Scan(&v.UserID, &v.Vote); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		comm.Votes = append(comm.Votes, v)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE comments SET score = ?, upvote_percentage = ? WHERE post_id = ? AND id = ?`,
+		SetScore(comm), UpVotePer(comm), postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	log.Printf("Voted %v for post comment: postID %v, commID %v", vote, postID, commentID)
+	return cr.read(postID, commentID)
+}
+
+func (cr *CommentsSQLiteRepo) read(postID, commentID uint32) (*Comment, error) {
+	res, err := cr.query(selectComments+` WHERE c.post_id = ? AND c.id = ?`, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, ErrNoComm
+	}
+	return res[0], nil
+}
+
+func (cr *CommentsSQLiteRepo) query(q string, args ...interface{}) ([]*Comment, error) {
+	rows, err := cr.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Comment, 0)
+	for rows.Next() {
+		comm, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, comm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err = cr.readVotes(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readVotes fills Votes of the comments with one query per post.
+func (cr *CommentsSQLiteRepo) readVotes(comments []*Comment) error {
+	byPost := make(map[uint32]map[uint32]*Comment)
+	for _, comm := range comments {
+		if byPost[comm.PostID] == nil {
+			byPost[comm.PostID] = make(map[uint32]*Comment)
+		}
+		byPost[comm.PostID][comm.ID] = comm
+	}
+
+	for postID, byID := range byPost {
+		rows, err := cr.db.Query(`SELECT comment_id, user_id, vote FROM comment_votes WHERE post_id = ? ORDER BY rowid`, postID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var commentID uint32
+			v := &Vote{}
+			if err = rows.Scan(&commentID, &v.UserID, &v.Vote); err != nil {
+				rows.Close()
+				return err
+			}
+			if comm := byID[commentID]; comm != nil {
+				comm.Votes = append(comm.Votes, v)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanComment(rows *sql.Rows) (*Comment, error) {
+	comm := &Comment{Author: &user.User{}, Votes: make([]*Vote, 0)}
+	var (
+		deletedByID   sql.NullInt64
+		deletedByName sql.NullString
+	)
+	err := rows.Scan(&comm.PostID, &comm.ID, &comm.Body, &comm.Created, &comm.Author.ID, &comm.Author.Username,
+		&comm.DeletedAt, &deletedByID, &deletedByName, &comm.Edited, &comm.ParentID,
+		&comm.Score, &comm.UpvotePercentage)
+	if err != nil {
+		return nil, err
+	}
+	if deletedByID.Valid {
+		comm.DeletedBy = &user.User{ID: uint32(deletedByID.Int64), Username: deletedByName.String}
+	}
+	return comm, nil
+}
@@ -0,0 +1,74 @@
+package comment
+
+import (
+	"errors"
+	"sort"
+)
+
+// comment orders for Sort, SortOld is the default
+const (
+	SortOld = "old"
+	SortNew = "new"
+	SortTop = "top"
+)
+
+var (
+	ErrBadSort = errors.New("unknown sort")
+)
+
+// Sort orders comments in place. Thread keeps this order among replies
+// to the same comment.
+func Sort(comments []*Comment, order string) error {
+	switch order {
+	case "", SortOld:
+		sort.SliceStable(comments, func(i, j int) bool {
+			return comments[i].ID < comments[j].ID
+		})
+	case SortNew:
+		sort.SliceStable(comments, func(i, j int) bool {
+			return comments[i].ID > comments[j].ID
+		})
+	case SortTop:
+		sort.SliceStable(comments, func(i, j int) bool {
+			if comments[i].Score != comments[j].Score {
+				return comments[i].Score > comments[j].Score
+			}
+			return comments[i].ID < comments[j].ID
+		})
+	default:
+		return ErrBadSort
+	}
+	return nil
+}
+
+// Thread orders comments of one post as a tree walked depth first: every
+// reply follows its parent, siblings keep their order. Replies to missing
+// comments are shown at the top level. The comments are copied, so Depth
+// can be set without touching the repo.
+func Thread(comments []*Comment) []*Comment {
+	known := make(map[uint32]bool, len(comments))
+	for _, elem := range comments {
+		known[elem.ID] = true
+	}
+	children := make(map[uint32][]*Comment)
+	for _, elem := range comments {
+		parent := elem.ParentID
+		if !known[parent] || parent == elem.ID {
+			parent = 0
+		}
+		children[parent] = append(children[parent], elem)
+	}
+
+	res := make([]*Comment, 0, len(comments))
+	var walk func(parent uint32, depth int)
+	walk = func(parent uint32, depth int) {
+		for _, elem := range children[parent] {
+			comm := *elem
+			comm.Depth = depth
+			res = append(res, &comm)
+			walk(elem.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+	return res
+}
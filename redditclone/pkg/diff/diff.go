@@ -0,0 +1,70 @@
+// Package diff compares two texts line by line.
+package diff
+
+import "strings"
+
+const (
+	Equal  = "="
+	Insert = "+"
+	Delete = "-"
+)
+
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the shortest edit script turning a into b, built from the
+// longest common subsequence of their lines.
+func Lines(a, b string) []*Line {
+	from := split(a)
+	to := split(b)
+
+	// lcs[i][j] is the LCS length of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	res := make([]*Line, 0, len(from)+len(to))
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			res = append(res, &Line{Op: Equal, Text: from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			res = append(res, &Line{Op: Delete, Text: from[i]})
+			i++
+		default:
+			res = append(res, &Line{Op: Insert, Text: to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		res = append(res, &Line{Op: Delete, Text: from[i]})
+	}
+	for ; j < len(to); j++ {
+		res = append(res, &Line{Op: Insert, Text: to[j]})
+	}
+	return res
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
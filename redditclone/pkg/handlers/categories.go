@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/category"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/session"
+	"fakereddit/redditclone/pkg/user"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// categoryName is the reddit rule for subreddit names
+var categoryName = regexp.MustCompile(`^[a-z0-9_]{3,21}$`)
+
+type CategoryHandler struct {
+	Categories category.CategoriesRepo
+	Sessions   session.Manager
+	// Types are the post types a category can allow
+	Types *posttype.Registry
+}
+
+type CategoryForm struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Rules       []string `json:"rules"`
+	PostTypes   []string `json:"postTypes"`
+	// Flairs are the labels posts of the category can choose from
+	Flairs []*category.Flair `json:"flairs"`
+}
+
+func (h *CategoryHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != JSONContentType {
+		JSONErrorBuilder(w, "unknown payload", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	data := &CategoryForm{}
+	err = json.Unmarshal(body, data)
+	if err != nil {
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	errs := make([]*DetailError, 0)
+	if !categoryName.MatchString(data.Name) {
+		errs = append(errs, &DetailError{Location: "body", Param: "name", Message: "must be 3-21 lowercase letters, digits or _"})
+	}
+	if strings.TrimSpace(data.Title) == "" {
+		errs = append(errs, &DetailError{Location: "body", Param: "title", Message: "is required"})
+	}
+	for _, elem := range data.PostTypes {
+		if _, ok := h.Types.Get(elem); !ok {
+			errs = append(errs, &DetailError{Location: "body", Param: "postTypes", Message: "unknown post type " + elem})
+		}
+	}
+	errs = append(errs, validFlairs(data.Flairs)...)
+	if len(errs) > 0 {
+		writeErrors(w, errs)
+		return
+	}
+
+	c := &category.Category{
+		Name:        data.Name,
+		Title:       data.Title,
+		Description: data.Description,
+		Creator:     &user.User{ID: sess.UserID, Username: sess.UserName},
+		Rules:       data.Rules,
+		PostTypes:   data.PostTypes,
+		Flairs:      data.Flairs,
+	}
+	err = h.Categories.Create(c)
+	if err == category.ErrAlreadyExist {
+		JSONErrorBuilder(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	h.write(w, c)
+}
+
+func (h *CategoryHandler) List(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Categories.List()
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	h.write(w, list)
+}
+
+func (h *CategoryHandler) Get(w http.ResponseWriter, r *http.Request) {
+	c, err := h.Categories.Get(strings.TrimPrefix(r.URL.Path, "/api/category/"))
+	if err == category.ErrNoCategory {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	h.write(w, c)
+}
+
+type SubscriptionsForm struct {
+	Subscriptions []string `json:"subscriptions"`
+}
+
+// Subscribe adds the category to the feed of the user, the answer is the
+// updated list of subscriptions.
+func (h *CategoryHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/category/"), "/subscribe")
+	h.subscription(w, r, name, h.Categories.Subscribe)
+}
+
+func (h *CategoryHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/category/"), "/unsubscribe")
+	h.subscription(w, r, name, h.Categories.Unsubscribe)
+}
+
+func (h *CategoryHandler) subscription(w http.ResponseWriter, r *http.Request, name string,
+	do func(string, *user.User) error) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	err = do(name, &user.User{ID: sess.UserID, Username: sess.UserName})
+	if err == category.ErrNoCategory {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	h.Subscriptions(w, r)
+}
+
+// Subscriptions lists the categories the user is subscribed to.
+func (h *CategoryHandler) Subscriptions(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	subs, err := h.Categories.Subscriptions(sess.UserID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	h.write(w, &SubscriptionsForm{Subscriptions: subs})
+}
+
+func (h *CategoryHandler) write(w http.ResponseWriter, data interface{}) {
+	res, err := json.Marshal(data)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
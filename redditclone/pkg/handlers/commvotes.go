@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/user"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (h *PostHandler) UpvoteComm(w http.ResponseWriter, r *http.Request) {
+	h.voteComm(w, r, h.CommentRepo.UpVote)
+}
+
+func (h *PostHandler) DownVoteComm(w http.ResponseWriter, r *http.Request) {
+	h.voteComm(w, r, h.CommentRepo.DownVote)
+}
+
+func (h *PostHandler) UnVoteComm(w http.ResponseWriter, r *http.Request) {
+	h.voteComm(w, r, h.CommentRepo.UnVote)
+}
+
+// voteComm handles /api/post/{POST_ID}/{COMMENT_ID}/{upvote,downvote,unvote}
+// and answers with the whole thread like the other comment methods.
+func (h *PostHandler) voteComm(w http.ResponseWriter, r *http.Request,
+	vote func(postID, commentID uint32, u *user.User) (*comment.Comment, error)) {
+	data := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/post/"), "/")
+
+	postID, err := strconv.Atoi(data[0])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+	commID, err := strconv.Atoi(data[1])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	comm, err := h.readComment(uint32(postID), uint32(commID))
+	if err == nil && comm.DeletedAt != "" {
+		err = comment.ErrNoComm
+	}
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	_, err = vote(uint32(postID), uint32(commID), &user.User{ID: sess.UserID, Username: sess.UserName})
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	h.writeThread(w, uint32(postID), sess.UserID)
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/category"
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/prefs"
+	"fakereddit/redditclone/pkg/session"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MarkForm changes content warnings of a post, missing fields are kept.
+type MarkForm struct {
+	NSFW    *bool `json:"nsfw"`
+	Spoiler *bool `json:"spoiler"`
+}
+
+// PrefsForm changes preferences, missing fields are kept.
+type PrefsForm struct {
+	NSFW    *string `json:"nsfw"`
+	Spoiler *string `json:"spoiler"`
+}
+
+// view is how the user of the request sees listings: posts the filter
+// doesn't allow are left out, the rest are blurred by the preferences.
+type view struct {
+	filter *mute.Filter
+	prefs  *prefs.Preferences
+	types  *posttype.Registry
+	// userID is who looks, 0 for guests
+	userID uint32
+}
+
+// Mark handles /api/post/{POST_ID}/mark, content warnings are set by the
+// author, admins and the creator of the category.
+func (h *PostHandler) Mark(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/post/"), "/mark"))
+	if err != nil {
+		JSONErrorBuilder(w, errInvalidPostID.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	data := &MarkForm{}
+	if err = json.Unmarshal(body, data); err != nil {
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	postByID, err := h.PostRepo.Read(uint32(postID))
+	if err == nil && postByID.DeletedAt != "" {
+		err = post.ErrNoPost
+	}
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ok, err := h.moderates(sess, postByID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	nsfw, spoiler := postByID.NSFW, postByID.Spoiler
+	if data.NSFW != nil {
+		nsfw = *data.NSFW
+	}
+	if data.Spoiler != nil {
+		spoiler = *data.Spoiler
+	}
+	marked, err := h.PostRepo.Mark(postByID.ID, nsfw, spoiler)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(h.Types.Render(marked, sess.UserID))
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+func (h *PostHandler) GetPrefs(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	p, err := h.Prefs.Get(sess.UserID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	writePrefs(w, p)
+}
+
+// EditPrefs sets how NSFW and spoiler posts are shown: "show", "blur" or
+// "hide".
+func (h *PostHandler) EditPrefs(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	data := &PrefsForm{}
+	if err = json.Unmarshal(body, data); err != nil {
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	errs := make([]*DetailError, 0)
+	if data.NSFW != nil && !prefs.Modes[*data.NSFW] {
+		errs = append(errs, &DetailError{Location: "body", Param: "nsfw", Message: "must be show, blur or hide"})
+	}
+	if data.Spoiler != nil && !prefs.Modes[*data.Spoiler] {
+		errs = append(errs, &DetailError{Location: "body", Param: "spoiler", Message: "must be show, blur or hide"})
+	}
+	if len(errs) > 0 {
+		writeErrors(w, errs)
+		return
+	}
+
+	p, err := h.Prefs.Get(sess.UserID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	if data.NSFW != nil {
+		p.NSFW = *data.NSFW
+	}
+	if data.Spoiler != nil {
+		p.Spoiler = *data.Spoiler
+	}
+	if err = h.Prefs.Set(sess.UserID, p); err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	writePrefs(w, p)
+}
+
+func writePrefs(w http.ResponseWriter, p *prefs.Preferences) {
+	res, err := json.Marshal(p)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// moderates tells if the user can set content warnings of the post.
+func (h *PostHandler) moderates(sess *session.Session, p *post.Post) (bool, error) {
+	if p.Author.ID == sess.UserID || h.Admins[sess.UserName] {
+		return true, nil
+	}
+	c, err := h.Categories.Get(p.Category)
+	if err == category.ErrNoCategory {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return c.Creator != nil && c.Creator.ID == sess.UserID, nil
+}
+
+// view loads the preferences of the user of the request, and the mutes
+// if withMutes. Anonymous requests get the default preferences, NSFW
+// posts are hidden from them.
+func (h *PostHandler) view(r *http.Request, withMutes bool) (*view, error) {
+	defaults := prefs.Defaults
+	v := &view{prefs: &defaults, types: h.Types}
+	sess, err := h.Sessions.Check(r)
+	if err == nil {
+		v.userID = sess.UserID
+		if v.prefs, err = h.Prefs.Get(sess.UserID); err != nil {
+			return nil, err
+		}
+		if withMutes {
+			if v.filter, err = mute.Load(h.Mutes, sess.UserID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	v.filter = v.filter.HideMarked(v.prefs.NSFW == prefs.Hide, v.prefs.Spoiler == prefs.Hide)
+	return v, nil
+}
+
+// apply leaves out the posts the user doesn't want to see and blurs the
+// rest, posts is not changed.
+func (v *view) apply(posts []*post.Post) []*post.Post {
+	return v.blur(v.filter.Apply(posts))
+}
+
+// blur renders copies of the posts, marking the ones the preferences blur.
+func (v *view) blur(posts []*post.Post) []*post.Post {
+	res := make([]*post.Post, len(posts))
+	for idx, elem := range posts {
+		res[idx] = v.blurPost(elem)
+	}
+	return res
+}
+
+func (v *view) blurPost(p *post.Post) *post.Post {
+	res := v.types.Render(p, v.userID)
+	res.Blur = v.prefs.Blurs(p.NSFW, p.Spoiler)
+	return res
+}
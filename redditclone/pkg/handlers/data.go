@@ -1,10 +1,18 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
+	"fakereddit/redditclone/pkg/cascade"
+	"fakereddit/redditclone/pkg/category"
 	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/paging"
 	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/prefs"
+	"fakereddit/redditclone/pkg/ranking"
+	"fakereddit/redditclone/pkg/saved"
+	"fakereddit/redditclone/pkg/search"
 	"fakereddit/redditclone/pkg/session"
 	"fakereddit/redditclone/pkg/user"
 	"io/ioutil"
@@ -12,19 +20,19 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	ToReplace   = `"data":`
-	TextReplace = `"text":`
-	URLReplace  = `"url":`
-
 	Success = "success"
 
+	DeletedTXT = "[deleted]"
+
 	JSONContentType = "application/json"
 )
 
 const (
+	ForbiddenTXT       = `forbidden`
 	UnexpectedErrorTXT = `something goes wrong`
 	MarshalErrorTXT    = `invalid data`
 	UnmarshalErrorTXT  = `invalid json`
@@ -33,25 +41,52 @@ const (
 type PostHandler struct {
 	PostRepo    post.PostsRepo
 	CommentRepo comment.CommentsRepo
-	Sessions    *session.SessionsManager
+	Categories  category.CategoriesRepo
+	UserRepo    user.UsersRepo
+	Saved       saved.SavedRepo
+	Mutes       mute.MutesRepo
+	Prefs       prefs.PrefsRepo
+	Sessions    session.Manager
+	Deleter     *cascade.Deleter
+	Admins      map[string]bool
+	// CommentEditWindow is how long comments can be edited, 0 means forever
+	CommentEditWindow time.Duration
+	// Snapshots freeze ranked listings for paging
+	Snapshots *paging.Snapshots
+	// SearchIndex is the full-text index of posts and comments
+	SearchIndex *search.Index
+	// Types are the kinds of posts, they check and fill the content
+	Types *posttype.Registry
 }
 
+// PostForm is what all posts have, the content is read by the post type
+// from the rest of the form.
 type PostForm struct {
 	Category string `json:"category"`
 	Title    string `json:"title"`
 	Type     string `json:"type"`
-	Text     string `json:"text"`
-	URL      string `json:"url"`
+	// Flair is optional, one of the flairs of the category
+	Flair   string   `json:"flair"`
+	Tags    []string `json:"tags"`
+	NSFW    bool     `json:"nsfw"`
+	Spoiler bool     `json:"spoiler"`
 }
 
 type CommForm struct {
 	Comment string `json:"comment"`
+	// Parent is the id of the comment to reply to
+	Parent uint32 `json:"parent"`
 }
 
 type ChangeForm struct {
 	Message string `json:"message"`
 }
 
+type DeleteForm struct {
+	Message string         `json:"message"`
+	Removed map[string]int `json:"removed"`
+}
+
 type ErrorMsg struct {
 	Errors []*DetailError `json:"errors"`
 }
@@ -62,12 +97,34 @@ type DetailError struct {
 	Param    string `json:"param"`    // "comment"
 }
 
-func (h *PostHandler) GetAll(w http.ResponseWriter, _ *http.Request) {
+func (h *PostHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	v, err := h.view(r, true)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	flair, tag := labels(r)
+	if paged(r) {
+		h.writePage(w, r, &post.Query{Flair: flair, Tag: tag}, h.PostRepo.ReadAll, v, true)
+		return
+	}
+
 	posts, err := h.PostRepo.ReadAll()
 	if err != nil {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
+	h.writeListing(w, r, v.apply(post.Labeled(posts, flair, tag)))
+}
+
+// writeListing sorts the posts by ?sort= and answers with them and their
+// comments.
+func (h *PostHandler) writeListing(w http.ResponseWriter, r *http.Request, posts []*post.Post) {
+	err := sortPosts(r, posts)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	comments, err := h.CommentRepo.List()
 	if err != nil {
 		JSONErrorBuilder(w, err.Error(), http.StatusInternalServerError)
@@ -75,7 +132,7 @@ func (h *PostHandler) GetAll(w http.ResponseWriter, _ *http.Request) {
 	}
 
 	for _, elem := range posts {
-		elem.Comments = comments[elem.ID]
+		elem.Comments = comment.Thread(visibleComments(comments[elem.ID]))
 	}
 
 	res, err := json.Marshal(posts)
@@ -83,7 +140,6 @@ func (h *PostHandler) GetAll(w http.ResponseWriter, _ *http.Request) {
 		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
 		return
 	}
-	res = Normalize(res, len(posts))
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -91,46 +147,95 @@ func (h *PostHandler) GetAll(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// NewPost takes a json PostForm, posts with a file come as a multipart
+// form (see readMultipartForm). The rest of the form goes to the type of
+// the post.
 func (h *PostHandler) NewPost(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != JSONContentType {
+	var (
+		data = &PostForm{}
+		in   = &posttype.Input{}
+		err  error
+	)
+	switch {
+	case isMultipart(r):
+		data, in, err = h.readMultipartForm(w, r)
+		if err == errTooBig {
+			writeErrors(w, []*DetailError{{Location: "body", Param: posttype.UploadField, Message: err.Error()}})
+			return
+		}
+		if err != nil {
+			JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case r.Header.Get("Content-Type") == JSONContentType:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(body, data)
+		if err == nil {
+			err = json.Unmarshal(body, &in.Fields)
+		}
+		if err != nil {
+			JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusInternalServerError)
+			return
+		}
+	default:
 		JSONErrorBuilder(w, "unknown payload", http.StatusBadRequest)
 		return
 	}
-	body, err := ioutil.ReadAll(r.Body)
+
+	defer r.Body.Close()
+
+	sess, err := h.Sessions.Check(r)
 	if err != nil {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
-	data := &PostForm{}
-	err = json.Unmarshal(body, data)
-	if err != nil {
-		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusInternalServerError)
+
+	c, err := h.Categories.Get(data.Category)
+	if err == category.ErrNoCategory {
+		writeErrors(w, []*DetailError{{Location: "body", Param: "category", Message: "unknown category"}})
 		return
 	}
-
-	defer r.Body.Close()
-
-	sess, err := h.Sessions.Check(r)
 	if err != nil {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
+	if !c.Allows(data.Type) {
+		writeErrors(w, []*DetailError{{Location: "body", Param: "type", Message: "is not allowed in " + c.Name}})
+		return
+	}
+	if data.Flair != "" && c.Flair(data.Flair) == nil {
+		writeErrors(w, []*DetailError{{Location: "body", Param: "flair", Message: "is not a flair of " + c.Name}})
+		return
+	}
+	tags, errs := validTags(data.Tags)
+	if len(errs) > 0 {
+		writeErrors(w, errs)
+		return
+	}
 
 	newPost := &post.Post{
 		Author:   &user.User{ID: sess.UserID, Username: sess.UserName},
 		Type:     data.Type,
 		Title:    data.Title,
 		Category: data.Category,
+		Flair:    data.Flair,
+		Tags:     tags,
+		NSFW:     data.NSFW,
+		Spoiler:  data.Spoiler,
 	}
-
-	if data.Type == "text" {
-		newPost.Data = data.Text
-	} else if data.Type == "link" {
-		newPost.Data = data.URL
+	typeErrs, err := h.Types.Build(in, newPost)
+	if !h.typeErrors(w, r, typeErrs, err) {
+		return
 	}
+	postType, _ := h.Types.Get(newPost.Type)
 
 	ID, err := h.PostRepo.Create(newPost)
 	if err != nil {
+		postType.Discard(newPost)
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
@@ -140,15 +245,14 @@ func (h *PostHandler) NewPost(w http.ResponseWriter, r *http.Request) {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
+	postType.Created(postBD)
 
-	res, err := json.Marshal(postBD)
+	res, err := json.Marshal(h.Types.Render(postBD, sess.UserID))
 	if err != nil {
 		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
 		return
 	}
 
-	res = Normalize(res, 1)
-
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -163,8 +267,47 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ok, err := h.PostRepo.Delete(uint32(postID))
-	if !ok || err != nil {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	postByID, err := h.PostRepo.Read(uint32(postID))
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if postByID.Author.ID != sess.UserID && !h.isAdmin(sess) {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	// admins can skip the trash
+	if r.URL.Query().Get("purge") != "" {
+		if !h.isAdmin(sess) {
+			JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+			return
+		}
+		report, inErr := h.Deleter.Delete(uint32(postID))
+		if inErr != nil {
+			JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+			return
+		}
+		res, inErr := json.Marshal(DeleteForm{Message: Success, Removed: report.Removed})
+		if inErr != nil {
+			JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+			return
+		}
+		_, inErr = w.Write(res)
+		if inErr != nil {
+			log.Printf("critical error, %v", inErr.Error())
+		}
+		return
+	}
+
+	_, err = h.PostRepo.Trash(uint32(postID), &user.User{ID: sess.UserID, Username: sess.UserName})
+	if err != nil {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
@@ -196,24 +339,33 @@ func (h *PostHandler) DeleteComm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ok, err := h.CommentRepo.Delete(uint32(postID), uint32(commID))
-	if !ok || err != nil {
-		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	postByID, err := h.PostRepo.Read(uint32(postID))
+	comm, err := h.readComment(uint32(postID), uint32(commID))
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if comm.Author.ID != sess.UserID && !h.isAdmin(sess) {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	_, err = h.CommentRepo.Trash(uint32(postID), uint32(commID), &user.User{ID: sess.UserID, Username: sess.UserName})
 	if err != nil {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
 
-	comments, err := h.CommentRepo.ReadAll(uint32(postID))
+	postByID, err := h.thread(uint32(postID), "", sess.UserID)
 	if err != nil {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
-	postByID.Comments = comments
 
 	res, err := json.Marshal(postByID)
 	if err != nil {
@@ -221,8 +373,6 @@ func (h *PostHandler) DeleteComm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res = Normalize(res, 1)
-
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -279,9 +429,39 @@ func (h *PostHandler) NewComm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// a comment to a deleted post would never be cleaned up, the lock keeps
+	// the post from being deleted until the comment is stored
+	unlock := h.Deleter.Lock(uint32(postID))
+	defer unlock()
+	postByID, err := h.PostRepo.Read(uint32(postID))
+	if err == post.ErrNoPost {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	if postByID.DeletedAt != "" {
+		JSONErrorBuilder(w, post.ErrNoPost.Error(), http.StatusNotFound)
+		return
+	}
+
+	if data.Parent != 0 {
+		parent, inErr := h.readComment(uint32(postID), data.Parent)
+		if inErr == nil && parent.DeletedAt != "" {
+			inErr = comment.ErrNoComm
+		}
+		if inErr != nil {
+			writeErrors(w, []*DetailError{{Location: "body", Param: "parent", Message: inErr.Error()}})
+			return
+		}
+	}
+
 	_, err = h.CommentRepo.Create(&comment.Comment{
-		Body:   data.Comment,
-		PostID: uint32(postID),
+		Body:     data.Comment,
+		PostID:   uint32(postID),
+		ParentID: data.Parent,
 		Author: &user.User{
 			ID:       sess.UserID,
 			Username: sess.UserName,
@@ -293,27 +473,18 @@ func (h *PostHandler) NewComm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	postByID, err := h.PostRepo.Read(uint32(postID))
+	postByID, err = h.thread(uint32(postID), "", sess.UserID)
 	if err != nil {
 		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
 
-	comments, err := h.CommentRepo.ReadAll(uint32(postID))
-	if err != nil {
-		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
-		return
-	}
-	postByID.Comments = comments
-
 	res, err := json.Marshal(postByID)
 	if err != nil {
 		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
 		return
 	}
 
-	res = Normalize(res, 1)
-
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -327,13 +498,34 @@ func (h *PostHandler) Get(w http.ResponseWriter, r *http.Request) {
 		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	postByID, err := h.PostRepo.Read(uint32(postID))
+	_, err = h.PostRepo.IncViews(uint32(postID))
+	if err == post.ErrNoPost {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	// a post opened by link is shown even if listings hide it, blurred
+	v, err := h.view(r, false)
 	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	postByID, err := h.thread(uint32(postID), r.URL.Query().Get("sort"), v.userID)
+	if err == comment.ErrBadSort {
 		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
 
-	postByID.Views++
+	postByID.Blur = v.prefs.Hides(postByID.NSFW, postByID.Spoiler) || v.prefs.Blurs(postByID.NSFW, postByID.Spoiler)
 
 	res, err := json.Marshal(postByID)
 	if err != nil {
@@ -341,8 +533,6 @@ func (h *PostHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res = Normalize(res, 1)
-
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -352,12 +542,29 @@ func (h *PostHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostHandler) GetByCategory(w http.ResponseWriter, r *http.Request) {
 	categoryName := strings.TrimPrefix(r.URL.Path, "/api/posts/")
+	v, err := h.view(r, true)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	flair, tag := labels(r)
+	if paged(r) {
+		h.writePage(w, r, &post.Query{Category: categoryName, Flair: flair, Tag: tag}, func() ([]*post.Post, error) {
+			return h.PostRepo.ReadCategory(categoryName)
+		}, v, false)
+		return
+	}
 
 	categoryPosts, err := h.PostRepo.ReadCategory(categoryName)
 	if err != nil {
 		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	categoryPosts = v.apply(post.Labeled(categoryPosts, flair, tag))
+	if err = sortPosts(r, categoryPosts); err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	res, err := json.Marshal(categoryPosts)
 	if err != nil {
@@ -365,8 +572,6 @@ func (h *PostHandler) GetByCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res = Normalize(res, len(categoryPosts))
-
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -376,53 +581,36 @@ func (h *PostHandler) GetByCategory(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostHandler) GetByUser(w http.ResponseWriter, r *http.Request) {
 	login := strings.TrimPrefix(r.URL.Path, "/api/user/")
-
-	userPosts, err := h.PostRepo.ReadUser(login)
-	if err != nil {
-		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	res, err := json.Marshal(userPosts)
+	v, err := h.view(r, false)
 	if err != nil {
-		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
-
-	res = Normalize(res, len(userPosts))
-
-	_, err = w.Write(res)
-	if err != nil {
-		log.Printf("critical error, %v", err.Error())
+	flair, tag := labels(r)
+	if paged(r) {
+		h.writePage(w, r, &post.Query{Author: login, Flair: flair, Tag: tag}, func() ([]*post.Post, error) {
+			return h.PostRepo.ReadUser(login)
+		}, v, false)
 		return
 	}
-}
-
-func (h *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
-	data := strings.TrimPrefix(r.URL.Path, "/api/post/")
-	data = strings.TrimRight(data, "/upvote")
-	postID, err := strconv.Atoi(data)
 
+	userPosts, err := h.PostRepo.ReadUser(login)
 	if err != nil {
-		JSONErrorBuilder(w, err.Error(), http.StatusInternalServerError)
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	sess, err := h.Sessions.Check(r)
-	if err != nil {
-		JSONErrorBuilder(w, err.Error(), http.StatusInternalServerError)
+	userPosts = v.apply(post.Labeled(userPosts, flair, tag))
+	if err = sortPosts(r, userPosts); err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	upPost, err := h.PostRepo.UpVote(uint32(postID), &user.User{ID: sess.UserID, Username: sess.UserName})
 
-	res, err := json.Marshal(upPost)
+	res, err := json.Marshal(userPosts)
 	if err != nil {
 		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
 		return
 	}
 
-	res = Normalize(res, 1)
-
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -430,9 +618,24 @@ func (h *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
+	h.writeVote(w, r, "/upvote", h.PostRepo.UpVote)
+}
+
 func (h *PostHandler) DownVote(w http.ResponseWriter, r *http.Request) {
+	h.writeVote(w, r, "/downvote", h.PostRepo.DownVote)
+}
+
+func (h *PostHandler) UnVote(w http.ResponseWriter, r *http.Request) {
+	h.writeVote(w, r, "/unvote", h.PostRepo.UnVote)
+}
+
+// writeVote votes on the post of /api/post/{POST_ID}{suffix} with do and
+// answers with the post. Missing and trashed posts are 404.
+func (h *PostHandler) writeVote(w http.ResponseWriter, r *http.Request, suffix string,
+	do func(id uint32, u *user.User) (*post.Post, error)) {
 	data := strings.TrimPrefix(r.URL.Path, "/api/post/")
-	data = strings.TrimRight(data, "/downvote")
+	data = strings.TrimSuffix(data, suffix)
 	postID, err := strconv.Atoi(data)
 
 	if err != nil {
@@ -445,48 +648,31 @@ func (h *PostHandler) DownVote(w http.ResponseWriter, r *http.Request) {
 		JSONErrorBuilder(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	upPost, err := h.PostRepo.DownVote(uint32(postID), &user.User{ID: sess.UserID, Username: sess.UserName})
 
-	res, err := json.Marshal(upPost)
-	if err != nil {
-		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
-		return
+	postByID, err := h.PostRepo.Read(uint32(postID))
+	if err == nil && postByID.DeletedAt != "" {
+		err = post.ErrNoPost
 	}
-
-	res = Normalize(res, 1)
-
-	_, err = w.Write(res)
 	if err != nil {
-		log.Printf("critical error, %v", err.Error())
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
 		return
 	}
-}
-
-func (h *PostHandler) UnVote(w http.ResponseWriter, r *http.Request) {
-	data := strings.TrimPrefix(r.URL.Path, "/api/post/")
-	data = strings.TrimRight(data, "/unvote")
-	postID, err := strconv.Atoi(data)
-
-	if err != nil {
-		JSONErrorBuilder(w, err.Error(), http.StatusInternalServerError)
+	votedPost, err := do(uint32(postID), &user.User{ID: sess.UserID, Username: sess.UserName})
+	if err == post.ErrNoPost {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
 		return
 	}
-
-	sess, err := h.Sessions.Check(r)
 	if err != nil {
-		JSONErrorBuilder(w, err.Error(), http.StatusInternalServerError)
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
 		return
 	}
-	upPost, err := h.PostRepo.UnVote(uint32(postID), &user.User{ID: sess.UserID, Username: sess.UserName})
 
-	res, err := json.Marshal(upPost)
+	res, err := json.Marshal(h.Types.Render(votedPost, sess.UserID))
 	if err != nil {
 		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
 		return
 	}
 
-	res = Normalize(res, 1)
-
 	_, err = w.Write(res)
 	if err != nil {
 		log.Printf("critical error, %v", err.Error())
@@ -494,15 +680,10 @@ func (h *PostHandler) UnVote(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Normalize(data []byte, l int) []byte {
-	indexFlag := 0
-	for i := 0; i < l; i++ {
-		indexFlag = bytes.Index(data[indexFlag:], []byte(`"type":"`)) + len([]byte(`"type":"`)) + indexFlag
-		if data[indexFlag] == 'l' {
-			data = bytes.Replace(data, []byte(ToReplace), []byte(URLReplace), 1)
-			continue
-		}
-		data = bytes.Replace(data, []byte(ToReplace), []byte(TextReplace), 1)
+func sortPosts(r *http.Request, posts []*post.Post) error {
+	name := r.URL.Query().Get("sort")
+	if name == "" {
+		return nil
 	}
-	return data
+	return ranking.Sort(posts, name, time.Now())
 }
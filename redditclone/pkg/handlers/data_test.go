@@ -0,0 +1,27 @@
+package handlers_test
+
+import (
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/handlers"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/session"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetMissingPost(t *testing.T) {
+	h := &handlers.PostHandler{
+		PostRepo:    post.NewPostsRepo(),
+		CommentRepo: comment.NewCommentsRepo(),
+		Sessions:    session.NewSessionsManager(),
+		Types:       posttype.NewRegistry(posttype.Text{}),
+	}
+	w := httptest.NewRecorder()
+	h.Get(w, httptest.NewRequest("GET", "/api/post/7", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), post.ErrNoPost.Error()) {
+		t.Fatalf("Get missing post: got %v %v, want %v", w.Code, w.Body.String(), http.StatusNotFound)
+	}
+}
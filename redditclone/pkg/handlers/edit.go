@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/diff"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/user"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EditForm is a partial update, fields left out stay as they are. The
+// content is changed by the post type from the rest of the form.
+type EditForm struct {
+	Title *string `json:"title"`
+}
+
+type RevisionForm struct {
+	Version int              `json:"version"`
+	Title   string           `json:"title"`
+	Text    *string          `json:"text,omitempty"`
+	URL     *string          `json:"url,omitempty"`
+	Created string           `json:"created"`
+	Author  *user.User       `json:"author"`
+	Changes *RevisionChanges `json:"changes,omitempty"`
+}
+
+// RevisionChanges is the diff against the previous version.
+type RevisionChanges struct {
+	Title []*diff.Line `json:"title"`
+	Body  []*diff.Line `json:"body"`
+}
+
+type CommRevisionForm struct {
+	*comment.Revision
+	Changes []*diff.Line `json:"changes,omitempty"`
+}
+
+// EditPost lets the author change the title of the post and its content,
+// as far as the type of the post allows.
+func (h *PostHandler) EditPost(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != JSONContentType {
+		JSONErrorBuilder(w, "unknown payload", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	data := &EditForm{}
+	in := &posttype.Input{}
+	err = json.Unmarshal(body, data)
+	if err == nil {
+		err = json.Unmarshal(body, &in.Fields)
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return
+	}
+
+	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/post/"))
+	if err != nil {
+		JSONErrorBuilder(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	postByID, err := h.PostRepo.Read(uint32(postID))
+	if err == nil && postByID.DeletedAt != "" {
+		err = post.ErrNoPost
+	}
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if postByID.Author.ID != sess.UserID {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	title := postByID.Title
+	errs := make([]*DetailError, 0)
+	if data.Title != nil {
+		title = *data.Title
+		if title == "" {
+			errs = append(errs, &DetailError{Location: "body", Param: "title", Message: "is required"})
+		}
+	}
+	text, typeErrs, err := h.Types.Edit(in, postByID)
+	if !h.typeErrors(w, r, nil, err) {
+		return
+	}
+	for _, elem := range typeErrs {
+		errs = append(errs, &DetailError{Location: "body", Param: elem.Param, Message: elem.Message})
+	}
+	if len(errs) != 0 {
+		writeErrors(w, errs)
+		return
+	}
+
+	if title != postByID.Title || text != postByID.Data {
+		_, err = h.PostRepo.Update(uint32(postID), title, text, &user.User{ID: sess.UserID, Username: sess.UserName})
+		if err != nil {
+			JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+			return
+		}
+	}
+	if text != postByID.Data {
+		postType, _ := h.Types.Get(postByID.Type)
+		if err = postType.Edited(uint32(postID), text); err != nil {
+			JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.writeThread(w, uint32(postID), sess.UserID)
+}
+
+// GetRevisions lists all versions of the post, each with a diff against
+// the one before it.
+func (h *PostHandler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	data := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/post/"), "/revisions")
+	postID, err := strconv.Atoi(data)
+	if err != nil {
+		JSONErrorBuilder(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	postByID, err := h.PostRepo.Read(uint32(postID))
+	if err == nil && postByID.DeletedAt != "" {
+		err = post.ErrNoPost
+	}
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	revisions, err := h.PostRepo.ReadRevisions(uint32(postID))
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	forms := make([]*RevisionForm, 0, len(revisions))
+	for idx, elem := range revisions {
+		form := &RevisionForm{
+			Version: elem.Version,
+			Title:   elem.Title,
+			Created: elem.Created,
+			Author:  elem.Author,
+		}
+		content := elem.Data
+		if !h.Types.HasText(postByID.Type) {
+			form.URL = &content
+		} else {
+			form.Text = &content
+		}
+		if idx > 0 {
+			prev := revisions[idx-1]
+			form.Changes = &RevisionChanges{
+				Title: diff.Lines(prev.Title, elem.Title),
+				Body:  diff.Lines(prev.Data, elem.Data),
+			}
+		}
+		forms = append(forms, form)
+	}
+
+	res, err := json.Marshal(forms)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// EditComm lets the author change the comment body, comments older than
+// CommentEditWindow are frozen.
+func (h *PostHandler) EditComm(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != JSONContentType {
+		JSONErrorBuilder(w, "unknown payload", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	data := &CommForm{}
+	err = json.Unmarshal(body, data)
+	if err != nil {
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/post/"), "/")
+	postID, err := strconv.Atoi(path[0])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+	commID, err := strconv.Atoi(path[1])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	comm, err := h.readComment(uint32(postID), uint32(commID))
+	if err == nil && comm.DeletedAt != "" {
+		err = comment.ErrNoComm
+	}
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if comm.Author.ID != sess.UserID {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	if data.Comment == "" {
+		writeErrors(w, []*DetailError{{Location: "body", Param: "comment", Message: "is required"}})
+		return
+	}
+	if !h.canEditComm(comm) {
+		writeErrors(w, []*DetailError{{Location: "body", Param: "comment", Message: "can't be changed any more"}})
+		return
+	}
+
+	if data.Comment != comm.Body {
+		_, err = h.CommentRepo.Update(uint32(postID), uint32(commID), data.Comment,
+			&user.User{ID: sess.UserID, Username: sess.UserName})
+		if err != nil {
+			JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.writeThread(w, uint32(postID), sess.UserID)
+}
+
+// GetCommRevisions shows the history of the comment, with the original
+// text, to its author and admins.
+func (h *PostHandler) GetCommRevisions(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/post/"), "/")
+	postID, err := strconv.Atoi(path[0])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+	commID, err := strconv.Atoi(path[1])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	comm, err := h.readComment(uint32(postID), uint32(commID))
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if comm.Author.ID != sess.UserID && !h.isAdmin(sess) {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	revisions, err := h.CommentRepo.ReadRevisions(uint32(postID), uint32(commID))
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	forms := make([]*CommRevisionForm, 0, len(revisions))
+	for idx, elem := range revisions {
+		form := &CommRevisionForm{Revision: elem}
+		if idx > 0 {
+			form.Changes = diff.Lines(revisions[idx-1].Body, elem.Body)
+		}
+		forms = append(forms, form)
+	}
+
+	res, err := json.Marshal(forms)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// canEditComm is always true when CommentEditWindow is not set.
+func (h *PostHandler) canEditComm(comm *comment.Comment) bool {
+	if h.CommentEditWindow == 0 {
+		return true
+	}
+	created, err := time.Parse(time.RFC3339, comm.Created)
+	if err != nil {
+		return false
+	}
+	return time.Since(created) < h.CommentEditWindow
+}
+
+// writeErrors answers with validation errors in the same format as NewComm.
+func writeErrors(w http.ResponseWriter, errs []*DetailError) {
+	res, err := json.Marshal(&ErrorMsg{Errors: errs})
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, string(res), http.StatusUnprocessableEntity)
+}
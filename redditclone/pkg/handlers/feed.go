@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/paging"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/ranking"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// TimelineItem is a post or a comment of a followed user, Kind tells
+// which one is set.
+type TimelineItem struct {
+	Kind    string           `json:"kind"`
+	Created string           `json:"created"`
+	Post    *post.Post       `json:"post,omitempty"`
+	Comment *comment.Comment `json:"comment,omitempty"`
+	// PostID is the post of the comment
+	PostID uint32 `json:"postID,omitempty"`
+	key    string
+}
+
+// TimelineForm is one page of the timeline, Next goes to ?after= for the
+// next page.
+type TimelineForm struct {
+	Items []*TimelineItem `json:"items"`
+	Next  string          `json:"next,omitempty"`
+}
+
+// Feed is the home page of the user: posts of the subscribed categories,
+// ordered like the global listing, without hidden and muted posts.
+// Anonymous users and users without subscriptions get the global listing.
+func (h *PostHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		h.GetAll(w, r)
+		return
+	}
+	subs, err := h.Categories.Subscriptions(sess.UserID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	if len(subs) == 0 {
+		h.GetAll(w, r)
+		return
+	}
+	v, err := h.view(r, true)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	flair, tag := labels(r)
+	list := func() ([]*post.Post, error) {
+		res := make([]*post.Post, 0)
+		for _, name := range subs {
+			posts, err := h.PostRepo.ReadCategory(name)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, posts...)
+		}
+		// merged categories are ordered by score unless ?sort= asks otherwise
+		return res, ranking.Sort(res, "top", time.Now())
+	}
+	if paged(r) {
+		h.writePage(w, r, &post.Query{Categories: subs, Flair: flair, Tag: tag}, list, v, true)
+		return
+	}
+
+	posts, err := list()
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	h.writeListing(w, r, v.apply(post.Labeled(posts, flair, tag)))
+}
+
+// FollowingFeed is the timeline of posts and comments of the users the
+// user follows, newest first, by pages of ?limit=.
+func (h *PostHandler) FollowingFeed(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	limit, err := pageLimit(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var cursor *paging.Cursor
+	if r.URL.Query().Get("after") != "" {
+		cursor, err = paging.Decode(r.URL.Query().Get("after"))
+		if err == nil && cursor.Key == "" {
+			err = paging.ErrBadCursor
+		}
+		if err != nil {
+			JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	v, err := h.view(r, true)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	items, err := h.timeline(sess.UserName, v)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	page := &TimelineForm{Items: make([]*TimelineItem, 0, limit)}
+	for _, item := range items {
+		if cursor != nil && item.key >= cursor.Key {
+			continue
+		}
+		if len(page.Items) == limit {
+			next := &paging.Cursor{Key: page.Items[limit-1].key}
+			page.Next = next.Encode()
+			break
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	res, err := json.Marshal(page)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// timeline collects visible posts and comments of the users login follows,
+// newest first. Items created in the same second are ordered by ids.
+// Posts left out by the view are left out with their comments.
+func (h *PostHandler) timeline(login string, v *view) ([]*TimelineItem, error) {
+	following, err := h.UserRepo.Following(login)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*TimelineItem, 0)
+	// visible caches the view's decision for the posts under comments
+	visible := make(map[uint32]bool)
+	for _, u := range following {
+		posts, err := h.PostRepo.ReadUser(u.Username)
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range posts {
+			visible[elem.ID] = v.filter.Allows(elem)
+			if !visible[elem.ID] {
+				continue
+			}
+			key, err := timelineKey(elem.Created, elem.ID, 0)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, &TimelineItem{
+				Kind:    "post",
+				Created: elem.Created,
+				Post:    v.blurPost(elem),
+				key:     key,
+			})
+		}
+
+		if v.filter.MutesAuthor(u.Username) {
+			continue
+		}
+		comments, err := h.CommentRepo.ReadUser(u.Username)
+		if err != nil {
+			return nil, err
+		}
+		for _, comm := range comments {
+			shown, ok := visible[comm.PostID]
+			if !ok {
+				p, err := h.PostRepo.Read(comm.PostID)
+				if err != nil && err != post.ErrNoPost {
+					return nil, err
+				}
+				shown = err == nil && p.DeletedAt == "" && v.filter.Allows(p)
+				visible[comm.PostID] = shown
+			}
+			if !shown {
+				continue
+			}
+			key, err := timelineKey(comm.Created, comm.PostID, comm.ID)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, &TimelineItem{
+				Kind:    "comment",
+				Created: comm.Created,
+				Comment: comm,
+				PostID:  comm.PostID,
+				key:     key,
+			})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].key > items[j].key })
+	return items, nil
+}
+
+// timelineKey orders items by the UTC second they were created in, the
+// created strings keep the offset of the server and don't sort as text.
+func timelineKey(created string, postID, commentID uint32) (string, error) {
+	at, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d/%010d/%010d", at.UTC().Unix(), postID, commentID), nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/user"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Follow subscribes the user to posts and comments of USER_LOGIN, the
+// answer is the updated list of followers of USER_LOGIN.
+func (h *UserHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/follow")
+	h.follow(w, r, login, h.UserRepo.Follow)
+}
+
+func (h *UserHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
+	login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/unfollow")
+	h.follow(w, r, login, h.UserRepo.Unfollow)
+}
+
+func (h *UserHandler) follow(w http.ResponseWriter, r *http.Request, login string,
+	do func(*user.User, string) error) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	err = do(&user.User{ID: sess.UserID, Username: sess.UserName}, login)
+	if err == user.ErrNoUser {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == user.ErrSelfFollow {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	h.writeUsers(w, login, h.UserRepo.Followers)
+}
+
+func (h *UserHandler) Followers(w http.ResponseWriter, r *http.Request) {
+	login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/followers")
+	h.writeUsers(w, login, h.UserRepo.Followers)
+}
+
+func (h *UserHandler) Following(w http.ResponseWriter, r *http.Request) {
+	login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/following")
+	h.writeUsers(w, login, h.UserRepo.Following)
+}
+
+func (h *UserHandler) writeUsers(w http.ResponseWriter, login string, list func(string) ([]*user.User, error)) {
+	users, err := list(login)
+	if err == user.ErrNoUser {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(users)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/category"
+	"fakereddit/redditclone/pkg/post"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTags     = 5
+	maxFlairs   = 20
+	maxFlairLen = 30
+)
+
+var (
+	// tagPattern allows letters of any alphabet, digits, _ and -
+	tagPattern   = regexp.MustCompile(`^[\p{L}\p{N}_-]{1,30}$`)
+	colorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+)
+
+// GetByTag handles /api/tags/{TAG}: posts of all categories with the tag,
+// ?flair= works here too.
+func (h *PostHandler) GetByTag(w http.ResponseWriter, r *http.Request) {
+	tag := normalizeTag(strings.TrimPrefix(r.URL.Path, "/api/tags/"))
+	flair, _ := labels(r)
+	v, err := h.view(r, true)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	if paged(r) {
+		h.writePage(w, r, &post.Query{Tag: tag, Flair: flair}, func() ([]*post.Post, error) {
+			return h.PostRepo.ReadTag(tag)
+		}, v, false)
+		return
+	}
+
+	tagPosts, err := h.PostRepo.ReadTag(tag)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	tagPosts = v.apply(post.Labeled(tagPosts, flair, ""))
+	if err = sortPosts(r, tagPosts); err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := json.Marshal(tagPosts)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// labels are ?flair= and ?tag= of a listing, empty when not asked for.
+func labels(r *http.Request) (string, string) {
+	query := r.URL.Query()
+	return strings.TrimSpace(query.Get("flair")), normalizeTag(query.Get("tag"))
+}
+
+// normalizeTag makes "#Go" and "go" the same tag.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// validTags normalizes the tags of a new post and drops repeated ones.
+func validTags(tags []string) ([]string, []*DetailError) {
+	if len(tags) > maxTags {
+		return nil, []*DetailError{{Location: "body", Param: "tags", Message: "no more than 5 tags"}}
+	}
+	var (
+		res  []string
+		errs []*DetailError
+		seen = make(map[string]bool, len(tags))
+	)
+	for _, elem := range tags {
+		tag := normalizeTag(elem)
+		if !tagPattern.MatchString(tag) {
+			errs = append(errs, &DetailError{Location: "body", Param: "tags",
+				Message: "invalid tag '" + elem + "', use up to 30 letters, digits, _ or -"})
+			continue
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			res = append(res, tag)
+		}
+	}
+	return res, errs
+}
+
+// validFlairs checks the flairs of a new category, colors are brought to
+// lower case.
+func validFlairs(flairs []*category.Flair) []*DetailError {
+	if len(flairs) > maxFlairs {
+		return []*DetailError{{Location: "body", Param: "flairs", Message: "no more than 20 flairs"}}
+	}
+	errs := make([]*DetailError, 0)
+	seen := make(map[string]bool, len(flairs))
+	for _, elem := range flairs {
+		if elem == nil {
+			errs = append(errs, &DetailError{Location: "body", Param: "flairs", Message: "flair is required"})
+			continue
+		}
+		elem.Name = strings.TrimSpace(elem.Name)
+		elem.Color = strings.ToLower(elem.Color)
+		switch {
+		case elem.Name == "" || utf8.RuneCountInString(elem.Name) > maxFlairLen:
+			errs = append(errs, &DetailError{Location: "body", Param: "flairs", Message: "flair name must be 1-30 characters"})
+		case seen[elem.Name]:
+			errs = append(errs, &DetailError{Location: "body", Param: "flairs", Message: "repeated flair " + elem.Name})
+		case !colorPattern.MatchString(elem.Color):
+			errs = append(errs, &DetailError{Location: "body", Param: "flairs", Message: "color must be #rrggbb"})
+		}
+		seen[elem.Name] = true
+	}
+	return errs
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/post"
+	"net/http"
+)
+
+const DuplicateTXT = "already submitted"
+
+// DuplicateForm is the answer to a link which is already in the category,
+// the client shows the posts and can send it again with "resubmit": true.
+type DuplicateForm struct {
+	Message string       `json:"message"`
+	Posts   []*post.Post `json:"posts"`
+}
+
+func (h *PostHandler) writeDuplicates(w http.ResponseWriter, r *http.Request, posts []*post.Post) {
+	v, err := h.view(r, false)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	posts = v.blur(posts)
+
+	res, err := json.Marshal(&DuplicateForm{Message: DuplicateTXT, Posts: posts})
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, string(res), http.StatusConflict)
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/paging"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/ranking"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var errInvalidLimit = errors.New("invalid limit")
+
+// PageForm is the paged listing, Next is the cursor for ?after= of the
+// next page, empty on the last page.
+type PageForm struct {
+	Posts []*post.Post `json:"posts"`
+	Next  string       `json:"next,omitempty"`
+}
+
+// paged tells if a listing is asked for by pages, without ?limit= and
+// ?after= listings stay plain arrays.
+func paged(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Get("limit") != "" || query.Get("after") != ""
+}
+
+// writePage answers with one page of a listing. ?sort=new pages by post
+// id in the repo, other orders are frozen into a snapshot of the whole
+// listing read by list, so votes can't move posts between pages. Posts
+// without the flair and tag of q or left out by the view are skipped,
+// pages stay full. Cursors only work for the listing which made them.
+func (h *PostHandler) writePage(w http.ResponseWriter, r *http.Request, q *post.Query,
+	list func() ([]*post.Post, error), v *view, withComments bool) {
+	query := r.URL.Query()
+
+	var (
+		cursor *paging.Cursor
+		err    error
+	)
+	q.Limit, err = pageLimit(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Get("after") != "" {
+		cursor, err = paging.Decode(query.Get("after"))
+		if err != nil {
+			JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	page := &PageForm{}
+	listing := listingKey(r)
+	if query.Get("sort") == "new" {
+		page.Posts, page.Next, err = h.pageByID(q, listing, cursor, v.filter)
+	} else {
+		page.Posts, page.Next, err = h.pageBySnapshot(r, q, listing, cursor, list, v.filter)
+	}
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch err {
+		case paging.ErrBadCursor, paging.ErrExpired, paging.ErrOtherListing, ranking.ErrUnknown:
+			code = http.StatusBadRequest
+		}
+		JSONErrorBuilder(w, err.Error(), code)
+		return
+	}
+	page.Posts = v.blur(page.Posts)
+
+	if withComments {
+		for idx, elem := range page.Posts {
+			comments, inErr := h.CommentRepo.ReadAll(elem.ID)
+			if inErr != nil {
+				JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+				return
+			}
+			withComm := *elem
+			withComm.Comments = comment.Thread(visibleComments(comments))
+			page.Posts[idx] = &withComm
+		}
+	}
+
+	res, err := json.Marshal(page)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// pageLimit is ?limit=, paging.DefaultLimit without it and no more than
+// paging.MaxLimit.
+func pageLimit(r *http.Request) (int, error) {
+	param := r.URL.Query().Get("limit")
+	if param == "" {
+		return paging.DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(param)
+	if err != nil || limit < 1 {
+		return 0, errInvalidLimit
+	}
+	if limit > paging.MaxLimit {
+		limit = paging.MaxLimit
+	}
+	return limit, nil
+}
+
+// listingKey tells listings apart: the path names the listing, the sort
+// and the labels filter it.
+func listingKey(r *http.Request) string {
+	query := r.URL.Query()
+	key := url.Values{"sort": {query.Get("sort")}, "flair": {query.Get("flair")}, "tag": {query.Get("tag")}}
+	sum := sha256.Sum256([]byte(r.URL.Path + "?" + key.Encode()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (h *PostHandler) pageByID(q *post.Query, listing string, cursor *paging.Cursor,
+	filter *mute.Filter) ([]*post.Post, string, error) {
+	if cursor != nil {
+		if cursor.After == 0 {
+			return nil, "", paging.ErrBadCursor
+		}
+		if cursor.Listing != listing {
+			return nil, "", paging.ErrOtherListing
+		}
+		q.After = cursor.After
+	}
+
+	// one more post tells if there is a next page, filtered out posts are
+	// made up for by reading on
+	limit := q.Limit
+	q.Limit++
+	posts := make([]*post.Post, 0, q.Limit)
+	for len(posts) <= limit {
+		read, err := h.PostRepo.ReadPage(q)
+		if err != nil {
+			return nil, "", err
+		}
+		posts = append(posts, filter.Apply(read)...)
+		if len(read) < q.Limit {
+			break
+		}
+		q.After = read[len(read)-1].ID
+	}
+	if len(posts) <= limit {
+		return posts, "", nil
+	}
+	posts = posts[:limit]
+	next := &paging.Cursor{After: posts[limit-1].ID, Listing: listing}
+	return posts, next.Encode(), nil
+}
+
+// pageBySnapshot reads the whole listing on the first page, the order of
+// a ranked listing is only stable once it is frozen.
+func (h *PostHandler) pageBySnapshot(r *http.Request, q *post.Query, listing string, cursor *paging.Cursor,
+	list func() ([]*post.Post, error), filter *mute.Filter) ([]*post.Post, string, error) {
+	if cursor == nil {
+		posts, err := list()
+		if err != nil {
+			return nil, "", err
+		}
+		posts = filter.Apply(post.Labeled(posts, q.Flair, q.Tag))
+		if err = sortPosts(r, posts); err != nil {
+			return nil, "", err
+		}
+		if len(posts) <= q.Limit {
+			return posts, "", nil
+		}
+
+		ids := make([]uint32, 0, len(posts))
+		for _, elem := range posts {
+			ids = append(ids, elem.ID)
+		}
+		key, err := h.Snapshots.Save(listing, ids)
+		if err != nil {
+			return nil, "", err
+		}
+		next := &paging.Cursor{Snapshot: key, Offset: q.Limit, Listing: listing}
+		return posts[:q.Limit], next.Encode(), nil
+	}
+
+	if cursor.Snapshot == "" {
+		return nil, "", paging.ErrBadCursor
+	}
+	ids, err := h.Snapshots.Load(cursor.Snapshot, listing)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// posts deleted or muted since the snapshot are skipped
+	posts := make([]*post.Post, 0, q.Limit)
+	idx := cursor.Offset
+	for ; idx < len(ids) && len(posts) < q.Limit; idx++ {
+		elem, err := h.PostRepo.Read(ids[idx])
+		if err == post.ErrNoPost {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if elem.DeletedAt == "" && filter.Allows(elem) {
+			posts = append(posts, elem)
+		}
+	}
+	if idx >= len(ids) {
+		return posts, "", nil
+	}
+	next := &paging.Cursor{Snapshot: cursor.Snapshot, Offset: idx, Listing: listing}
+	return posts, next.Encode(), nil
+}
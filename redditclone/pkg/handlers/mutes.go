@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/category"
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/user"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxMuteLen = 100
+
+// MutesForm is everything the user doesn't want to see.
+type MutesForm struct {
+	Rules  []*mute.Rule `json:"rules"`
+	Hidden []uint32     `json:"hidden"`
+}
+
+// Hide handles /api/post/{POST_ID}/hide, the post disappears from
+// listings and feeds of the user.
+func (h *PostHandler) Hide(w http.ResponseWriter, r *http.Request) {
+	postID, _, err := savedPath(r.URL.Path, "/hide")
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err = h.checkVisible(postID, 0); err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err = h.Mutes.Hide(sess.UserID, postID); err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	writeSuccess(w)
+}
+
+func (h *PostHandler) Unhide(w http.ResponseWriter, r *http.Request) {
+	postID, _, err := savedPath(r.URL.Path, "/unhide")
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if _, err = h.Mutes.Unhide(sess.UserID, postID); err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	writeSuccess(w)
+}
+
+// GetMutes lists the mute rules and hidden posts of the user.
+func (h *PostHandler) GetMutes(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	form := &MutesForm{}
+	form.Rules, err = h.Mutes.Rules(sess.UserID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	form.Hidden, err = h.Mutes.Hidden(sess.UserID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(form)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// AddMute mutes a category, an author or a keyword in titles. Keywords
+// are case insensitive and match whole words.
+func (h *PostHandler) AddMute(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	rule := &mute.Rule{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	if err = json.Unmarshal(body, rule); err != nil {
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return
+	}
+
+	if errs := h.validateMute(rule); len(errs) > 0 {
+		writeErrors(w, errs)
+		return
+	}
+
+	if err = h.Mutes.AddRule(sess.UserID, rule); err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(rule)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// DeleteMute handles /api/mutes/{KIND}/{VALUE}.
+func (h *PostHandler) DeleteMute(w http.ResponseWriter, r *http.Request) {
+	data := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/mutes/"), "/", 2)
+	if len(data) != 2 || !mute.Kinds[data[0]] {
+		JSONErrorBuilder(w, "invalid mute rule", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	rule := &mute.Rule{Kind: data[0], Value: data[1]}
+	if rule.Kind == mute.KindKeyword {
+		rule.Value = strings.ToLower(rule.Value)
+	}
+	ok, err := h.Mutes.RemoveRule(sess.UserID, rule)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		JSONErrorBuilder(w, "no mute rule found", http.StatusNotFound)
+		return
+	}
+	writeSuccess(w)
+}
+
+// validateMute checks the rule and brings keywords to lower case.
+// Muted categories and authors must exist.
+func (h *PostHandler) validateMute(rule *mute.Rule) []*DetailError {
+	if !mute.Kinds[rule.Kind] {
+		return []*DetailError{{Location: "body", Param: "kind", Message: "is invalid"}}
+	}
+	rule.Value = strings.TrimSpace(rule.Value)
+	switch {
+	case rule.Value == "":
+		return []*DetailError{{Location: "body", Param: "value", Message: "is required"}}
+	case utf8.RuneCountInString(rule.Value) > maxMuteLen || strings.Contains(rule.Value, "/"):
+		return []*DetailError{{Location: "body", Param: "value", Message: "is invalid"}}
+	}
+
+	var err error
+	switch rule.Kind {
+	case mute.KindKeyword:
+		if !mute.IsKeyword(rule.Value) {
+			return []*DetailError{{Location: "body", Param: "value", Message: "has no words"}}
+		}
+		rule.Value = strings.ToLower(rule.Value)
+	case mute.KindCategory:
+		if _, err = h.Categories.Get(rule.Value); err == category.ErrNoCategory {
+			return []*DetailError{{Location: "body", Param: "value", Message: "unknown category"}}
+		}
+	case mute.KindAuthor:
+		if _, err = h.UserRepo.Get(rule.Value); err == user.ErrNoUser {
+			return []*DetailError{{Location: "body", Param: "value", Message: "unknown user"}}
+		}
+	}
+	if err != nil {
+		return []*DetailError{{Location: "body", Param: "value", Message: err.Error()}}
+	}
+	return nil
+}
+
+func writeSuccess(w http.ResponseWriter) {
+	res, err := json.Marshal(ChangeForm{Message: Success})
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
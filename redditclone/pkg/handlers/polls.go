@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"io/ioutil"
+	"net/http"
+)
+
+// PollVoteForm picks an option by its index in poll.options.
+type PollVoteForm struct {
+	Option *int `json:"option"`
+}
+
+// VotePoll handles /api/post/{POST_ID}/poll, voting again moves the
+// ballot to another option.
+func (h *PostHandler) VotePoll(w http.ResponseWriter, r *http.Request) {
+	postID, _, err := savedPath(r.URL.Path, "/poll")
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	data := &PollVoteForm{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	if err = json.Unmarshal(body, data); err != nil {
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return
+	}
+	if data.Option == nil {
+		writeErrors(w, []*DetailError{{Location: "body", Param: "option", Message: "is required"}})
+		return
+	}
+
+	p, err := h.PostRepo.Read(postID)
+	if err == nil && p.DeletedAt != "" {
+		err = post.ErrNoPost
+	}
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	postType, _ := h.Types.Get(p.Type)
+	voter, ok := postType.(posttype.Voter)
+	if !ok {
+		JSONErrorBuilder(w, posttype.ErrNotPoll.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = voter.Vote(postID, sess.UserID, *data.Option)
+	switch err {
+	case nil:
+	case posttype.ErrNotPoll:
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	case posttype.ErrPollClosed:
+		JSONErrorBuilder(w, err.Error(), http.StatusForbidden)
+		return
+	case posttype.ErrNoOption:
+		writeErrors(w, []*DetailError{{Location: "body", Param: "option", Message: err.Error()}})
+		return
+	default:
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	h.writeThread(w, postID, sess.UserID)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/saved"
+	"fakereddit/redditclone/pkg/session"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxFolderLen = 50
+
+var (
+	errInvalidPostID    = errors.New("invalid post id")
+	errInvalidCommentID = errors.New("invalid comment id")
+)
+
+// SaveForm is the optional body of save requests.
+type SaveForm struct {
+	Folder string `json:"folder"`
+}
+
+// SavedForm is one saved item, Post is set for saved posts, Comment with
+// PostID for saved comments.
+type SavedForm struct {
+	Folder  string           `json:"folder"`
+	Saved   string           `json:"saved"`
+	Post    *post.Post       `json:"post,omitempty"`
+	Comment *comment.Comment `json:"comment,omitempty"`
+	PostID  uint32           `json:"postID"`
+}
+
+// Save handles /api/post/{POST_ID}/save and
+// /api/post/{POST_ID}/{COMMENT_ID}/save.
+func (h *PostHandler) Save(w http.ResponseWriter, r *http.Request) {
+	postID, commID, err := savedPath(r.URL.Path, "/save")
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := &SaveForm{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, data); err != nil {
+			JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+			return
+		}
+	}
+	data.Folder = strings.TrimSpace(data.Folder)
+	if utf8.RuneCountInString(data.Folder) > maxFolderLen {
+		writeErrors(w, []*DetailError{{Location: "body", Param: "folder", Message: "is too long"}})
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err = h.checkVisible(postID, commID); err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	item := &saved.Item{UserID: sess.UserID, PostID: postID, CommentID: commID, Folder: data.Folder}
+	if err = h.Saved.Save(item); err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(item)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+func (h *PostHandler) Unsave(w http.ResponseWriter, r *http.Request) {
+	postID, commID, err := savedPath(r.URL.Path, "/unsave")
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if _, err = h.Saved.Unsave(sess.UserID, postID, commID); err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(ChangeForm{Message: Success})
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// GetSaved lists saved items of ?folder= or of all folders, only to the
+// owner.
+func (h *PostHandler) GetSaved(w http.ResponseWriter, r *http.Request) {
+	login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/saved")
+	sess, ok := h.savedOwner(w, r, login)
+	if !ok {
+		return
+	}
+
+	items, err := h.Saved.List(sess.UserID, r.URL.Query().Get("folder"))
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	// posts and comments deleted since are skipped
+	list := make([]*SavedForm, 0, len(items))
+	for _, item := range items {
+		elem := &SavedForm{Folder: item.Folder, Saved: item.Saved, PostID: item.PostID}
+		p, err := h.PostRepo.Read(item.PostID)
+		if err != nil || p.DeletedAt != "" {
+			continue
+		}
+		if item.CommentID == 0 {
+			elem.Post = h.Types.Render(p, sess.UserID)
+		} else {
+			elem.Comment, err = h.readComment(item.PostID, item.CommentID)
+			if err != nil || elem.Comment.DeletedAt != "" {
+				continue
+			}
+		}
+		list = append(list, elem)
+	}
+
+	res, err := json.Marshal(list)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+func (h *PostHandler) GetSavedFolders(w http.ResponseWriter, r *http.Request) {
+	login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/saved/folders")
+	sess, ok := h.savedOwner(w, r, login)
+	if !ok {
+		return
+	}
+
+	folders, err := h.Saved.Folders(sess.UserID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(folders)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// savedOwner lets only the owner see saved items, admins are forbidden
+// too.
+func (h *PostHandler) savedOwner(w http.ResponseWriter, r *http.Request, login string) (*session.Session, bool) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	if sess.UserName != login {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return nil, false
+	}
+	return sess, true
+}
+
+// checkVisible fails for trashed or missing posts and comments, commID is
+// 0 for the post itself.
+func (h *PostHandler) checkVisible(postID, commID uint32) error {
+	p, err := h.PostRepo.Read(postID)
+	if err == nil && p.DeletedAt != "" {
+		err = post.ErrNoPost
+	}
+	if err != nil || commID == 0 {
+		return err
+	}
+	comm, err := h.readComment(postID, commID)
+	if err == nil && comm.DeletedAt != "" {
+		err = comment.ErrNoComm
+	}
+	return err
+}
+
+// savedPath parses /api/post/{POST_ID}[/{COMMENT_ID}]{suffix}.
+func savedPath(path, suffix string) (uint32, uint32, error) {
+	data := strings.Split(strings.TrimSuffix(strings.TrimPrefix(path, "/api/post/"), suffix), "/")
+	postID, err := strconv.Atoi(data[0])
+	if err != nil {
+		return 0, 0, errInvalidPostID
+	}
+	if len(data) == 1 {
+		return uint32(postID), 0, nil
+	}
+	commID, err := strconv.Atoi(data[1])
+	if err != nil {
+		return 0, 0, errInvalidCommentID
+	}
+	return uint32(postID), uint32(commID), nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/search"
+	"log"
+	"net/http"
+)
+
+// SearchForm is one search result, Snippet has the matched words wrapped
+// in <mark>.
+type SearchForm struct {
+	Post    *post.Post `json:"post"`
+	Rank    float64    `json:"rank"`
+	Snippet string     `json:"snippet"`
+}
+
+// Search takes a query in the search language, see search.Parse.
+// ?category= and ?author= override the same fields of the query.
+func (h *PostHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("q") == "" {
+		writeErrors(w, []*DetailError{{Location: "query", Param: "q", Message: "is required"}})
+		return
+	}
+	expr, err := search.Parse(query.Get("q"), h.Types)
+	if err != nil {
+		errs := make([]*DetailError, 0)
+		for _, elem := range err.(search.SyntaxErrors) {
+			errs = append(errs, &DetailError{Location: "query", Param: "q", Message: elem.Error()})
+		}
+		writeErrors(w, errs)
+		return
+	}
+	if query.Get("category") != "" {
+		expr.Category = query.Get("category")
+	}
+	if query.Get("author") != "" {
+		expr.Author = query.Get("author")
+	}
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.view(r, true)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	ex := &search.Executor{Index: h.SearchIndex, Posts: h.PostRepo, Comments: h.CommentRepo, Allows: v.filter.Allows}
+	results, err := ex.Run(expr, limit)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	found := make([]*SearchForm, 0, len(results))
+	for _, elem := range results {
+		found = append(found, &SearchForm{Post: v.blurPost(elem.Post), Rank: elem.Score, Snippet: elem.Snippet})
+	}
+
+	res, err := json.Marshal(found)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
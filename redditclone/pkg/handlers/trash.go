@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/session"
+	"fakereddit/redditclone/pkg/user"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type TrashForm struct {
+	Posts    []*post.Post      `json:"posts"`
+	Comments []*TrashedComment `json:"comments"`
+}
+
+type TrashedComment struct {
+	PostID uint32 `json:"post"`
+	*comment.Comment
+}
+
+func (h *PostHandler) RestorePost(w http.ResponseWriter, r *http.Request) {
+	data := strings.TrimPrefix(r.URL.Path, "/api/post/")
+	data = strings.TrimSuffix(data, "/restore")
+	postID, err := strconv.Atoi(data)
+	if err != nil {
+		JSONErrorBuilder(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	postByID, err := h.PostRepo.Read(uint32(postID))
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !h.canRestore(sess, postByID.Author, postByID.DeletedBy) {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	_, err = h.PostRepo.Restore(uint32(postID))
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	h.writeThread(w, uint32(postID), sess.UserID)
+}
+
+func (h *PostHandler) RestoreComm(w http.ResponseWriter, r *http.Request) {
+	data := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/post/"), "/")
+
+	postID, err := strconv.Atoi(data[0])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+	commID, err := strconv.Atoi(data[1])
+	if err != nil {
+		JSONErrorBuilder(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	comm, err := h.readComment(uint32(postID), uint32(commID))
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !h.canRestore(sess, comm.Author, comm.DeletedBy) {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	_, err = h.CommentRepo.Restore(uint32(postID), uint32(commID))
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	h.writeThread(w, uint32(postID), sess.UserID)
+}
+
+// GetTrash lists everything deleted and not purged yet, for admins only.
+func (h *PostHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(sess) {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	h.writeTrash(w, "", sess.UserID)
+}
+
+// GetUserTrash lists deleted posts and comments of the user, visible to
+// the user and admins.
+func (h *PostHandler) GetUserTrash(w http.ResponseWriter, r *http.Request) {
+	login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/"), "/trash")
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		JSONErrorBuilder(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if sess.UserName != login && !h.isAdmin(sess) {
+		JSONErrorBuilder(w, ForbiddenTXT, http.StatusForbidden)
+		return
+	}
+
+	h.writeTrash(w, login, sess.UserID)
+}
+
+// writeTrash writes the trash of the author or the whole trash for "",
+// polls are rendered for the viewer.
+func (h *PostHandler) writeTrash(w http.ResponseWriter, login string, viewerID uint32) {
+	posts, err := h.PostRepo.ReadTrash()
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+	comments, err := h.CommentRepo.ReadTrash()
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	trash := &TrashForm{
+		Posts:    make([]*post.Post, 0, len(posts)),
+		Comments: make([]*TrashedComment, 0, len(comments)),
+	}
+	for _, elem := range posts {
+		if login == "" || elem.Author.Username == login {
+			trash.Posts = append(trash.Posts, h.Types.Render(elem, viewerID))
+		}
+	}
+	for _, elem := range comments {
+		if login == "" || elem.Author.Username == login {
+			trash.Comments = append(trash.Comments, &TrashedComment{PostID: elem.PostID, Comment: elem})
+		}
+	}
+
+	res, err := json.Marshal(trash)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+func (h *PostHandler) writeThread(w http.ResponseWriter, postID, viewerID uint32) {
+	postByID, err := h.thread(postID, "", viewerID)
+	if err != nil {
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(postByID)
+	if err != nil {
+		JSONErrorBuilder(w, MarshalErrorTXT, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(res)
+	if err != nil {
+		log.Printf("critical error, %v", err.Error())
+		return
+	}
+}
+
+// thread returns the post with its comments the way everyone sees them:
+// deleted post and comments are replaced by placeholders. Comments are
+// sorted by order, see comment.Sort. Polls are rendered for viewerID.
+func (h *PostHandler) thread(postID uint32, order string, viewerID uint32) (*post.Post, error) {
+	postByID, err := h.PostRepo.Read(postID)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := h.CommentRepo.ReadAll(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := h.Types.Render(postByID, viewerID)
+	if res.DeletedAt != "" {
+		res = deletedPost(postByID)
+	}
+	visible := visibleComments(comments)
+	if err = comment.Sort(visible, order); err != nil {
+		return nil, err
+	}
+	res.Comments = comment.Thread(visible)
+	return res, nil
+}
+
+// deletedPost is the placeholder of a deleted post. Only what locates the
+// thread is kept, so no content of any post type leaks: whatever a type
+// adds to Post is left out unless listed here.
+func deletedPost(p *post.Post) *post.Post {
+	return &post.Post{
+		ID:        p.ID,
+		Type:      "text",
+		Title:     DeletedTXT,
+		Data:      DeletedTXT,
+		Author:    &user.User{Username: DeletedTXT},
+		Category:  p.Category,
+		Created:   p.Created,
+		DeletedAt: p.DeletedAt,
+		Votes:     []*post.SingeVote{},
+	}
+}
+
+func (h *PostHandler) readComment(postID, commentID uint32) (*comment.Comment, error) {
+	comments, err := h.CommentRepo.ReadAll(postID)
+	if err != nil {
+		return nil, err
+	}
+	for _, elem := range comments {
+		if elem.ID == commentID {
+			return elem, nil
+		}
+	}
+	return nil, comment.ErrNoComm
+}
+
+func (h *PostHandler) isAdmin(sess *session.Session) bool {
+	return h.Admins[sess.UserName]
+}
+
+// canRestore lets authors restore what they deleted themselves, what
+// was deleted by an admin only an admin can bring back.
+func (h *PostHandler) canRestore(sess *session.Session, author, deletedBy *user.User) bool {
+	if h.isAdmin(sess) {
+		return true
+	}
+	return author.ID == sess.UserID && (deletedBy == nil || deletedBy.ID == sess.UserID)
+}
+
+func visibleComments(comments []*comment.Comment) []*comment.Comment {
+	res := make([]*comment.Comment, 0, len(comments))
+	for _, elem := range comments {
+		if elem.DeletedAt != "" {
+			hidden := *elem
+			hidden.Body = DeletedTXT
+			hidden.Author = &user.User{Username: DeletedTXT}
+			hidden.DeletedBy = nil
+			elem = &hidden
+		}
+		res = append(res, elem)
+	}
+	return res
+}
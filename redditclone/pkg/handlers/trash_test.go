@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/handlers"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/prefs"
+	"fakereddit/redditclone/pkg/session"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDeletedPostPlaceholder opens trashed posts of every kind, nothing
+// but the placeholder may come out.
+func TestDeletedPostPlaceholder(t *testing.T) {
+	posts := post.NewPostsRepo()
+	h := &handlers.PostHandler{
+		PostRepo:    posts,
+		CommentRepo: comment.NewCommentsRepo(),
+		Prefs:       prefs.NewPrefsRepo(),
+		Sessions:    session.NewSessionsManager(),
+		Types:       posttype.NewRegistry(posttype.Text{}, &posttype.Link{Posts: posts}, &posttype.Image{Posts: posts}, &posttype.Poll{Posts: posts}),
+	}
+	alex := &user.User{ID: 1, Username: "alex"}
+	secrets := []*post.Post{
+		{Type: "image", Data: "/media/secret.png", Content: json.RawMessage(`{"image":{"url":"/media/secret.png","thumbnail":"/media/secret-thumb.png"}}`)},
+		{Type: "poll", Data: "secret text", Content: json.RawMessage(`{"poll":{"options":[{"text":"secret yes"},{"text":"secret no"}],"ballots":[]}}`)},
+		{Type: "link", Data: "https://secret.example.com/", Content: json.RawMessage(`{"preview":{"url":"https://secret.example.com/","title":"secret page"}}`)},
+	}
+	for _, elem := range secrets {
+		elem.Author = alex
+		elem.Title = "secret title"
+		elem.Category = "music"
+		elem.Flair = "secret-flair"
+		elem.Tags = []string{"secret-tag"}
+		elem.NSFW = true
+		id, err := posts.Create(elem)
+		if err != nil {
+			t.Fatalf("Create %v post: %v", elem.Type, err)
+		}
+		posts.UpVote(id, alex)
+		if _, err = posts.Trash(id, alex); err != nil {
+			t.Fatalf("Trash %v post: %v", elem.Type, err)
+		}
+
+		w := httptest.NewRecorder()
+		h.Get(w, httptest.NewRequest("GET", fmt.Sprint("/api/post/", id), nil))
+		body := w.Body.String()
+		if w.Code != 200 {
+			t.Fatalf("Get deleted %v post: got %v %v", elem.Type, w.Code, body)
+		}
+		if strings.Contains(body, "secret") || strings.Contains(body, "alex") {
+			t.Fatalf("Deleted %v post leaks: %v", elem.Type, body)
+		}
+		got := map[string]interface{}{}
+		if err = json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if got["id"] != float64(id) || got["title"] != handlers.DeletedTXT || got["category"] != "music" || got["deletedAt"] == nil {
+			t.Fatalf("Deleted %v post: got %v", elem.Type, got)
+		}
+		for _, key := range []string{"image", "poll", "preview", "flair", "tags"} {
+			if _, ok := got[key]; ok {
+				t.Fatalf("Deleted %v post has %v: %v", elem.Type, key, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/posttype"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+const (
+	MultipartContentType = "multipart/form-data"
+
+	// formMemory is how much of a multipart form is kept in memory, the
+	// rest goes to temporary files
+	formMemory = 1 << 20
+)
+
+var (
+	errNoUploads = errors.New("uploads are turned off")
+	errTooBig    = errors.New("is too big")
+)
+
+// commonFields are read into PostForm, the rest of a multipart form is
+// for the post type.
+var commonFields = map[string]bool{
+	"category": true, "title": true, "type": true, "flair": true,
+	"tags": true, "nsfw": true, "spoiler": true,
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == MultipartContentType
+}
+
+// readMultipartForm reads the fields of PostForm as form values, tags
+// repeated, and the file in posttype.UploadField. Other values go to the
+// post type as json strings, or arrays of them when repeated.
+func (h *PostHandler) readMultipartForm(w http.ResponseWriter, r *http.Request) (*PostForm, *posttype.Input, error) {
+	limit := h.Types.SizeLimit()
+	if limit == 0 {
+		return nil, nil, errNoUploads
+	}
+	// the form may be a bit bigger than the file, the size of the file
+	// itself is checked by the post type
+	r.Body = http.MaxBytesReader(w, r.Body, limit+formMemory)
+	err := r.ParseMultipartForm(formMemory)
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		return nil, nil, errTooBig
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	data := &PostForm{
+		Category: r.FormValue("category"),
+		Title:    r.FormValue("title"),
+		Type:     r.FormValue("type"),
+		Flair:    r.FormValue("flair"),
+		Tags:     r.MultipartForm.Value["tags"],
+	}
+	data.NSFW, _ = strconv.ParseBool(r.FormValue("nsfw"))
+	data.Spoiler, _ = strconv.ParseBool(r.FormValue("spoiler"))
+
+	in := &posttype.Input{Fields: make(map[string]json.RawMessage)}
+	for key, values := range r.MultipartForm.Value {
+		if commonFields[key] {
+			continue
+		}
+		var value interface{} = values
+		if len(values) == 1 {
+			value = values[0]
+		}
+		in.Fields[key], err = json.Marshal(value)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	file, _, err := r.FormFile(posttype.UploadField)
+	if err == http.ErrMissingFile {
+		return data, in, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	in.Upload, err = ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, in, nil
+}
+
+// typeErrors answers with what the post type found wrong in the form.
+// When there is nothing to answer it returns true.
+func (h *PostHandler) typeErrors(w http.ResponseWriter, r *http.Request, fieldErrs []*posttype.FieldError, err error) bool {
+	var dup *posttype.DuplicateError
+	switch {
+	case errors.As(err, &dup):
+		h.writeDuplicates(w, r, dup.Posts)
+		return false
+	case err == posttype.ErrBadForm:
+		JSONErrorBuilder(w, UnmarshalErrorTXT, http.StatusBadRequest)
+		return false
+	case err != nil:
+		JSONErrorBuilder(w, UnexpectedErrorTXT, http.StatusInternalServerError)
+		return false
+	}
+	if len(fieldErrs) == 0 {
+		return true
+	}
+	errs := make([]*DetailError, 0, len(fieldErrs))
+	for _, elem := range fieldErrs {
+		errs = append(errs, &DetailError{Location: "body", Param: elem.Param, Message: elem.Message})
+	}
+	writeErrors(w, errs)
+	return false
+}
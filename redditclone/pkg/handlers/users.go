@@ -11,7 +11,7 @@ import (
 
 type UserHandler struct {
 	UserRepo user.UsersRepo
-	Sessions *session.SessionsManager
+	Sessions session.Manager
 }
 
 type JSONError struct {
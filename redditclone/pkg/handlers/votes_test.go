@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/handlers"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/session"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestVoteMissingPost votes on posts which are not there or trashed,
+// none of them may be voted on.
+func TestVoteMissingPost(t *testing.T) {
+	posts := post.NewPostsRepo()
+	sessions := session.NewSessionsManager()
+	h := &handlers.PostHandler{
+		PostRepo:    posts,
+		CommentRepo: comment.NewCommentsRepo(),
+		Sessions:    sessions,
+		Types:       posttype.NewRegistry(posttype.Text{}),
+	}
+	alex := &user.User{ID: 1, Username: "alex"}
+	sess, err := sessions.Create(nil, alex.ID, alex.Username)
+	if err != nil {
+		t.Fatalf("Create session: %v", err)
+	}
+	trashed, err := posts.Create(&post.Post{Author: alex, Type: "text", Title: "title", Category: "music"})
+	if err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	if _, err = posts.Trash(trashed, alex); err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+
+	votes := map[string]http.HandlerFunc{"upvote": h.Upvote, "downvote": h.DownVote, "unvote": h.UnVote}
+	for name, vote := range votes {
+		for _, id := range []uint32{trashed + 1, trashed} {
+			r := httptest.NewRequest("GET", fmt.Sprintf("/api/post/%v/%v", id, name), nil)
+			r.Header.Set("Authorization", "Bearer "+sess.AccessToken)
+			w := httptest.NewRecorder()
+			vote(w, r)
+			if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), post.ErrNoPost.Error()) {
+				t.Fatalf("%v of post %v: got %v %v, want %v", name, id, w.Code, w.Body.String(), http.StatusNotFound)
+			}
+		}
+	}
+	p, err := posts.Read(trashed)
+	if err != nil || len(p.Votes) != 0 {
+		t.Fatalf("Read trashed post: got %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,219 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCorrupted = errors.New("journal is corrupted")
+)
+
+// Journal is an append-only log of mutations plus the last compacted
+// snapshot of the state. Every entry gets a sequence number, the snapshot
+// remembers the last one it includes, so a crash between writing the
+// snapshot and truncating the log never applies an entry twice.
+type Journal struct {
+	mu   *sync.Mutex
+	name string
+	dir  string
+	f    *os.File
+	seq  uint64
+}
+
+type entry struct {
+	Seq  uint64          `json:"seq"`
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+type snapshot struct {
+	Seq   uint64          `json:"seq"`
+	State json.RawMessage `json:"state"`
+}
+
+// Snapshotter is implemented by the durable repos.
+type Snapshotter interface {
+	Snapshot() error
+}
+
+func Open(dir, name string) (*Journal, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name+".log"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Journal: opened '%v' in %v", name, dir)
+	return &Journal{
+		mu:   &sync.Mutex{},
+		name: name,
+		dir:  dir,
+		f:    f,
+	}, nil
+}
+
+// Load passes the snapshot to restore and then every logged mutation
+// made after it to apply, in order.
+func (j *Journal) Load(restore func(state json.RawMessage) error, apply func(op string, data json.RawMessage) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	raw, err := os.ReadFile(j.snapshotPath())
+	switch {
+	case err == nil:
+		snap := &snapshot{}
+		if err = json.Unmarshal(raw, snap); err != nil {
+			return err
+		}
+		if err = restore(snap.State); err != nil {
+			return err
+		}
+		j.seq = snap.Seq
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	if _, err = j.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(j.f)
+	var offset int64
+	replayed := 0
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// the last write was interrupted, drop the partial entry
+				log.Printf("Journal '%v': dropping partial entry at %v", j.name, offset)
+				if err = j.f.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+
+		e := &entry{}
+		if err = json.Unmarshal(line, e); err != nil {
+			log.Printf("ERROR: Journal '%v': bad entry at %v: %v", j.name, offset, err)
+			return ErrCorrupted
+		}
+		offset += int64(len(line))
+		if e.Seq <= j.seq {
+			continue
+		}
+		if err = apply(e.Op, e.Data); err != nil {
+			return err
+		}
+		j.seq = e.Seq
+		replayed++
+	}
+	log.Printf("Journal '%v': loaded snapshot and %v entries", j.name, replayed)
+	return nil
+}
+
+// Append durably writes one mutation to the log.
+func (j *Journal) Append(op string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	line, err := json.Marshal(&entry{Seq: j.seq + 1, Op: op, Data: raw})
+	if err != nil {
+		return err
+	}
+	if _, err = j.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err = j.f.Sync(); err != nil {
+		return err
+	}
+	j.seq++
+	return nil
+}
+
+// Compact replaces the snapshot with state and empties the log. The
+// caller must make sure no mutations are appended while state is taken.
+func (j *Journal) Compact(state interface{}) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	data, err := json.Marshal(&snapshot{Seq: j.seq, State: raw})
+	if err != nil {
+		return err
+	}
+
+	tmp := j.snapshotPath() + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, j.snapshotPath()); err != nil {
+		return err
+	}
+
+	if err = j.f.Truncate(0); err != nil {
+		return err
+	}
+	log.Printf("Journal '%v': compacted at seq %v", j.name, j.seq)
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+func (j *Journal) snapshotPath() string {
+	return filepath.Join(j.dir, j.name+".snapshot")
+}
+
+// Every snapshots all repos each interval until stop is closed.
+func Every(interval time.Duration, stop <-chan struct{}, repos ...Snapshotter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, repo := range repos {
+				if err := repo.Snapshot(); err != nil {
+					log.Printf("ERROR: snapshot: %v", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package link
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const MaxLen = 2000
+
+var (
+	ErrEmpty   = errors.New("is required")
+	ErrTooLong = errors.New("is too long")
+	ErrScheme  = errors.New("must be an http or https link")
+	ErrHost    = errors.New("has no valid host")
+)
+
+var labelRe = regexp.MustCompile(`^[\p{L}\p{N}]([\p{L}\p{N}-]{0,61}[\p{L}\p{N}])?$`)
+
+// tracking are query parameters which only tell where the click came from,
+// the page is the same without them.
+var tracking = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"ref_src": true,
+}
+
+// Canonical checks the link and brings it to one form, so the same page
+// submitted twice gives the same string: the scheme and host are lower
+// case, default ports, tracking parameters, the fragment and trailing
+// slashes are dropped, the rest of the query is sorted.
+func Canonical(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrEmpty
+	}
+	if len(raw) > MaxLen {
+		return "", ErrTooLong
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrHost
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", ErrScheme
+	}
+	if u.User != nil || u.Opaque != "" {
+		return "", ErrHost
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if !validHost(host) {
+		return "", ErrHost
+	}
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	query := u.Query()
+	for key := range query {
+		if tracking[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+func validHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	labels := strings.Split(host, ".")
+	if len(host) > 253 || len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if !labelRe.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
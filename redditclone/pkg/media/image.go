@@ -0,0 +1,344 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	Prefix = "/media/"
+
+	DefaultMaxBytes  = 10 << 20
+	DefaultMaxSide   = 8000
+	DefaultMaxPixels = 25000000
+	DefaultMaxFrames = 500
+	DefaultThumbSide = 320
+
+	jpegQuality = 90
+)
+
+var (
+	ErrTooBig     = errors.New("is too big")
+	ErrFormat     = errors.New("must be a jpeg, png or gif image")
+	ErrDimensions = errors.New("has too many pixels")
+	ErrFrames     = errors.New("has too many frames")
+)
+
+// formats are the accepted content types, by what the bytes look like
+// and not what the client says, with the extension files get.
+var formats = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Image is a stored picture, URL and Thumbnail are served under Prefix.
+type Image struct {
+	URL         string `json:"url"`
+	Thumbnail   string `json:"thumbnail"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+}
+
+// Images checks uploads and stores them with a thumbnail. Every image is
+// decoded and encoded again, which drops EXIF and other metadata; the
+// orientation of photos is applied to the pixels first.
+//
+// MaxPixels limits width x height of the decoded image, for a gif it is
+// the pixels of all frames together. Both are checked from the headers
+// before anything is decoded.
+type Images struct {
+	Storage   Storage
+	MaxBytes  int64
+	MaxSide   int
+	MaxPixels int64
+	MaxFrames int
+	ThumbSide int
+}
+
+// Save stores the image and its thumbnail. Errors other than ErrTooBig,
+// ErrFormat, ErrDimensions and ErrFrames are failures of the storage.
+func (im *Images) Save(data []byte) (*Image, error) {
+	if int64(len(data)) > im.SizeLimit() {
+		return nil, ErrTooBig
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := formats[contentType]
+	if !ok {
+		return nil, ErrFormat
+	}
+	// the header is enough to refuse images which would take too much
+	// memory to decode
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > im.maxSide() || cfg.Height > im.maxSide() ||
+		int64(cfg.Width)*int64(cfg.Height) > im.maxPixels() {
+		return nil, ErrDimensions
+	}
+	if contentType == "image/gif" {
+		frames, pixels, err := gifFrames(data)
+		if err != nil {
+			return nil, err
+		}
+		if frames > im.maxFrames() {
+			return nil, ErrFrames
+		}
+		if pixels > im.maxPixels() {
+			return nil, ErrDimensions
+		}
+	}
+
+	var (
+		clean bytes.Buffer
+		first image.Image
+	)
+	switch contentType {
+	case "image/gif":
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrFormat
+		}
+		if err = gif.EncodeAll(&clean, g); err != nil {
+			return nil, err
+		}
+		first = firstFrame(g)
+	case "image/png":
+		first, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrFormat
+		}
+		if err = png.Encode(&clean, first); err != nil {
+			return nil, err
+		}
+	default:
+		first, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrFormat
+		}
+		first = orient(first, orientation(data))
+		if err = jpeg.Encode(&clean, first, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	}
+
+	// transparent images keep their alpha in a png thumbnail
+	var thumb bytes.Buffer
+	thumbExt := "png"
+	small := thumbnail(first, im.thumbSide())
+	if contentType == "image/jpeg" {
+		thumbExt = "jpg"
+		err = jpeg.Encode(&thumb, small, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&thumb, small)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := strings.Replace(uuid.New().String(), "-", "", -1)
+	name := id + "." + ext
+	thumbName := id + "_thumb." + thumbExt
+	if err = im.Storage.Put(name, clean.Bytes()); err != nil {
+		return nil, err
+	}
+	if err = im.Storage.Put(thumbName, thumb.Bytes()); err != nil {
+		im.Storage.Delete(name)
+		return nil, err
+	}
+
+	bounds := first.Bounds()
+	log.Printf("Save image: '%v' %vx%v", name, bounds.Dx(), bounds.Dy())
+	return &Image{
+		URL:         Prefix + name,
+		Thumbnail:   Prefix + thumbName,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		ContentType: contentType,
+		Size:        clean.Len(),
+	}, nil
+}
+
+// Remove deletes the files of the image, missing ones are skipped. It
+// returns how many files were deleted.
+func (im *Images) Remove(img *Image) (int, error) {
+	removed := 0
+	for _, url := range []string{img.URL, img.Thumbnail} {
+		err := im.Storage.Delete(strings.TrimPrefix(url, Prefix))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return removed, fmt.Errorf("delete %v: %w", url, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// SizeLimit is the biggest upload Save takes.
+func (im *Images) SizeLimit() int64 {
+	if im.MaxBytes <= 0 {
+		return DefaultMaxBytes
+	}
+	return im.MaxBytes
+}
+
+func (im *Images) maxSide() int {
+	if im.MaxSide <= 0 {
+		return DefaultMaxSide
+	}
+	return im.MaxSide
+}
+
+func (im *Images) maxPixels() int64 {
+	if im.MaxPixels <= 0 {
+		return DefaultMaxPixels
+	}
+	return im.MaxPixels
+}
+
+func (im *Images) maxFrames() int {
+	if im.MaxFrames <= 0 {
+		return DefaultMaxFrames
+	}
+	return im.MaxFrames
+}
+
+func (im *Images) thumbSide() int {
+	if im.ThumbSide <= 0 {
+		return DefaultThumbSide
+	}
+	return im.ThumbSide
+}
+
+// gifFrames counts the frames of a gif and the pixels they decode to by
+// walking its blocks, the pixel data is skipped.
+func gifFrames(data []byte) (int, int64, error) {
+	// header and logical screen descriptor, then the global color table
+	if len(data) < 13 {
+		return 0, 0, ErrFormat
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&7 + 1)
+	}
+
+	frames := 0
+	var pixels int64
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21:
+			// extension: label and data sub-blocks
+			pos = skipSubBlocks(data, pos+2)
+		case 0x2c:
+			// image descriptor, local color table, LZW code size and
+			// data sub-blocks
+			if pos+10 > len(data) {
+				return 0, 0, ErrFormat
+			}
+			width := binary.LittleEndian.Uint16(data[pos+5:])
+			height := binary.LittleEndian.Uint16(data[pos+7:])
+			frames++
+			pixels += int64(width) * int64(height)
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&7 + 1)
+			}
+			pos = skipSubBlocks(data, pos+1)
+		case 0x3b:
+			return frames, pixels, nil
+		default:
+			return 0, 0, ErrFormat
+		}
+		if pos < 0 {
+			return 0, 0, ErrFormat
+		}
+	}
+	return 0, 0, ErrFormat
+}
+
+// skipSubBlocks returns the position after the sub-blocks starting at
+// pos, -1 if they run past the data.
+func skipSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		n := int(data[pos])
+		pos++
+		if n == 0 {
+			return pos
+		}
+		pos += n
+	}
+	return -1
+}
+
+// firstFrame draws the first frame on the whole canvas, frames of a gif
+// may cover only part of it.
+func firstFrame(g *gif.GIF) image.Image {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	if len(g.Image) > 0 {
+		draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+	}
+	return canvas
+}
+
+// thumbnail scales the image down to fit a side x side square, averaging
+// the pixels each thumbnail pixel covers. Small images are only copied.
+func thumbnail(src image.Image, side int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > side || h > side {
+		if w >= h {
+			tw, th = side, h*side/w
+		} else {
+			tw, th = w*side/h, side
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,71 @@
+package media_test
+
+import (
+	"bytes"
+	"fakereddit/redditclone/pkg/media"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, side, frames int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	// every other frame gets a local color table
+	palettes := [][]color.Color{palette.Plan9, palette.WebSafe}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, side, side), palettes[i%2]))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("gif.EncodeAll: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestImageLimits checks the limits are applied from the headers, the
+// pixels of a gif are summed over its frames.
+func TestImageLimits(t *testing.T) {
+	im := &media.Images{Storage: mustStorage(t), MaxSide: 100, MaxPixels: 2500, MaxFrames: 4}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"png", encodePNG(t, 50, 50), nil},
+		{"wide png", encodePNG(t, 101, 1), media.ErrDimensions},
+		{"png with too many pixels", encodePNG(t, 60, 50), media.ErrDimensions},
+		{"gif", encodeGIF(t, 25, 4), nil},
+		{"gif with too many pixels", encodeGIF(t, 30, 3), media.ErrDimensions},
+		{"gif with too many frames", encodeGIF(t, 2, 5), media.ErrFrames},
+		{"truncated gif", encodeGIF(t, 10, 2)[:60], media.ErrFormat},
+	}
+	for _, tc := range tests {
+		if _, err := im.Save(tc.data); err != tc.want {
+			t.Fatalf("Save %v: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func mustStorage(t *testing.T) media.Storage {
+	t.Helper()
+	fs, err := media.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	return fs
+}
@@ -0,0 +1,46 @@
+package media
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var contentTypes = map[string]string{
+	".jpg": "image/jpeg",
+	".png": "image/png",
+	".gif": "image/gif",
+}
+
+// Server serves stored files under Prefix. A name always means the same
+// bytes, so clients and proxies may cache them for good.
+type Server struct {
+	Storage Storage
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, Prefix)
+	contentType, ok := contentTypes[path.Ext(name)]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, modified, err := s.Storage.Open(name)
+	if err == ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: open media '%v': %v", name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+name+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, name, modified, f)
+}
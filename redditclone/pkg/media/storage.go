@@ -0,0 +1,102 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("no media found")
+	ErrBadName  = errors.New("invalid media name")
+)
+
+var nameRe = regexp.MustCompile(`^[a-z0-9_-]{1,64}\.[a-z]{1,5}$`)
+
+// Storage keeps uploaded files by name. Names are generated by Images and
+// never reused, so a stored file doesn't change.
+type Storage interface {
+	Put(name string, data []byte) error
+	// Open returns the file with the time it was stored
+	Open(name string) (io.ReadSeekCloser, time.Time, error)
+	Delete(name string) error
+}
+
+// FileStorage keeps files in one directory of the local filesystem.
+type FileStorage struct {
+	Dir string
+}
+
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStorage{Dir: dir}, nil
+}
+
+// Put writes the file next to its place and renames it, so a half written
+// file is never served.
+func (fs *FileStorage) Put(name string, data []byte) error {
+	if !nameRe.MatchString(name) {
+		return ErrBadName
+	}
+	tmp, err := ioutil.TempFile(fs.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(fs.Dir, name)); err != nil {
+		return err
+	}
+	log.Printf("Put media: '%v'", name)
+	return nil
+}
+
+func (fs *FileStorage) Open(name string) (io.ReadSeekCloser, time.Time, error) {
+	if !nameRe.MatchString(name) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	f, err := os.Open(filepath.Join(fs.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	return f, info.ModTime(), nil
+}
+
+func (fs *FileStorage) Delete(name string) error {
+	if !nameRe.MatchString(name) {
+		return ErrNotFound
+	}
+	err := os.Remove(filepath.Join(fs.Dir, name))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Delete media: '%v'", name)
+	return nil
+}
@@ -0,0 +1,142 @@
+package mute
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"sync"
+)
+
+const (
+	opHide         = "hide"
+	opUnhide       = "unhide"
+	opAddRule      = "addrule"
+	opRemoveRule   = "removerule"
+	opDeleteByPost = "deletepost"
+)
+
+// DurableMutesRepo is a MutesDataRepo which logs every mutation to a
+// journal and restores itself from it on start.
+type DurableMutesRepo struct {
+	*MutesDataRepo
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+type mutesSnapshot struct {
+	HiddenPosts map[uint32][]uint32 `json:"hidden"`
+	MuteRules   map[uint32][]*Rule  `json:"rules"`
+}
+
+type muteEntry struct {
+	UserID uint32 `json:"user,omitempty"`
+	PostID uint32 `json:"post,omitempty"`
+	Rule   *Rule  `json:"rule,omitempty"`
+}
+
+func NewDurableMutesRepo(j *journal.Journal) (*DurableMutesRepo, error) {
+	repo := &DurableMutesRepo{
+		MutesDataRepo: NewMutesRepo(),
+		mu:            &sync.Mutex{},
+		journal:       j,
+	}
+
+	err := j.Load(repo.restore, repo.apply)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (dr *DurableMutesRepo) restore(state json.RawMessage) error {
+	snap := &mutesSnapshot{}
+	if err := json.Unmarshal(state, snap); err != nil {
+		return err
+	}
+	if snap.HiddenPosts != nil {
+		dr.HiddenPosts = snap.HiddenPosts
+	}
+	if snap.MuteRules != nil {
+		dr.MuteRules = snap.MuteRules
+	}
+	return nil
+}
+
+func (dr *DurableMutesRepo) apply(op string, data json.RawMessage) error {
+	e := &muteEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return err
+	}
+	var err error
+	switch op {
+	case opHide:
+		err = dr.MutesDataRepo.Hide(e.UserID, e.PostID)
+	case opUnhide:
+		_, err = dr.MutesDataRepo.Unhide(e.UserID, e.PostID)
+	case opAddRule:
+		err = dr.MutesDataRepo.AddRule(e.UserID, e.Rule)
+	case opRemoveRule:
+		_, err = dr.MutesDataRepo.RemoveRule(e.UserID, e.Rule)
+	case opDeleteByPost:
+		_, err = dr.MutesDataRepo.DeleteByPost(e.PostID)
+	}
+	return err
+}
+
+func (dr *DurableMutesRepo) Hide(userID, postID uint32) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.MutesDataRepo.Hide(userID, postID); err != nil {
+		return err
+	}
+	return dr.journal.Append(opHide, &muteEntry{UserID: userID, PostID: postID})
+}
+
+func (dr *DurableMutesRepo) Unhide(userID, postID uint32) (bool, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	ok, err := dr.MutesDataRepo.Unhide(userID, postID)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, dr.journal.Append(opUnhide, &muteEntry{UserID: userID, PostID: postID})
+}
+
+func (dr *DurableMutesRepo) AddRule(userID uint32, rule *Rule) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.MutesDataRepo.AddRule(userID, rule); err != nil {
+		return err
+	}
+	return dr.journal.Append(opAddRule, &muteEntry{UserID: userID, Rule: rule})
+}
+
+func (dr *DurableMutesRepo) RemoveRule(userID uint32, rule *Rule) (bool, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	ok, err := dr.MutesDataRepo.RemoveRule(userID, rule)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, dr.journal.Append(opRemoveRule, &muteEntry{UserID: userID, Rule: rule})
+}
+
+func (dr *DurableMutesRepo) DeleteByPost(postID uint32) (int, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	n, err := dr.MutesDataRepo.DeleteByPost(postID)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, dr.journal.Append(opDeleteByPost, &muteEntry{PostID: postID})
+}
+
+func (dr *DurableMutesRepo) Snapshot() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.MutesDataRepo.mu.RLock()
+	defer dr.MutesDataRepo.mu.RUnlock()
+	return dr.journal.Compact(&mutesSnapshot{
+		HiddenPosts: dr.HiddenPosts,
+		MuteRules:   dr.MuteRules,
+	})
+}
@@ -0,0 +1,152 @@
+// Package mute keeps what users don't want to see: hidden posts and rules
+// muting categories, authors and keywords in titles.
+package mute
+
+import (
+	"fakereddit/redditclone/pkg/post"
+	"strings"
+	"unicode"
+)
+
+const (
+	KindCategory = "category"
+	KindAuthor   = "author"
+	KindKeyword  = "keyword"
+)
+
+// Kinds are the known rule kinds.
+var Kinds = map[string]bool{KindCategory: true, KindAuthor: true, KindKeyword: true}
+
+type Rule struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type MutesRepo interface {
+	Hide(userID, postID uint32) error
+	Unhide(userID, postID uint32) (bool, error)
+	// Hidden are the hidden posts of the user, in the order they were hidden
+	Hidden(userID uint32) ([]uint32, error)
+	// AddRule is a no-op for a rule the user already has
+	AddRule(userID uint32, rule *Rule) error
+	RemoveRule(userID uint32, rule *Rule) (bool, error)
+	Rules(userID uint32) ([]*Rule, error)
+	// DeleteByPost unhides the post for all users
+	DeleteByPost(postID uint32) (int, error)
+}
+
+// Filter is everything one user muted, the nil Filter lets all posts
+// through.
+type Filter struct {
+	hidden     map[uint32]bool
+	categories map[string]bool
+	authors    map[string]bool
+	keywords   []string
+	// nsfw and spoiler hide posts with these content warnings
+	nsfw    bool
+	spoiler bool
+}
+
+// Load builds the filter of the user.
+func Load(repo MutesRepo, userID uint32) (*Filter, error) {
+	hidden, err := repo.Hidden(userID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := repo.Rules(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		hidden:     make(map[uint32]bool, len(hidden)),
+		categories: make(map[string]bool),
+		authors:    make(map[string]bool),
+	}
+	for _, id := range hidden {
+		f.hidden[id] = true
+	}
+	for _, rule := range rules {
+		switch rule.Kind {
+		case KindCategory:
+			f.categories[rule.Value] = true
+		case KindAuthor:
+			f.authors[rule.Value] = true
+		case KindKeyword:
+			// rules saved before keywords were checked may have no words
+			if IsKeyword(rule.Value) {
+				f.keywords = append(f.keywords, words(rule.Value))
+			}
+		}
+	}
+	return f, nil
+}
+
+// Allows tells if the post is not hidden or muted.
+func (f *Filter) Allows(p *post.Post) bool {
+	if f == nil {
+		return true
+	}
+	if f.hidden[p.ID] || f.categories[p.Category] || p.Author != nil && f.authors[p.Author.Username] ||
+		f.nsfw && p.NSFW || f.spoiler && p.Spoiler {
+		return false
+	}
+	if len(f.keywords) == 0 {
+		return true
+	}
+	title := words(p.Title)
+	for _, keyword := range f.keywords {
+		if strings.Contains(title, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// HideMarked makes the filter leave out NSFW or spoiler posts too, on the
+// nil Filter it returns a new one.
+func (f *Filter) HideMarked(nsfw, spoiler bool) *Filter {
+	if f == nil {
+		if !nsfw && !spoiler {
+			return nil
+		}
+		f = &Filter{}
+	}
+	f.nsfw = f.nsfw || nsfw
+	f.spoiler = f.spoiler || spoiler
+	return f
+}
+
+// MutesAuthor tells if the user muted the author, for comments.
+func (f *Filter) MutesAuthor(login string) bool {
+	return f != nil && f.authors[login]
+}
+
+// Apply returns the allowed posts, posts is not changed.
+func (f *Filter) Apply(posts []*post.Post) []*post.Post {
+	if f == nil {
+		return posts
+	}
+	res := make([]*post.Post, 0, len(posts))
+	for _, elem := range posts {
+		if f.Allows(elem) {
+			res = append(res, elem)
+		}
+	}
+	return res
+}
+
+// IsKeyword tells if the text has words to match, "!!!" has none.
+func IsKeyword(text string) bool {
+	return strings.TrimSpace(words(text)) != ""
+}
+
+// words lowercases the text and keeps only its words, space separated and
+// padded with spaces, so keywords match whole words: "art" does not mute
+// "party".
+func words(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(fields, " ") + " "
+}
@@ -0,0 +1,34 @@
+package mute_test
+
+import (
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/post"
+	"testing"
+)
+
+func TestIsKeyword(t *testing.T) {
+	for text, want := range map[string]bool{"art": true, "Rock'n'roll": true, "!!!": false, " - ": false, "": false, "№1": true} {
+		if got := mute.IsKeyword(text); got != want {
+			t.Fatalf("IsKeyword(%q): got %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	repo := mute.NewMutesRepo()
+	// a rule without words saved before keywords were checked
+	for _, value := range []string{"!!!", "art"} {
+		if err := repo.AddRule(1, &mute.Rule{Kind: mute.KindKeyword, Value: value}); err != nil {
+			t.Fatalf("AddRule: %v", err)
+		}
+	}
+	f, err := mute.Load(repo, 1)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for title, want := range map[string]bool{"": true, "?!": true, "Art news": false, "Great party": true} {
+		if got := f.Allows(&post.Post{Title: title}); got != want {
+			t.Fatalf("Allows(%q): got %v, want %v", title, got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package mute
+
+import (
+	"log"
+	"sync"
+)
+
+type MutesDataRepo struct {
+	mu *sync.RWMutex
+	// HiddenPosts are hidden post ids by user id
+	HiddenPosts map[uint32][]uint32
+	MuteRules   map[uint32][]*Rule
+}
+
+func NewMutesRepo() *MutesDataRepo {
+	log.Printf("NewMutesRepo: created MutesDataRepo")
+	return &MutesDataRepo{
+		HiddenPosts: make(map[uint32][]uint32),
+		MuteRules:   make(map[uint32][]*Rule),
+		mu:          &sync.RWMutex{},
+	}
+}
+
+func (mr *MutesDataRepo) Hide(userID, postID uint32) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for _, id := range mr.HiddenPosts[userID] {
+		if id == postID {
+			return nil
+		}
+	}
+	mr.HiddenPosts[userID] = append(mr.HiddenPosts[userID], postID)
+	log.Printf("Hide: user %v hid post %v", userID, postID)
+	return nil
+}
+
+func (mr *MutesDataRepo) Unhide(userID, postID uint32) (bool, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	ids := mr.HiddenPosts[userID]
+	for idx, id := range ids {
+		if id == postID {
+			mr.HiddenPosts[userID] = append(ids[:idx:idx], ids[idx+1:]...)
+			log.Printf("Unhide: user %v unhid post %v", userID, postID)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (mr *MutesDataRepo) Hidden(userID uint32) ([]uint32, error) {
+	mr.mu.RLock()
+	res := append([]uint32{}, mr.HiddenPosts[userID]...)
+	mr.mu.RUnlock()
+	return res, nil
+}
+
+func (mr *MutesDataRepo) AddRule(userID uint32, rule *Rule) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for _, elem := range mr.MuteRules[userID] {
+		if *elem == *rule {
+			return nil
+		}
+	}
+	mr.MuteRules[userID] = append(mr.MuteRules[userID], rule)
+	log.Printf("AddRule: user %v muted %v '%v'", userID, rule.Kind, rule.Value)
+	return nil
+}
+
+func (mr *MutesDataRepo) RemoveRule(userID uint32, rule *Rule) (bool, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	rules := mr.MuteRules[userID]
+	for idx, elem := range rules {
+		if *elem == *rule {
+			mr.MuteRules[userID] = append(rules[:idx:idx], rules[idx+1:]...)
+			log.Printf("RemoveRule: user %v unmuted %v '%v'", userID, rule.Kind, rule.Value)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (mr *MutesDataRepo) Rules(userID uint32) ([]*Rule, error) {
+	mr.mu.RLock()
+	res := append([]*Rule{}, mr.MuteRules[userID]...)
+	mr.mu.RUnlock()
+	return res, nil
+}
+
+func (mr *MutesDataRepo) DeleteByPost(postID uint32) (int, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	n := 0
+	for userID, ids := range mr.HiddenPosts {
+		kept := make([]uint32, 0, len(ids))
+		for _, id := range ids {
+			if id != postID {
+				kept = append(kept, id)
+			}
+		}
+		n += len(ids) - len(kept)
+		mr.HiddenPosts[userID] = kept
+	}
+	log.Printf("DeleteByPost: unhid post %v for %v users", postID, n)
+	return n, nil
+}
@@ -0,0 +1,135 @@
+package mute
+
+import (
+	"database/sql"
+	"log"
+)
+
+const mutesSchema = `
+CREATE TABLE IF NOT EXISTS hidden_posts (
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	post_id INTEGER NOT NULL REFERENCES posts (id),
+	seq     INTEGER NOT NULL,
+	PRIMARY KEY (user_id, post_id)
+);
+CREATE INDEX IF NOT EXISTS hidden_posts_post ON hidden_posts (post_id);
+
+CREATE TABLE IF NOT EXISTS mute_rules (
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	kind    TEXT    NOT NULL,
+	value   TEXT    NOT NULL,
+	seq     INTEGER NOT NULL,
+	PRIMARY KEY (user_id, kind, value)
+);`
+
+type MutesSQLiteRepo struct {
+	db *sql.DB
+}
+
+func NewMutesSQLiteRepo(db *sql.DB) (*MutesSQLiteRepo, error) {
+	if _, err := db.Exec(mutesSchema); err != nil {
+		return nil, err
+	}
+	log.Printf("NewMutesSQLiteRepo: created MutesSQLiteRepo")
+	return &MutesSQLiteRepo{db: db}, nil
+}
+
+func (mr *MutesSQLiteRepo) Hide(userID, postID uint32) error {
+	_, err := mr.db.Exec(`INSERT OR IGNORE INTO hidden_posts (user_id, post_id, seq)
+		VALUES (?, ?, (SELECT coalesce(max(seq), 0) + 1 FROM hidden_posts))`, userID, postID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Hide: user %v hid post %v", userID, postID)
+	return nil
+}
+
+func (mr *MutesSQLiteRepo) Unhide(userID, postID uint32) (bool, error) {
+	res, err := mr.db.Exec(`DELETE FROM hidden_posts WHERE user_id = ? AND post_id = ?`, userID, postID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		log.Printf("Unhide: user %v unhid post %v", userID, postID)
+	}
+	return n > 0, nil
+}
+
+func (mr *MutesSQLiteRepo) Hidden(userID uint32) ([]uint32, error) {
+	rows, err := mr.db.Query(`SELECT post_id FROM hidden_posts WHERE user_id = ? ORDER BY seq`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]uint32, 0)
+	for rows.Next() {
+		var id uint32
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		res = append(res, id)
+	}
+	return res, rows.Err()
+}
+
+func (mr *MutesSQLiteRepo) AddRule(userID uint32, rule *Rule) error {
+	_, err := mr.db.Exec(`INSERT OR IGNORE INTO mute_rules (user_id, kind, value, seq)
+		VALUES (?, ?, ?, (SELECT coalesce(max(seq), 0) + 1 FROM mute_rules))`, userID, rule.Kind, rule.Value)
+	if err != nil {
+		return err
+	}
+	log.Printf("AddRule: user %v muted %v '%v'", userID, rule.Kind, rule.Value)
+	return nil
+}
+
+func (mr *MutesSQLiteRepo) RemoveRule(userID uint32, rule *Rule) (bool, error) {
+	res, err := mr.db.Exec(`DELETE FROM mute_rules WHERE user_id = ? AND kind = ? AND value = ?`,
+		userID, rule.Kind, rule.Value)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		log.Printf("RemoveRule: user %v unmuted %v '%v'", userID, rule.Kind, rule.Value)
+	}
+	return n > 0, nil
+}
+
+func (mr *MutesSQLiteRepo) Rules(userID uint32) ([]*Rule, error) {
+	rows, err := mr.db.Query(`SELECT kind, value FROM mute_rules WHERE user_id = ? ORDER BY seq`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Rule, 0)
+	for rows.Next() {
+		rule := &Rule{}
+		if err = rows.Scan(&rule.Kind, &rule.Value); err != nil {
+			return nil, err
+		}
+		res = append(res, rule)
+	}
+	return res, rows.Err()
+}
+
+func (mr *MutesSQLiteRepo) DeleteByPost(postID uint32) (int, error) {
+	res, err := mr.db.Exec(`DELETE FROM hidden_posts WHERE post_id = ?`, postID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("DeleteByPost: unhid post %v for %v users", postID, n)
+	return int(n), nil
+}
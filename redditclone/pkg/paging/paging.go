@@ -0,0 +1,127 @@
+// Package paging keeps listings stable between pages. Listings sorted by
+// id page by the last seen id. Ranked listings change with every vote, so
+// their order is frozen into a snapshot on the first page and the cursor
+// points into it.
+package paging
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLimit = 25
+	MaxLimit     = 100
+)
+
+var (
+	ErrBadCursor = errors.New("invalid cursor")
+	ErrExpired   = errors.New("cursor expired")
+	// ErrOtherListing is a cursor made by another listing, sort or filter
+	ErrOtherListing = errors.New("cursor is for another listing")
+)
+
+// Cursor is opaque for clients, one of After, Snapshot or Key is set.
+type Cursor struct {
+	After    uint32 `json:"a,omitempty"`
+	Snapshot string `json:"s,omitempty"`
+	Offset   int    `json:"o,omitempty"`
+	// Key is the sort key of the last item of listings mixing posts and comments
+	Key string `json:"k,omitempty"`
+	// Listing is the key of the listing the cursor belongs to
+	Listing string `json:"l,omitempty"`
+}
+
+func (c *Cursor) Encode() string {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func Decode(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	c := &Cursor{}
+	if err = json.Unmarshal(raw, c); err != nil {
+		return nil, ErrBadCursor
+	}
+	if c.After == 0 && c.Snapshot == "" && c.Key == "" || c.Offset < 0 {
+		return nil, ErrBadCursor
+	}
+	return c, nil
+}
+
+type snapshot struct {
+	listing string
+	ids     []uint32
+	expires time.Time
+}
+
+// Snapshots keeps frozen listings for TTL after they were made, at most
+// Max of them, the oldest go first.
+type Snapshots struct {
+	mu    *sync.Mutex
+	TTL   time.Duration
+	Max   int
+	data  map[string]*snapshot
+	order []string
+}
+
+func NewSnapshots(ttl time.Duration, max int) *Snapshots {
+	return &Snapshots{
+		mu:   &sync.Mutex{},
+		TTL:  ttl,
+		Max:  max,
+		data: make(map[string]*snapshot),
+	}
+}
+
+// Save stores the order of the listing and returns the key of the snapshot.
+func (s *Snapshots) Save(listing string, ids []uint32) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("paging: can't make snapshot key: %v", err)
+		return "", err
+	}
+	key := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for len(s.order) > 0 {
+		oldest := s.data[s.order[0]]
+		if oldest != nil && len(s.order) < s.Max && now.Before(oldest.expires) {
+			break
+		}
+		delete(s.data, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.data[key] = &snapshot{listing: listing, ids: ids, expires: now.Add(s.TTL)}
+	s.order = append(s.order, key)
+	return key, nil
+}
+
+// Load returns the order saved for the listing, a snapshot of another
+// listing is ErrOtherListing.
+func (s *Snapshots) Load(key, listing string) ([]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.data[key]
+	if !ok || time.Now().After(snap.expires) {
+		return nil, ErrExpired
+	}
+	if snap.listing != listing {
+		return nil, ErrOtherListing
+	}
+	return snap.ids, nil
+}
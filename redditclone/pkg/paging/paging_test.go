@@ -0,0 +1,53 @@
+package paging_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"fakereddit/redditclone/pkg/paging"
+)
+
+func TestCursor(t *testing.T) {
+	c := &paging.Cursor{Snapshot: "abc", Offset: 25, Listing: "music"}
+	got, err := paging.Decode(c.Encode())
+	if err != nil || *got != *c {
+		t.Fatalf("Decode(Encode()): got %+v, %v, want %+v", got, err, c)
+	}
+	for _, bad := range []string{"", "%%%", "bnVsbA", (&paging.Cursor{Listing: "music"}).Encode(), (&paging.Cursor{After: 1, Offset: -1}).Encode()} {
+		if _, err = paging.Decode(bad); err != paging.ErrBadCursor {
+			t.Fatalf("Decode(%q): got %v, want %v", bad, err, paging.ErrBadCursor)
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	s := paging.NewSnapshots(time.Minute, 2)
+	key, err := s.Save("music", []uint32{3, 1, 2})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	ids, err := s.Load(key, "music")
+	if err != nil || !reflect.DeepEqual(ids, []uint32{3, 1, 2}) {
+		t.Fatalf("Load: got %v, %v", ids, err)
+	}
+	if _, err = s.Load(key, "funny"); err != paging.ErrOtherListing {
+		t.Fatalf("Load of another listing: got %v, want %v", err, paging.ErrOtherListing)
+	}
+	if _, err = s.Load("nope", "music"); err != paging.ErrExpired {
+		t.Fatalf("Load of an unknown key: got %v, want %v", err, paging.ErrExpired)
+	}
+
+	// Max snapshots are kept, the oldest goes first
+	s.Save("music", nil)
+	s.Save("music", nil)
+	if _, err = s.Load(key, "music"); err != paging.ErrExpired {
+		t.Fatalf("Load of an evicted snapshot: got %v, want %v", err, paging.ErrExpired)
+	}
+
+	s = paging.NewSnapshots(-time.Second, 10)
+	key, _ = s.Save("music", []uint32{1})
+	if _, err = s.Load(key, "music"); err != paging.ErrExpired {
+		t.Fatalf("Load after TTL: got %v, want %v", err, paging.ErrExpired)
+	}
+}
@@ -0,0 +1,316 @@
+package post
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/user"
+	"sync"
+)
+
+const (
+	opCreate   = "create"
+	opUpVote   = "upvote"
+	opDownVote = "downvote"
+	opUnVote   = "unvote"
+	opDelete   = "delete"
+	opTrash    = "trash"
+	opRestore  = "restore"
+	opUpdate   = "update"
+	opMark     = "mark"
+	opView     = "view"
+	opContent  = "content"
+)
+
+// DurablePostsRepo is a PostsDataRepo which logs every mutation to a
+// journal and restores itself from it on start.
+type DurablePostsRepo struct {
+	*PostsDataRepo
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+type postsSnapshot struct {
+	LastID    uint32                 `json:"lastID"`
+	Data      []*Post                `json:"data"`
+	Revisions map[uint32][]*Revision `json:"revisions"`
+}
+
+type voteEntry struct {
+	PostID uint32 `json:"post"`
+	UserID uint32 `json:"user"`
+	At     string `json:"at,omitempty"`
+}
+
+type updateEntry struct {
+	PostID uint32     `json:"post"`
+	Title  string     `json:"title"`
+	Data   string     `json:"data"`
+	Editor *user.User `json:"editor"`
+	Edited string     `json:"edited"`
+}
+
+type markEntry struct {
+	PostID  uint32 `json:"post"`
+	NSFW    bool   `json:"nsfw,omitempty"`
+	Spoiler bool   `json:"spoiler,omitempty"`
+}
+
+type contentEntry struct {
+	PostID  uint32          `json:"post"`
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+type trashEntry struct {
+	PostID    uint32     `json:"post"`
+	DeletedAt string     `json:"deletedAt,omitempty"`
+	DeletedBy *user.User `json:"deletedBy,omitempty"`
+}
+
+func NewDurablePostsRepo(j *journal.Journal) (*DurablePostsRepo, error) {
+	repo := &DurablePostsRepo{
+		PostsDataRepo: NewPostsRepo(),
+		mu:            &sync.Mutex{},
+		journal:       j,
+	}
+
+	err := j.Load(repo.restore, repo.apply)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (dr *DurablePostsRepo) restore(state json.RawMessage) error {
+	snap := &postsSnapshot{}
+	if err := json.Unmarshal(state, snap); err != nil {
+		return err
+	}
+	for _, p := range snap.Data {
+		for _, v := range p.Votes {
+			v.PostID = p.ID
+		}
+		p.Hot = HotScore(p)
+	}
+	dr.LastID = snap.LastID
+	dr.Data = snap.Data
+	dr.tagged = make(map[string][]*Post)
+	for _, p := range dr.Data {
+		dr.index(p)
+	}
+	if snap.Revisions != nil {
+		dr.Revisions = snap.Revisions
+	}
+	return nil
+}
+
+func (dr *DurablePostsRepo) apply(op string, data json.RawMessage) error {
+	switch op {
+	case opCreate:
+		p := &Post{}
+		if err := json.Unmarshal(data, p); err != nil {
+			return err
+		}
+		dr.Data = append(dr.Data, p)
+		dr.index(p)
+		dr.LastID = p.ID
+		return nil
+	case opTrash, opRestore:
+		// replayed by hand to keep the logged deletion time
+		e := &trashEntry{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return err
+		}
+		detect := dr.find(e.PostID)
+		if detect < 0 {
+			return ErrNoPost
+		}
+		dr.change(detect, func(p *Post) {
+			p.DeletedAt = e.DeletedAt
+			p.DeletedBy = e.DeletedBy
+		})
+		return nil
+	case opUpdate:
+		e := &updateEntry{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return err
+		}
+		detect := dr.find(e.PostID)
+		if detect < 0 {
+			return ErrNoPost
+		}
+		dr.update(detect, e.Title, e.Data, e.Editor, e.Edited)
+		return nil
+	case opMark:
+		e := &markEntry{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return err
+		}
+		_, err := dr.PostsDataRepo.Mark(e.PostID, e.NSFW, e.Spoiler)
+		return err
+	case opContent:
+		e := &contentEntry{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return err
+		}
+		_, err := dr.PostsDataRepo.UpdateContent(e.PostID, func(*Post) (json.RawMessage, error) {
+			return e.Content, nil
+		})
+		return err
+	}
+
+	e := &voteEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return err
+	}
+	u := &user.User{ID: e.UserID}
+	var err error
+	switch op {
+	case opUpVote:
+		_, err = dr.PostsDataRepo.UpVote(e.PostID, u)
+	case opDownVote:
+		_, err = dr.PostsDataRepo.DownVote(e.PostID, u)
+	case opUnVote:
+		_, err = dr.PostsDataRepo.UnVote(e.PostID, u)
+	case opDelete:
+		_, err = dr.PostsDataRepo.Delete(e.PostID)
+	case opView:
+		_, err = dr.PostsDataRepo.IncViews(e.PostID)
+	}
+	if err != nil || e.At == "" {
+		return err
+	}
+	// keep the logged vote time, rising ranking depends on it; the vote
+	// was just made by the memory repo and is not shared yet
+	for _, v := range dr.Data[dr.find(e.PostID)].Votes {
+		if v.UserID == e.UserID {
+			v.Created = e.At
+		}
+	}
+	return nil
+}
+
+func (dr *DurablePostsRepo) Create(post *Post) (uint32, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	id, err := dr.PostsDataRepo.Create(post)
+	if err != nil {
+		return 0, err
+	}
+	return id, dr.journal.Append(opCreate, post)
+}
+
+func (dr *DurablePostsRepo) UpVote(id uint32, u *user.User) (*Post, error) {
+	return dr.vote(opUpVote, dr.PostsDataRepo.UpVote, id, u)
+}
+
+func (dr *DurablePostsRepo) DownVote(id uint32, u *user.User) (*Post, error) {
+	return dr.vote(opDownVote, dr.PostsDataRepo.DownVote, id, u)
+}
+
+func (dr *DurablePostsRepo) UnVote(id uint32, u *user.User) (*Post, error) {
+	return dr.vote(opUnVote, dr.PostsDataRepo.UnVote, id, u)
+}
+
+func (dr *DurablePostsRepo) Delete(id uint32) (bool, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	ok, err := dr.PostsDataRepo.Delete(id)
+	if err != nil {
+		return ok, err
+	}
+	return ok, dr.journal.Append(opDelete, &voteEntry{PostID: id})
+}
+
+func (dr *DurablePostsRepo) Trash(id uint32, by *user.User) (*Post, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	p, err := dr.PostsDataRepo.Trash(id, by)
+	if err != nil {
+		return nil, err
+	}
+	return p, dr.journal.Append(opTrash, &trashEntry{PostID: id, DeletedAt: p.DeletedAt, DeletedBy: p.DeletedBy})
+}
+
+func (dr *DurablePostsRepo) Restore(id uint32) (*Post, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	p, err := dr.PostsDataRepo.Restore(id)
+	if err != nil {
+		return nil, err
+	}
+	return p, dr.journal.Append(opRestore, &trashEntry{PostID: id})
+}
+
+func (dr *DurablePostsRepo) Update(id uint32, title, data string, editor *user.User) (*Post, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	p, err := dr.PostsDataRepo.Update(id, title, data, editor)
+	if err != nil {
+		return nil, err
+	}
+	return p, dr.journal.Append(opUpdate, &updateEntry{
+		PostID: id,
+		Title:  title,
+		Data:   data,
+		Editor: editor,
+		Edited: p.Edited,
+	})
+}
+
+func (dr *DurablePostsRepo) IncViews(id uint32) (*Post, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	p, err := dr.PostsDataRepo.IncViews(id)
+	if err != nil {
+		return nil, err
+	}
+	return p, dr.journal.Append(opView, &voteEntry{PostID: id})
+}
+
+func (dr *DurablePostsRepo) Mark(id uint32, nsfw, spoiler bool) (*Post, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	p, err := dr.PostsDataRepo.Mark(id, nsfw, spoiler)
+	if err != nil {
+		return nil, err
+	}
+	return p, dr.journal.Append(opMark, &markEntry{PostID: id, NSFW: nsfw, Spoiler: spoiler})
+}
+
+func (dr *DurablePostsRepo) UpdateContent(id uint32, change func(p *Post) (json.RawMessage, error)) (*Post, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	p, err := dr.PostsDataRepo.UpdateContent(id, change)
+	if err != nil {
+		return nil, err
+	}
+	return p, dr.journal.Append(opContent, &contentEntry{PostID: id, Content: p.Content})
+}
+
+func (dr *DurablePostsRepo) vote(op string, do func(uint32, *user.User) (*Post, error), id uint32, u *user.User) (*Post, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	p, err := do(id, u)
+	if err != nil {
+		return nil, err
+	}
+	e := &voteEntry{PostID: id, UserID: u.ID}
+	for _, v := range p.Votes {
+		if v.UserID == u.ID {
+			e.At = v.Created
+		}
+	}
+	return p, dr.journal.Append(op, e)
+}
+
+func (dr *DurablePostsRepo) Snapshot() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.PostsDataRepo.mu.RLock()
+	defer dr.PostsDataRepo.mu.RUnlock()
+	return dr.journal.Compact(&postsSnapshot{
+		LastID:    dr.LastID,
+		Data:      dr.Data,
+		Revisions: dr.Revisions,
+	})
+}
@@ -0,0 +1,99 @@
+package post_test
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/user"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openPosts(t *testing.T, dir string) (*post.DurablePostsRepo, *journal.Journal) {
+	t.Helper()
+	j, err := journal.Open(dir, "posts")
+	if err != nil {
+		t.Fatalf("Open journal: %v", err)
+	}
+	repo, err := post.NewDurablePostsRepo(j)
+	if err != nil {
+		t.Fatalf("NewDurablePostsRepo: %v", err)
+	}
+	return repo, j
+}
+
+// state is what a restart must keep, in json because votes are pointers.
+func postsState(t *testing.T, repo *post.DurablePostsRepo) string {
+	t.Helper()
+	raw, err := json.Marshal(struct {
+		LastID    uint32
+		Data      []*post.Post
+		Revisions map[uint32][]*post.Revision
+	}{repo.LastID, repo.Data, repo.Revisions})
+	if err != nil {
+		t.Fatalf("Marshal state: %v", err)
+	}
+	return string(raw)
+}
+
+func TestDurablePostsReplay(t *testing.T) {
+	dir := t.TempDir()
+	repo, j := openPosts(t, dir)
+	alex := &user.User{ID: 1, Username: "alex"}
+	bob := &user.User{ID: 2, Username: "bob"}
+
+	text, _ := repo.Create(&post.Post{Author: alex, Type: "text", Title: "text", Category: "music", Data: "a", Tags: []string{"go"}})
+	link, _ := repo.Create(&post.Post{Author: bob, Type: "link", Title: "link", Category: "news", Data: "https://example.com/"})
+	poll, _ := repo.Create(&post.Post{Author: alex, Type: "poll", Title: "poll?", Category: "music",
+		Content: json.RawMessage(`{"poll":{"options":["yes","no"]}}`)})
+	repo.UpVote(text, alex)
+	repo.DownVote(text, bob)
+	repo.IncViews(text)
+	if err := repo.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	// the tail of the journal after the snapshot
+	repo.UnVote(text, bob)
+	repo.IncViews(text)
+	repo.Update(text, "text 2", "b", alex)
+	repo.Mark(link, true, false)
+	repo.UpdateContent(link, func(*post.Post) (json.RawMessage, error) {
+		return json.RawMessage(`{"preview":{"title":"Example"}}`), nil
+	})
+	repo.UpdateContent(poll, func(p *post.Post) (json.RawMessage, error) {
+		return json.RawMessage(`{"poll":{"options":["yes","no"],"ballots":[1]}}`), nil
+	})
+	repo.Trash(link, bob)
+	gone, _ := repo.Create(&post.Post{Author: bob, Type: "text", Title: "gone", Category: "news"})
+	repo.Delete(gone)
+	want := postsState(t, repo)
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close journal: %v", err)
+	}
+
+	reopened, j := openPosts(t, dir)
+	if got := postsState(t, reopened); got != want {
+		t.Fatalf("Replayed state:\n got %v\nwant %v", got, want)
+	}
+	j.Close()
+
+	// a crash in the middle of a write leaves half of the last record
+	f, err := os.OpenFile(filepath.Join(dir, "posts.log"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Open log: %v", err)
+	}
+	f.WriteString(`{"seq":99,"op":"upvote","data":{"po`)
+	f.Close()
+
+	reopened, j = openPosts(t, dir)
+	defer j.Close()
+	if got := postsState(t, reopened); got != want {
+		t.Fatalf("State with a truncated record:\n got %v\nwant %v", got, want)
+	}
+	id, err := reopened.Create(&post.Post{Author: alex, Type: "text", Title: "next", Category: "music"})
+	if err != nil || id != gone+1 {
+		t.Fatalf("Create after the truncated record: got %v, %v, want %v", id, err, gone+1)
+	}
+}
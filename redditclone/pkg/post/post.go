@@ -1,6 +1,7 @@
 package post
 
 import (
+	"encoding/json"
 	"fakereddit/redditclone/pkg/comment"
 	"fakereddit/redditclone/pkg/user"
 )
@@ -21,15 +22,60 @@ type Post struct {
 	Category         string             `json:"category"`
 	Created          string             `json:"created"`
 	Comments         []*comment.Comment `json:"comments"`
-	Data             string             `json:"data"` // text/url
+	Data             string             `json:"-"` // rendered under DataKey
 	UpvotePercentage int                `json:"upvotePercentage"`
 	Votes            []*SingeVote       `json:"votes"`
+	DeletedAt        string             `json:"deletedAt,omitempty"`
+	DeletedBy        *user.User         `json:"deletedBy,omitempty"`
+	Edited           string             `json:"edited,omitempty"`
+	// Hot is the cached "hot" rank, recalculated on every vote
+	Hot float64 `json:"hot"`
+	// Flair is one of the flairs of the category
+	Flair string   `json:"flair,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	// NSFW and Spoiler are content warnings set by the author or moderators
+	NSFW    bool `json:"nsfw"`
+	Spoiler bool `json:"spoiler"`
+	// Blur asks the client to blur the post, it is set per listing by the
+	// preferences of the user and never stored
+	Blur bool `json:"blur,omitempty"`
+	// DataKey is the json key of Data, the post type sets it when the post
+	// is rendered, TextKey if empty
+	DataKey string `json:"-"`
+	// Content is what only the type of the post knows about it, a json
+	// object rendered as keys of the post. Repos store it as is.
+	Content json.RawMessage `json:"-"`
+}
+
+// Revision is one version of the post content, Author is who wrote it.
+type Revision struct {
+	Version int        `json:"version"`
+	Title   string     `json:"title"`
+	Data    string     `json:"data"`
+	Created string     `json:"created"`
+	Author  *user.User `json:"author"`
 }
 
 type SingeVote struct {
-	PostID uint32 `json:"-"`
-	UserID uint32 `json:"user"`
-	Vote   int    `json:"vote"`
+	PostID  uint32 `json:"-"`
+	UserID  uint32 `json:"user"`
+	Vote    int    `json:"vote"`
+	Created string `json:"created,omitempty"`
+}
+
+// Query is one page of a listing, newest posts first. Empty Category and
+// Author match all posts.
+type Query struct {
+	Category string
+	// Categories, if any, limit the page to posts in one of them
+	Categories []string
+	Author     string
+	// Flair and Tag, if set, limit the page to posts labeled with them
+	Flair string
+	Tag   string
+	// After is the id of the last post of the previous page, 0 for the first page
+	After uint32
+	Limit int
 }
 
 type PostsRepo interface {
@@ -42,4 +88,45 @@ type PostsRepo interface {
 	DownVote(id uint32, u *user.User) (*Post, error)
 	UnVote(id uint32, u *user.User) (*Post, error)
 	Delete(id uint32) (bool, error)
+	Trash(id uint32, by *user.User) (*Post, error)
+	Restore(id uint32) (*Post, error)
+	ReadTrash() ([]*Post, error)
+	Update(id uint32, title, data string, editor *user.User) (*Post, error)
+	ReadRevisions(id uint32) ([]*Revision, error)
+	ReadPage(q *Query) ([]*Post, error)
+	// IncViews counts one more view of the post
+	IncViews(id uint32) (*Post, error)
+	// Mark sets the content warnings of the post
+	Mark(id uint32, nsfw, spoiler bool) (*Post, error)
+	// UpdateContent replaces Content of the post with what change returns
+	// for it. change may be called again if the post changed meanwhile,
+	// it must not change p; its error is returned as is.
+	UpdateContent(id uint32, change func(p *Post) (json.RawMessage, error)) (*Post, error)
+	// ReadTag lists posts of all categories with the tag
+	ReadTag(tag string) ([]*Post, error)
+}
+
+// HasTag tells if the post is tagged with tag.
+func (p *Post) HasTag(tag string) bool {
+	for _, elem := range p.Tags {
+		if elem == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Labeled keeps the posts with the flair and the tag, empty flair and tag
+// match all posts. posts is not changed.
+func Labeled(posts []*Post, flair, tag string) []*Post {
+	if flair == "" && tag == "" {
+		return posts
+	}
+	res := make([]*Post, 0, len(posts))
+	for _, elem := range posts {
+		if (flair == "" || elem.Flair == flair) && (tag == "" || elem.HasTag(tag)) {
+			res = append(res, elem)
+		}
+	}
+	return res
 }
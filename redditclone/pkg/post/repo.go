@@ -1,30 +1,37 @@
 package post
 
 import (
+	"encoding/json"
 	"errors"
 	"fakereddit/redditclone/pkg/comment"
 	"fakereddit/redditclone/pkg/user"
 	"log"
+	"math"
 	"sort"
 	"sync"
 	"time"
 )
 
 var (
-	ErrNoPost = errors.New("no comment found")
+	ErrNoPost = errors.New("no post found")
 )
 
 type PostsDataRepo struct {
-	mu     *sync.RWMutex
-	LastID uint32
-	Data   []*Post
+	mu        *sync.RWMutex
+	LastID    uint32
+	Data      []*Post
+	Revisions map[uint32][]*Revision
+	// tagged is the tag index, posts by tag in the order of Data
+	tagged map[string][]*Post
 }
 
 func NewPostsRepo() *PostsDataRepo {
 	log.Printf("NewPostsRepo: created PostsDataRepo")
 	return &PostsDataRepo{
-		Data: make([]*Post, 0),
-		mu:   &sync.RWMutex{},
+		Data:      make([]*Post, 0),
+		Revisions: make(map[uint32][]*Revision),
+		tagged:    make(map[string][]*Post),
+		mu:        &sync.RWMutex{},
 	}
 }
 
@@ -35,53 +42,55 @@ func (pr *PostsDataRepo) Create(post *Post) (uint32, error) {
 	post.Comments = make([]*comment.Comment, 0)
 	post.Created = time.Now().Format(time.RFC3339)
 	post.Votes = make([]*SingeVote, 0)
+	post.Hot = HotScore(post)
 	pr.Data = append(pr.Data, post)
+	pr.index(post)
+	id := pr.LastID
 	pr.mu.Unlock()
-	log.Printf("Created post: %v", post.ID)
-	return pr.LastID, nil
+	log.Printf("Created post: %v", id)
+	return id, nil
 }
 
 func (pr *PostsDataRepo) ReadAll() ([]*Post, error) {
 	pr.mu.RLock()
-	data := pr.Data
-	pr.mu.RUnlock()
-	sort.Slice(data, func(i, j int) bool {
+	data := make([]*Post, 0, len(pr.Data))
+	for _, elem := range pr.Data {
+		if elem.DeletedAt == "" {
+			data = append(data, elem)
+		}
+	}
+	sort.SliceStable(data, func(i, j int) bool {
 		return data[i].Score > data[j].Score
 	})
+	pr.mu.RUnlock()
 	log.Printf("List posts")
-	return pr.Data, nil
+	return data, nil
 }
 
 func (pr *PostsDataRepo) ReadCategory(category string) ([]*Post, error) {
 	res := make([]*Post, 0)
 	pr.mu.RLock()
 	for _, elem := range pr.Data {
-		if elem.Category == category {
+		if elem.Category == category && elem.DeletedAt == "" {
 			res = append(res, elem)
 		}
 	}
-	log.Printf("ReadCategory: '%v'", category)
-	pr.mu.RUnlock()
-	sort.Slice(res, func(i, j int) bool {
+	sort.SliceStable(res, func(i, j int) bool {
 		return res[i].Score > res[j].Score
 	})
+	pr.mu.RUnlock()
+	log.Printf("ReadCategory: '%v'", category)
 	return res, nil
 }
 
 func (pr *PostsDataRepo) Read(id uint32) (*Post, error) {
-	detect := -1
 	pr.mu.RLock()
-	for idx, elem := range pr.Data {
-		if elem.ID == id {
-			detect = idx
-			break
-		}
-	}
+	defer pr.mu.RUnlock()
+	detect := pr.find(id)
 	if detect < 0 {
 		log.Printf("ERROR: No post: '%v'", id)
 		return nil, ErrNoPost
 	}
-	pr.mu.RUnlock()
 	log.Printf("Read post: '%v'", id)
 	return pr.Data[detect], nil
 }
@@ -90,165 +99,386 @@ func (pr *PostsDataRepo) ReadUser(login string) ([]*Post, error) {
 	res := make([]*Post, 0)
 	pr.mu.RLock()
 	for _, elem := range pr.Data {
-		if elem.Author.Username == login {
+		if elem.Author.Username == login && elem.DeletedAt == "" {
 			res = append(res, elem)
 		}
 	}
-	log.Printf("ReadUser: '%v'", login)
-	pr.mu.RUnlock()
-	sort.Slice(res, func(i, j int) bool {
+	sort.SliceStable(res, func(i, j int) bool {
 		return res[i].Score > res[j].Score
 	})
+	pr.mu.RUnlock()
+	log.Printf("ReadUser: '%v'", login)
 	return res, nil
 }
 
 func (pr *PostsDataRepo) UpVote(id uint32, u *user.User) (*Post, error) {
-	pr.mu.RLock()
-	detect := -1
-	for idx, elem := range pr.Data {
-		if elem.ID == id {
-			detect = idx
-			break
-		}
-	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
 
 	if detect < 0 {
 		log.Printf("UpVote: no post '%v'", id)
 		return nil, ErrNoPost
 	}
 
-	voteIdx := -1
-	for idx, elem := range pr.Data[detect].Votes {
-		if elem.UserID == u.ID {
-			voteIdx = idx
-			break
-		}
+	p := pr.change(detect, func(p *Post) { vote(p, u, UpVote) })
+	log.Printf("UpVoted: post_'%v'", id)
+	return p, nil
+}
+
+func (pr *PostsDataRepo) UnVote(id uint32, u *user.User) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+
+	if detect < 0 {
+		log.Printf("UnVote: no post '%v'", id)
+		return nil, ErrNoPost
 	}
 
+	voteIdx := findVote(pr.Data[detect], u.ID)
 	if voteIdx < 0 {
-		pr.Data[detect].Votes = append(pr.Data[detect].Votes,
-			&SingeVote{
-				Vote:   UpVote,
-				UserID: u.ID,
-				PostID: id,
-			})
-		pr.Data[detect].Score++
-		pr.Data[detect].UpvotePercentage = UpVotePer(pr.Data[detect])
-	} else {
-		pr.Data[detect].Votes[voteIdx].Vote = UpVote
-		pr.Data[detect].Score = SetScore(pr.Data[detect])
-		pr.Data[detect].UpvotePercentage = UpVotePer(pr.Data[detect])
+		log.Printf("UnVote: no vote of user '%v' for post '%v'", u.ID, id)
+		return pr.Data[detect], nil
 	}
 
-	log.Printf("UpVoted: post_'%v'", id)
+	p := pr.change(detect, func(p *Post) {
+		p.Votes = append(p.Votes[:voteIdx], p.Votes[voteIdx+1:]...)
+		p.Score = SetScore(p)
+		p.UpvotePercentage = UpVotePer(p)
+		p.Hot = HotScore(p)
+	})
+	log.Printf("UnVoted: post_'%v'", id)
+	return p, nil
+}
 
-	pr.mu.RUnlock()
-	return pr.Data[detect], nil
+func (pr *PostsDataRepo) DownVote(id uint32, u *user.User) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+
+	if detect < 0 {
+		log.Printf("DownVote: no post '%v'", id)
+		return nil, ErrNoPost
+	}
+
+	p := pr.change(detect, func(p *Post) { vote(p, u, DownVote) })
+	log.Printf("DownVoted: post_'%v'", id)
+	return p, nil
 }
 
-func (pr *PostsDataRepo) UnVote(id uint32, u *user.User) (*Post, error) {
-	pr.mu.RLock()
-	detect := -1
-	for idx, elem := range pr.Data {
-		if elem.ID == id {
-			detect = idx
-			break
+// vote puts or changes the vote of the user on p, a copy made by change.
+func vote(p *Post, u *user.User, value int) {
+	voted := &SingeVote{
+		Vote:    value,
+		UserID:  u.ID,
+		PostID:  p.ID,
+		Created: time.Now().Format(time.RFC3339),
+	}
+	if voteIdx := findVote(p, u.ID); voteIdx < 0 {
+		p.Votes = append(p.Votes, voted)
+	} else {
+		p.Votes[voteIdx] = voted
+	}
+	p.Score = SetScore(p)
+	p.UpvotePercentage = UpVotePer(p)
+	p.Hot = HotScore(p)
+}
+
+func findVote(p *Post, userID uint32) int {
+	for idx, elem := range p.Votes {
+		if elem.UserID == userID {
+			return idx
 		}
 	}
+	return -1
+}
 
+func (pr *PostsDataRepo) Delete(id uint32) (bool, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
 	if detect < 0 {
-		log.Printf("UnVote: no post '%v'", id)
+		log.Printf("Post Delete, can't find post %v", id)
+		return false, ErrNoPost
+	}
+
+	pr.unindex(pr.Data[detect])
+	if detect < len(pr.Data)-1 {
+		copy(pr.Data[detect:], pr.Data[detect+1:])
+	}
+	pr.Data[len(pr.Data)-1] = nil
+	pr.Data = pr.Data[:len(pr.Data)-1]
+	delete(pr.Revisions, id)
+	log.Printf("Deleted post: post_%v", id)
+	return true, nil
+}
+
+// Trash marks the post as deleted, it stays readable by id but leaves all listings.
+func (pr *PostsDataRepo) Trash(id uint32, by *user.User) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+	if detect < 0 {
+		log.Printf("Trash: no post '%v'", id)
 		return nil, ErrNoPost
 	}
+	p := pr.Data[detect]
+	if p.DeletedAt == "" {
+		p = pr.change(detect, func(p *Post) {
+			p.DeletedAt = time.Now().Format(time.RFC3339)
+			p.DeletedBy = by
+		})
+	}
+	log.Printf("Trashed post: post_%v", id)
+	return p, nil
+}
 
-	voteIdx := -1
-	for idx, elem := range pr.Data[detect].Votes {
-		if elem.UserID == u.ID {
-			voteIdx = idx
-			break
+func (pr *PostsDataRepo) Restore(id uint32) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+	if detect < 0 {
+		log.Printf("Restore: no post '%v'", id)
+		return nil, ErrNoPost
+	}
+	p := pr.change(detect, func(p *Post) {
+		p.DeletedAt = ""
+		p.DeletedBy = nil
+	})
+	log.Printf("Restored post: post_%v", id)
+	return p, nil
+}
+
+func (pr *PostsDataRepo) ReadTrash() ([]*Post, error) {
+	res := make([]*Post, 0)
+	pr.mu.RLock()
+	for _, elem := range pr.Data {
+		if elem.DeletedAt != "" {
+			res = append(res, elem)
 		}
 	}
+	pr.mu.RUnlock()
+	log.Printf("ReadTrash")
+	return res, nil
+}
 
-	if voteIdx < len(pr.Data[detect].Votes)-1 {
-		copy(pr.Data[detect].Votes[voteIdx:], pr.Data[detect].Votes[voteIdx+1:])
+// Update replaces title and data of the post, the previous versions are
+// kept as revisions.
+func (pr *PostsDataRepo) Update(id uint32, title, data string, editor *user.User) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+	if detect < 0 {
+		log.Printf("Update: no post '%v'", id)
+		return nil, ErrNoPost
 	}
-	pr.Data[detect].Votes[len(pr.Data[detect].Votes)-1] = nil
-	pr.Data[detect].Votes = pr.Data[detect].Votes[:len(pr.Data[detect].Votes)-1]
+	p := pr.update(detect, title, data, editor, time.Now().Format(time.RFC3339))
+	log.Printf("Updated post: post_%v", id)
+	return p, nil
+}
 
-	pr.Data[detect].Score = SetScore(pr.Data[detect])
-	pr.Data[detect].UpvotePercentage = UpVotePer(pr.Data[detect])
-	log.Printf("UnVoted: post_'%v'", id)
+func (pr *PostsDataRepo) IncViews(id uint32) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+	if detect < 0 {
+		log.Printf("IncViews: no post '%v'", id)
+		return nil, ErrNoPost
+	}
+	return pr.change(detect, func(p *Post) { p.Views++ }), nil
+}
 
-	pr.mu.RUnlock()
-	return pr.Data[detect], nil
+func (pr *PostsDataRepo) Mark(id uint32, nsfw, spoiler bool) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+	if detect < 0 {
+		log.Printf("Mark: no post '%v'", id)
+		return nil, ErrNoPost
+	}
+	p := pr.change(detect, func(p *Post) {
+		p.NSFW = nsfw
+		p.Spoiler = spoiler
+	})
+	log.Printf("Marked post: post_%v nsfw %v spoiler %v", id, nsfw, spoiler)
+	return p, nil
 }
 
-func (pr *PostsDataRepo) DownVote(id uint32, u *user.User) (*Post, error) {
-	pr.mu.RLock()
-	detect := -1
-	for idx, elem := range pr.Data {
-		if elem.ID == id {
-			detect = idx
-			break
-		}
+func (pr *PostsDataRepo) UpdateContent(id uint32, change func(p *Post) (json.RawMessage, error)) (*Post, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	detect := pr.find(id)
+	if detect < 0 {
+		log.Printf("UpdateContent: no post '%v'", id)
+		return nil, ErrNoPost
+	}
+	content, err := change(pr.Data[detect])
+	if err != nil {
+		return nil, err
 	}
+	p := pr.change(detect, func(p *Post) { p.Content = content })
+	log.Printf("UpdateContent: post_%v", id)
+	return p, nil
+}
 
+// ReadRevisions returns all versions of the post, the current one last.
+func (pr *PostsDataRepo) ReadRevisions(id uint32) ([]*Revision, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	detect := pr.find(id)
 	if detect < 0 {
-		log.Printf("DownVote: no post '%v'", id)
+		log.Printf("ReadRevisions: no post '%v'", id)
 		return nil, ErrNoPost
 	}
+	revs := pr.Revisions[id]
+	if len(revs) == 0 {
+		revs = []*Revision{firstRevision(pr.Data[detect])}
+	}
+	res := make([]*Revision, len(revs))
+	copy(res, revs)
+	return res, nil
+}
 
-	voteIdx := -1
-	for idx, elem := range pr.Data[detect].Votes {
-		if elem.UserID == u.ID {
-			voteIdx = idx
-			break
-		}
+// update changes the post at idx like change does, the caller holds mu.
+func (pr *PostsDataRepo) update(idx int, title, data string, editor *user.User, at string) *Post {
+	p := pr.Data[idx]
+	revs := pr.Revisions[p.ID]
+	if len(revs) == 0 {
+		revs = append(revs, firstRevision(p))
 	}
+	pr.Revisions[p.ID] = append(revs, &Revision{
+		Version: len(revs) + 1,
+		Title:   title,
+		Data:    data,
+		Created: at,
+		Author:  editor,
+	})
+	return pr.change(idx, func(p *Post) {
+		p.Title = title
+		p.Data = data
+		p.Edited = at
+	})
+}
 
-	if voteIdx < 0 {
-		pr.Data[detect].Votes = append(pr.Data[detect].Votes,
-			&SingeVote{
-				Vote:   DownVote,
-				UserID: u.ID,
-				PostID: id,
-			})
-		pr.Data[detect].Score = SetScore(pr.Data[detect])
-		pr.Data[detect].UpvotePercentage = UpVotePer(pr.Data[detect])
-	} else {
-		pr.Data[detect].Votes[voteIdx].Vote = DownVote
-		pr.Data[detect].Score = SetScore(pr.Data[detect])
-		pr.Data[detect].UpvotePercentage = UpVotePer(pr.Data[detect])
+// change replaces the post at idx with a copy changed by do, so that posts
+// handed out before keep the old version and can be read without mu.
+// Votes are copied too, do replaces a vote instead of changing it. The
+// caller holds mu.
+func (pr *PostsDataRepo) change(idx int, do func(p *Post)) *Post {
+	changed := *pr.Data[idx]
+	changed.Votes = append(make([]*SingeVote, 0, len(changed.Votes)), changed.Votes...)
+	do(&changed)
+	pr.Data[idx] = &changed
+	pr.reindex(&changed)
+	return &changed
+}
+
+func firstRevision(p *Post) *Revision {
+	return &Revision{
+		Version: 1,
+		Title:   p.Title,
+		Data:    p.Data,
+		Created: p.Created,
+		Author:  p.Author,
 	}
+}
 
-	log.Printf("DownVoted: post_'%v'", id)
+// ReadPage walks Data backwards, ids grow with every new post.
+func (pr *PostsDataRepo) ReadPage(q *Query) ([]*Post, error) {
+	res := make([]*Post, 0, q.Limit)
+	pr.mu.RLock()
+	for idx := len(pr.Data) - 1; idx >= 0 && len(res) < q.Limit; idx-- {
+		elem := pr.Data[idx]
+		if q.After != 0 && elem.ID >= q.After {
+			continue
+		}
+		if elem.DeletedAt != "" ||
+			q.Category != "" && elem.Category != q.Category ||
+			len(q.Categories) > 0 && !contains(q.Categories, elem.Category) ||
+			q.Author != "" && elem.Author.Username != q.Author ||
+			q.Flair != "" && elem.Flair != q.Flair ||
+			q.Tag != "" && !elem.HasTag(q.Tag) {
+			continue
+		}
+		res = append(res, elem)
+	}
 	pr.mu.RUnlock()
-	return pr.Data[detect], nil
+	log.Printf("ReadPage: %+v", *q)
+	return res, nil
 }
 
-func (pr *PostsDataRepo) Delete(id uint32) (bool, error) {
-	pr.mu.Lock()
-	detect := -1
-	for idx, elem := range pr.Data {
-		if elem.ID == id {
-			detect = idx
+func (pr *PostsDataRepo) ReadTag(tag string) ([]*Post, error) {
+	res := make([]*Post, 0)
+	pr.mu.RLock()
+	for _, elem := range pr.tagged[tag] {
+		if elem.DeletedAt == "" {
+			res = append(res, elem)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score
+	})
+	pr.mu.RUnlock()
+	log.Printf("ReadTag: '%v'", tag)
+	return res, nil
+}
+
+// index adds the post to the tag index, the caller holds mu.
+func (pr *PostsDataRepo) index(p *Post) {
+	for _, tag := range p.Tags {
+		pr.tagged[tag] = append(pr.tagged[tag], p)
+	}
+}
+
+// reindex points the tag index at the new copy of the post, the caller
+// holds mu.
+func (pr *PostsDataRepo) reindex(p *Post) {
+	for _, tag := range p.Tags {
+		for idx, elem := range pr.tagged[tag] {
+			if elem.ID == p.ID {
+				pr.tagged[tag][idx] = p
+				break
+			}
+		}
+	}
+}
+
+// unindex removes the post from the tag index, the caller holds mu.
+func (pr *PostsDataRepo) unindex(p *Post) {
+	for _, tag := range p.Tags {
+		list := pr.tagged[tag]
+		for idx, elem := range list {
+			if elem.ID == p.ID {
+				list = append(list[:idx:idx], list[idx+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(pr.tagged, tag)
 			continue
 		}
+		pr.tagged[tag] = list
 	}
+}
 
-	if detect < 0 {
-		log.Printf("Post Delete, can't find post %v", id)
-		return false, ErrNoPost
+func contains(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
 	}
+	return false
+}
 
-	if detect < len(pr.Data)-1 {
-		copy(pr.Data[detect:], pr.Data[detect+1:])
+// find returns the index of the post in Data or -1, the caller holds mu.
+func (pr *PostsDataRepo) find(id uint32) int {
+	for idx, elem := range pr.Data {
+		if elem.ID == id {
+			return idx
+		}
 	}
-	pr.Data[len(pr.Data)-1] = nil
-	pr.Data = pr.Data[:len(pr.Data)-1]
-	pr.mu.Unlock()
-	log.Printf("Deleted post: post_%v", id)
-	return true, nil
+	return -1
 }
 
 func UpVotePer(p *Post) int {
@@ -278,3 +508,25 @@ func SetScore(p *Post) int {
 
 	return count
 }
+
+// hotEpoch is the start of the "hot" time scale, 2005-12-08
+const hotEpoch = 1134028003
+
+// HotScore is the reddit "hot" rank: every 12.5 hours of age weigh as
+// much as tenfold score. It changes only with the score, so repos keep
+// it in Post.Hot instead of calculating it for every listing.
+func HotScore(p *Post) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(p.Score)), 1))
+	sign := 0.0
+	if p.Score > 0 {
+		sign = 1
+	} else if p.Score < 0 {
+		sign = -1
+	}
+	created, err := time.Parse(time.RFC3339, p.Created)
+	if err != nil {
+		return sign * order
+	}
+	seconds := float64(created.Unix() - hotEpoch)
+	return math.Round((sign*order+seconds/45000)*1e7) / 1e7
+}
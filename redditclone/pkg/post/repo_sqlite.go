@@ -0,0 +1,635 @@
+package post
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/sqlite"
+	"fakereddit/redditclone/pkg/user"
+	"log"
+	"strings"
+	"time"
+)
+
+const postsSchema = `
+CREATE TABLE IF NOT EXISTS posts (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	author_id         INTEGER NOT NULL REFERENCES users (id),
+	type              TEXT    NOT NULL,
+	title             TEXT    NOT NULL,
+	category          TEXT    NOT NULL,
+	data              TEXT    NOT NULL,
+	created           TEXT    NOT NULL,
+	views             INTEGER NOT NULL DEFAULT 0,
+	score             INTEGER NOT NULL DEFAULT 0,
+	upvote_percentage INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS posts_category ON posts (category);
+CREATE INDEX IF NOT EXISTS posts_author ON posts (author_id);
+
+CREATE TABLE IF NOT EXISTS votes (
+	post_id INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	vote    INTEGER NOT NULL,
+	PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+	post_id   INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	version   INTEGER NOT NULL,
+	title     TEXT    NOT NULL,
+	data      TEXT    NOT NULL,
+	created   TEXT    NOT NULL,
+	editor_id INTEGER NOT NULL REFERENCES users (id),
+	PRIMARY KEY (post_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+	post_id INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	tag     TEXT    NOT NULL,
+	PRIMARY KEY (post_id, tag)
+);
+CREATE INDEX IF NOT EXISTS post_tags_tag ON post_tags (tag);
+`
+
+// columns added after the first schema version
+var postsColumns = [][2]string{
+	{"deleted_at", "TEXT NOT NULL DEFAULT ''"},
+	{"deleted_by", "INTEGER REFERENCES users (id)"},
+	{"edited", "TEXT NOT NULL DEFAULT ''"},
+	{"hot", "REAL NOT NULL DEFAULT 0"},
+	{"flair", "TEXT NOT NULL DEFAULT ''"},
+	{"nsfw", "INTEGER NOT NULL DEFAULT 0"},
+	{"spoiler", "INTEGER NOT NULL DEFAULT 0"},
+	// content is the json object of the post type, '' for posts without one
+	{"content", "TEXT NOT NULL DEFAULT ''"},
+}
+
+var votesColumns = [][2]string{
+	{"created", "TEXT NOT NULL DEFAULT ''"},
+}
+
+const selectPosts = `
+SELECT p.id, p.type, p.title, p.category, p.data, p.created, p.views, p.score, p.upvote_percentage, u.id, u.username,
+	p.deleted_at, d.id, d.username, p.edited, p.hot, p.flair, p.nsfw, p.spoiler, p.content
+FROM posts p JOIN users u ON u.id = p.author_id LEFT JOIN users d ON d.id = p.deleted_by`
+
+type PostsSQLiteRepo struct {
+	db *sql.DB
+}
+
+func NewPostsSQLiteRepo(db *sql.DB) (*PostsSQLiteRepo, error) {
+	if _, err := db.Exec(postsSchema); err != nil {
+		return nil, err
+	}
+	for _, col := range postsColumns {
+		if err := sqlite.AddColumn(db, "posts", col[0], col[1]); err != nil {
+			return nil, err
+		}
+	}
+	for _, col := range votesColumns {
+		if err := sqlite.AddColumn(db, "votes", col[0], col[1]); err != nil {
+			return nil, err
+		}
+	}
+	pr := &PostsSQLiteRepo{db: db}
+	if err := pr.fillHot(); err != nil {
+		return nil, err
+	}
+	log.Printf("NewPostsSQLiteRepo: created PostsSQLiteRepo")
+	return pr, nil
+}
+
+// fillHot calculates the hot rank of posts created before the column was
+// added, a real hot rank is never 0.
+func (pr *PostsSQLiteRepo) fillHot() error {
+	rows, err := pr.db.Query(`SELECT id, score, created FROM posts WHERE hot = 0`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	posts := make([]*Post, 0)
+	for rows.Next() {
+		p := &Post{}
+		if err = rows.Scan(&p.ID, &p.Score, &p.Created); err != nil {
+			return err
+		}
+		posts = append(posts, p)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, p := range posts {
+		if _, err = pr.db.Exec(`UPDATE posts SET hot = ? WHERE id = ?`, HotScore(p), p.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pr *PostsSQLiteRepo) Create(post *Post) (uint32, error) {
+	post.Comments = make([]*comment.Comment, 0)
+	post.Created = time.Now().Format(time.RFC3339)
+	post.Votes = make([]*SingeVote, 0)
+	post.Hot = HotScore(post)
+
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO posts (author_id, type, title, category, data, created, views, score, upvote_percentage, hot, flair, nsfw, spoiler, content)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		post.Author.ID, post.Type, post.Title, post.Category, post.Data, post.Created,
+		post.Views, post.Score, post.UpvotePercentage, post.Hot, post.Flair, post.NSFW, post.Spoiler, string(post.Content))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, tag := range post.Tags {
+		if _, err = tx.Exec(`INSERT OR IGNORE INTO post_tags (post_id, tag) VALUES (?, ?)`, id, tag); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	post.ID = uint32(id)
+	log.Printf("Created post: %v", post.ID)
+	return post.ID, nil
+}
+
+func (pr *PostsSQLiteRepo) ReadAll() ([]*Post, error) {
+	log.Printf("List posts")
+	return pr.query(selectPosts + ` WHERE p.deleted_at = '' ORDER BY p.score DESC, p.id`)
+}
+
+func (pr *PostsSQLiteRepo) ReadCategory(category string) ([]*Post, error) {
+	log.Printf("ReadCategory: '%v'", category)
+	return pr.query(selectPosts+` WHERE p.category = ? AND p.deleted_at = '' ORDER BY p.score DESC, p.id`, category)
+}
+
+func (pr *PostsSQLiteRepo) Read(id uint32) (*Post, error) {
+	res, err := pr.query(selectPosts+` WHERE p.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		log.Printf("ERROR: No post: '%v'", id)
+		return nil, ErrNoPost
+	}
+	log.Printf("Read post: '%v'", id)
+	return res[0], nil
+}
+
+func (pr *PostsSQLiteRepo) ReadUser(login string) ([]*Post, error) {
+	log.Printf("ReadUser: '%v'", login)
+	return pr.query(selectPosts+` WHERE u.username = ? AND p.deleted_at = '' ORDER BY p.score DESC, p.id`, login)
+}
+
+func (pr *PostsSQLiteRepo) UpVote(id uint32, u *user.User) (*Post, error) {
+	err := pr.vote(id, u, UpVote)
+	if err != nil {
+		log.Printf("UpVote: post '%v': %v", id, err)
+		return nil, err
+	}
+	log.Printf("UpVoted: post_'%v'", id)
+	return pr.Read(id)
+}
+
+func (pr *PostsSQLiteRepo) DownVote(id uint32, u *user.User) (*Post, error) {
+	err := pr.vote(id, u, DownVote)
+	if err != nil {
+		log.Printf("DownVote: post '%v': %v", id, err)
+		return nil, err
+	}
+	log.Printf("DownVoted: post_'%v'", id)
+	return pr.Read(id)
+}
+
+func (pr *PostsSQLiteRepo) UnVote(id uint32, u *user.User) (*Post, error) {
+	err := pr.vote(id, u, NoVote)
+	if err != nil {
+		log.Printf("UnVote: post '%v': %v", id, err)
+		return nil, err
+	}
+	log.Printf("UnVoted: post_'%v'", id)
+	return pr.Read(id)
+}
+
+func (pr *PostsSQLiteRepo) Delete(id uint32) (bool, error) {
+	res, err := pr.db.Exec(`DELETE FROM posts WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		log.Printf("Post Delete, can't find post %v", id)
+		return false, ErrNoPost
+	}
+	log.Printf("Deleted post: post_%v", id)
+	return true, nil
+}
+
+func (pr *PostsSQLiteRepo) Trash(id uint32, by *user.User) (*Post, error) {
+	_, err := pr.db.Exec(`UPDATE posts SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at = ''`,
+		time.Now().Format(time.RFC3339), by.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pr.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Trashed post: post_%v", id)
+	return p, nil
+}
+
+func (pr *PostsSQLiteRepo) Restore(id uint32) (*Post, error) {
+	_, err := pr.db.Exec(`UPDATE posts SET deleted_at = '', deleted_by = NULL WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pr.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Restored post: post_%v", id)
+	return p, nil
+}
+
+func (pr *PostsSQLiteRepo) ReadTrash() ([]*Post, error) {
+	log.Printf("ReadTrash")
+	return pr.query(selectPosts + ` WHERE p.deleted_at != '' ORDER BY p.id`)
+}
+
+// Update replaces title and data of the post, the first edit also stores
+// the original version so that revisions always start with v1.
+func (pr *PostsSQLiteRepo) Update(id uint32, title, data string, editor *user.User) (*Post, error) {
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM post_revisions WHERE post_id = ?`, id).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		res, err := tx.Exec(`INSERT INTO post_revisions (post_id, version, title, data, created, editor_id)
+			SELECT id, 1, title, data, created, author_id FROM posts WHERE id = ?`, id)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			log.Printf("Update: no post '%v'", id)
+			return nil, ErrNoPost
+		}
+		count = 1
+	}
+
+	edited := time.Now().Format(time.RFC3339)
+	_, err = tx.Exec(`INSERT INTO post_revisions (post_id, version, title, data, created, editor_id)
+		VALUES (?, ?, ?, ?, ?, ?)`, id, count+1, title, data, edited, editor.ID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE posts SET title = ?, data = ?, edited = ? WHERE id = ?`, title, data, edited, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	log.Printf("Updated post: post_%v", id)
+	return pr.Read(id)
+}
+
+func (pr *PostsSQLiteRepo) ReadRevisions(id uint32) ([]*Revision, error) {
+	p, err := pr.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := pr.db.Query(`SELECT r.version, r.title, r.data, r.created, u.id, u.username
+		FROM post_revisions r JOIN users u ON u.id = r.editor_id
+		WHERE r.post_id = ? ORDER BY r.version`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Revision, 0)
+	for rows.Next() {
+		r := &Revision{Author: &user.User{}}
+		err = rows.Scan(&r.Version, &r.Title, &r.Data, &r.Created, &r.Author.ID, &r.Author.Username)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		res = append(res, firstRevision(p))
+	}
+	log.Printf("ReadRevisions: post_%v", id)
+	return res, nil
+}
+
+func (pr *PostsSQLiteRepo) ReadPage(q *Query) ([]*Post, error) {
+	where := ` WHERE p.deleted_at = ''`
+	args := make([]interface{}, 0, 4)
+	if q.Category != "" {
+		where += ` AND p.category = ?`
+		args = append(args, q.Category)
+	}
+	if len(q.Categories) > 0 {
+		where += ` AND p.category IN (?` + strings.Repeat(`, ?`, len(q.Categories)-1) + `)`
+		for _, elem := range q.Categories {
+			args = append(args, elem)
+		}
+	}
+	if q.Author != "" {
+		where += ` AND u.username = ?`
+		args = append(args, q.Author)
+	}
+	if q.Flair != "" {
+		where += ` AND p.flair = ?`
+		args = append(args, q.Flair)
+	}
+	if q.Tag != "" {
+		where += ` AND p.id IN (SELECT post_id FROM post_tags WHERE tag = ?)`
+		args = append(args, q.Tag)
+	}
+	if q.After != 0 {
+		where += ` AND p.id < ?`
+		args = append(args, q.After)
+	}
+	args = append(args, q.Limit)
+	log.Printf("ReadPage: %+v", *q)
+	return pr.query(selectPosts+where+` ORDER BY p.id DESC LIMIT ?`, args...)
+}
+
+// vote stores the user's vote (NoVote removes it) and recalculates
+// score and upvote percentage of the post in one transaction.
+func (pr *PostsSQLiteRepo) vote(id uint32, u *user.User, vote int) error {
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	p := &Post{}
+	err = tx.QueryRow(`SELECT created FROM posts WHERE id = ?`, id).Scan(&p.Created)
+	if err == sql.ErrNoRows {
+		return ErrNoPost
+	}
+	if err != nil {
+		return err
+	}
+
+	if vote == NoVote {
+		_, err = tx.Exec(`DELETE FROM votes WHERE post_id = ? AND user_id = ?`, id, u.ID)
+	} else {
+		_, err = tx.Exec(`INSERT INTO votes (post_id, user_id, vote, created) VALUES (?, ?, ?, ?)
+			ON CONFLICT (post_id, user_id) DO UPDATE SET vote = excluded.vote, created = excluded.created`,
+			id, u.ID, vote, time.Now().Format(time.RFC3339))
+	}
+	if err != nil {
+		return err
+	}
+
+	p.Votes, err = readVotes(tx, id)
+	if err != nil {
+		return err
+	}
+	p.Score = SetScore(p)
+	_, err = tx.Exec(`UPDATE posts SET score = ?, upvote_percentage = ?, hot = ? WHERE id = ?`,
+		p.Score, UpVotePer(p), HotScore(p), id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (pr *PostsSQLiteRepo) query(q string, args ...interface{}) ([]*Post, error) {
+	rows, err := pr.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Post, 0)
+	for rows.Next() {
+		p := &Post{
+			Author:   &user.User{},
+			Comments: make([]*comment.Comment, 0),
+		}
+		var (
+			deletedByID   sql.NullInt64
+			deletedByName sql.NullString
+			content       string
+		)
+		err = rows.Scan(&p.ID, &p.Type, &p.Title, &p.Category, &p.Data, &p.Created,
+			&p.Views, &p.Score, &p.UpvotePercentage, &p.Author.ID, &p.Author.Username,
+			&p.DeletedAt, &deletedByID, &deletedByName, &p.Edited, &p.Hot, &p.Flair, &p.NSFW, &p.Spoiler, &content)
+		if err != nil {
+			return nil, err
+		}
+		if deletedByID.Valid {
+			p.DeletedBy = &user.User{ID: uint32(deletedByID.Int64), Username: deletedByName.String}
+		}
+		if content != "" {
+			p.Content = json.RawMessage(content)
+		}
+		res = append(res, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// votes and tags are read for maxIDs posts at once, not per post
+	for start := 0; start < len(res); start += maxIDs {
+		end := start + maxIDs
+		if end > len(res) {
+			end = len(res)
+		}
+		if err = readPostsVotes(pr.db, res[start:end]); err != nil {
+			return nil, err
+		}
+		if err = readPostsTags(pr.db, res[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (pr *PostsSQLiteRepo) IncViews(id uint32) (*Post, error) {
+	res, err := pr.db.Exec(`UPDATE posts SET views = views + 1 WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		log.Printf("IncViews: no post '%v'", id)
+		return nil, ErrNoPost
+	}
+	return pr.Read(id)
+}
+
+func (pr *PostsSQLiteRepo) Mark(id uint32, nsfw, spoiler bool) (*Post, error) {
+	res, err := pr.db.Exec(`UPDATE posts SET nsfw = ?, spoiler = ? WHERE id = ?`, nsfw, spoiler, id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		log.Printf("Mark: no post '%v'", id)
+		return nil, ErrNoPost
+	}
+	log.Printf("Marked post: post_%v nsfw %v spoiler %v", id, nsfw, spoiler)
+	return pr.Read(id)
+}
+
+// UpdateContent writes the new content only if the post is still the one
+// change saw, otherwise it reads the post and asks again.
+func (pr *PostsSQLiteRepo) UpdateContent(id uint32, change func(p *Post) (json.RawMessage, error)) (*Post, error) {
+	for {
+		p, err := pr.Read(id)
+		if err != nil {
+			return nil, err
+		}
+		content, err := change(p)
+		if err != nil {
+			return nil, err
+		}
+		res, err := pr.db.Exec(`UPDATE posts SET content = ? WHERE id = ? AND content = ? AND data = ?`,
+			string(content), id, string(p.Content), p.Data)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			log.Printf("UpdateContent: post_%v", id)
+			return pr.Read(id)
+		}
+	}
+}
+
+func (pr *PostsSQLiteRepo) ReadTag(tag string) ([]*Post, error) {
+	log.Printf("ReadTag: '%v'", tag)
+	return pr.query(selectPosts+` JOIN post_tags t ON t.post_id = p.id
+		WHERE t.tag = ? AND p.deleted_at = '' ORDER BY p.score DESC, p.id`, tag)
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func readVotes(q querier, postID uint32) ([]*SingeVote, error) {
+	rows, err := q.Query(`SELECT user_id, vote, created FROM votes WHERE post_id = ? ORDER BY rowid`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*SingeVote, 0)
+	for rows.Next() {
+		v := &SingeVote{PostID: postID}
+		if err = rows.Scan(&v.UserID, &v.Vote, &v.Created); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
+
+// maxIDs is how many posts one IN list holds, older SQLite builds allow
+// 999 parameters a query.
+const maxIDs = 500
+
+// inPosts returns the IN list of the ids of posts with its args, and the
+// posts by id.
+func inPosts(posts []*Post) (string, []interface{}, map[uint32]*Post) {
+	args := make([]interface{}, len(posts))
+	byID := make(map[uint32]*Post, len(posts))
+	for idx, p := range posts {
+		args[idx] = p.ID
+		byID[p.ID] = p
+	}
+	return `(?` + strings.Repeat(`, ?`, len(posts)-1) + `)`, args, byID
+}
+
+// readPostsVotes sets the votes of the posts with one query, like readVotes
+// does for one post.
+func readPostsVotes(q querier, posts []*Post) error {
+	in, args, byID := inPosts(posts)
+	for _, p := range posts {
+		p.Votes = make([]*SingeVote, 0)
+	}
+	rows, err := q.Query(`SELECT post_id, user_id, vote, created FROM votes WHERE post_id IN `+in+` ORDER BY rowid`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v := &SingeVote{}
+		if err = rows.Scan(&v.PostID, &v.UserID, &v.Vote, &v.Created); err != nil {
+			return err
+		}
+		p := byID[v.PostID]
+		p.Votes = append(p.Votes, v)
+	}
+	return rows.Err()
+}
+
+// readPostsTags sets the tags of the posts in the order they were given,
+// nil for untagged posts.
+func readPostsTags(q querier, posts []*Post) error {
+	in, args, byID := inPosts(posts)
+	rows, err := q.Query(`SELECT post_id, tag FROM post_tags WHERE post_id IN `+in+` ORDER BY rowid`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			postID uint32
+			tag    string
+		)
+		if err = rows.Scan(&postID, &tag); err != nil {
+			return err
+		}
+		p := byID[postID]
+		p.Tags = append(p.Tags, tag)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,98 @@
+package post_test
+
+import (
+	"database/sql"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+// TestSQLiteReadVotesAndTags reads more posts than one IN list holds, each
+// post must get its own votes and tags in the order they were given.
+func TestSQLiteReadVotesAndTags(t *testing.T) {
+	const count = 1200
+	db, err := sql.Open("sqlite3", "file:postsvotestags?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	users, err := user.NewUsersSQLiteRepo(db)
+	if err != nil {
+		t.Fatalf("NewUsersSQLiteRepo: %v", err)
+	}
+	alex, err := users.CreateUser("alex", "pass-alex")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	bob, err := users.CreateUser("bob", "pass-bob")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	repo, err := post.NewPostsSQLiteRepo(db)
+	if err != nil {
+		t.Fatalf("NewPostsSQLiteRepo: %v", err)
+	}
+
+	// post i is tagged if i%3 == 0, upvoted by alex if even and downvoted
+	// by bob if i%5 == 0
+	for i := 0; i < count; i++ {
+		p := &post.Post{Author: alex, Type: "text", Title: "title", Category: "music"}
+		if i%3 == 0 {
+			p.Tags = []string{fmt.Sprintf("tag%v", i), "all"}
+		}
+		id, err := repo.Create(p)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if i%5 == 0 {
+			if _, err = repo.DownVote(id, bob); err != nil {
+				t.Fatalf("DownVote: %v", err)
+			}
+		}
+		if i%2 == 0 {
+			if _, err = repo.UpVote(id, alex); err != nil {
+				t.Fatalf("UpVote: %v", err)
+			}
+		}
+	}
+
+	posts, err := repo.ReadAll()
+	if err != nil || len(posts) != count {
+		t.Fatalf("ReadAll: got %v posts, %v, want %v", len(posts), err, count)
+	}
+	for _, p := range posts {
+		i := int(p.ID) - 1
+		var wantTags, wantVotes []string
+		if i%3 == 0 {
+			wantTags = []string{fmt.Sprintf("tag%v", i), "all"}
+		}
+		if i%5 == 0 {
+			wantVotes = append(wantVotes, fmt.Sprintf("%v:%v", bob.ID, post.DownVote))
+		}
+		if i%2 == 0 {
+			wantVotes = append(wantVotes, fmt.Sprintf("%v:%v", alex.ID, post.UpVote))
+		}
+		gotVotes := make([]string, 0, len(p.Votes))
+		for _, v := range p.Votes {
+			if v.PostID != p.ID {
+				t.Fatalf("vote of post %v: got post %v", p.ID, v.PostID)
+			}
+			gotVotes = append(gotVotes, fmt.Sprintf("%v:%v", v.UserID, v.Vote))
+		}
+		if p.Votes == nil || fmt.Sprint(gotVotes) != fmt.Sprint(wantVotes) {
+			t.Fatalf("votes of post %v: got %v, want %v", p.ID, gotVotes, wantVotes)
+		}
+		if fmt.Sprint(p.Tags) != fmt.Sprint(wantTags) || (wantTags == nil) != (p.Tags == nil) {
+			t.Fatalf("tags of post %v: got %v, want %v", p.ID, p.Tags, wantTags)
+		}
+	}
+
+	tagged, err := repo.ReadTag("all")
+	if err != nil || len(tagged) != count/3 {
+		t.Fatalf("ReadTag: got %v posts, %v, want %v", len(tagged), err, count/3)
+	}
+}
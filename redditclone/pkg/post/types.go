@@ -0,0 +1,109 @@
+package post
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// Keys Data of a post can be rendered under in json.
+const (
+	TextKey = "text"
+	URLKey  = "url"
+)
+
+var errContent = errors.New("content of a post must be a json object")
+
+// ownKeys are the json keys of Post itself and of Data, every other key
+// of a post object belongs to Content.
+var ownKeys = jsonKeys(reflect.TypeOf(Post{}), "data", TextKey, URLKey)
+
+func jsonKeys(t reflect.Type, extra ...string) map[string]bool {
+	res := make(map[string]bool)
+	for idx := 0; idx < t.NumField(); idx++ {
+		name := strings.Split(t.Field(idx).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			res[name] = true
+		}
+	}
+	for _, key := range extra {
+		res[key] = true
+	}
+	return res
+}
+
+// MarshalJSON puts Data under DataKey, first in the object, so clients
+// read "text" or "url" and never "data". The keys of Content come next.
+func (p *Post) MarshalJSON() ([]byte, error) {
+	type plain Post
+	body, err := json.Marshal((*plain)(p))
+	if err != nil {
+		return nil, err
+	}
+	key := p.DataKey
+	if key == "" {
+		key = TextKey
+	}
+	data, err := json.Marshal(map[string]string{key: p.Data})
+	if err != nil {
+		return nil, err
+	}
+	content := bytes.TrimSpace(p.Content)
+	if len(content) > 0 {
+		if content[0] != '{' || content[len(content)-1] != '}' {
+			return nil, errContent
+		}
+		content = bytes.TrimSpace(content[1 : len(content)-1])
+	}
+	// all are objects and data and body are never empty, so they are
+	// joined by swapping the closing brace of one for a comma
+	res := append(data[:len(data)-1], ',')
+	if len(content) > 0 {
+		res = append(append(res, content...), ',')
+	}
+	return append(res, body[1:]...), nil
+}
+
+// UnmarshalJSON reads Data from "text" or "url", or from "data" as
+// journals written before post types had keys have it. Keys Post doesn't
+// have are kept in Content.
+func (p *Post) UnmarshalJSON(data []byte) error {
+	type plain Post
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	p.Data, p.DataKey, p.Content = "", "", nil
+	for _, key := range []string{TextKey, URLKey, "data"} {
+		if raw, ok := fields[key]; ok {
+			if err := json.Unmarshal(raw, &p.Data); err != nil {
+				return err
+			}
+			if key != "data" {
+				p.DataKey = key
+			}
+			break
+		}
+	}
+
+	content := map[string]json.RawMessage{}
+	for key, raw := range fields {
+		if !ownKeys[key] {
+			content[key] = raw
+		}
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	p.Content = raw
+	return nil
+}
@@ -0,0 +1,47 @@
+package post_test
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/post"
+	"strings"
+	"testing"
+)
+
+func TestPostJSON(t *testing.T) {
+	p := &post.Post{ID: 1, Type: "link", Data: "https://example.com/", DataKey: post.URLKey,
+		Content: json.RawMessage(`{"preview":{"title":"Example"}}`)}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.HasPrefix(string(raw), `{"url":"https://example.com/","preview":{"title":"Example"},"id":1,`) {
+		t.Fatalf("Marshal: got %s", raw)
+	}
+
+	got := &post.Post{}
+	if err = json.Unmarshal(raw, got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Data != p.Data || got.DataKey != post.URLKey || string(got.Content) != string(p.Content) {
+		t.Fatalf("Unmarshal: got %q %q %s, want %q %q %s", got.Data, got.DataKey, got.Content, p.Data, post.URLKey, p.Content)
+	}
+
+	// without a key Data is text, and there may be no content at all
+	raw, err = json.Marshal(&post.Post{Data: "hi"})
+	if err != nil || !strings.HasPrefix(string(raw), `{"text":"hi","id":0,`) {
+		t.Fatalf("Marshal text: got %s, %v", raw, err)
+	}
+
+	// journals written before post types had keys
+	old := &post.Post{}
+	if err = json.Unmarshal([]byte(`{"id":2,"type":"text","data":"old"}`), old); err != nil {
+		t.Fatalf("Unmarshal old: %v", err)
+	}
+	if old.Data != "old" || old.DataKey != "" || old.Content != nil {
+		t.Fatalf("Unmarshal old: got %q %q %s", old.Data, old.DataKey, old.Content)
+	}
+
+	if _, err = json.Marshal(&post.Post{Content: json.RawMessage(`[1]`)}); err == nil {
+		t.Fatalf("Marshal of content which is not an object: got no error")
+	}
+}
@@ -0,0 +1,89 @@
+package posttype
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/media"
+	"fakereddit/redditclone/pkg/post"
+)
+
+// Image posts are an uploaded picture, Data is its url. The files are
+// deleted with the post, Image is a cascade.Dependent for that.
+type Image struct {
+	Base
+	Images *media.Images
+	Posts  post.PostsRepo
+}
+
+// imageContent is Content of image posts.
+type imageContent struct {
+	Image *media.Image `json:"image"`
+}
+
+func (im *Image) Name() string     { return "image" }
+func (im *Image) DataKey() string  { return post.URLKey }
+func (im *Image) Fields() []string { return []string{UploadField} }
+
+func (im *Image) SizeLimit() int64 {
+	return im.Images.SizeLimit()
+}
+
+func (im *Image) Build(in *Input, p *post.Post) ([]*FieldError, error) {
+	if in.Upload == nil {
+		return []*FieldError{{Param: UploadField, Message: "is required"}}, nil
+	}
+	img, err := im.Images.Save(in.Upload)
+	switch err {
+	case nil:
+	case media.ErrTooBig, media.ErrFormat, media.ErrDimensions, media.ErrFrames:
+		return []*FieldError{{Param: UploadField, Message: err.Error()}}, nil
+	default:
+		return nil, err
+	}
+	content, err := json.Marshal(&imageContent{Image: img})
+	if err != nil {
+		im.Images.Remove(img)
+		return nil, err
+	}
+	p.Content = content
+	p.Data = img.URL
+	return nil, nil
+}
+
+func (im *Image) Discard(p *post.Post) {
+	if img := picture(p); img != nil {
+		im.Images.Remove(img)
+	}
+}
+
+// Edit keeps the picture, only the title of an image post changes.
+func (im *Image) Edit(in *Input, p *post.Post) (string, []*FieldError, error) {
+	if in.Has(UploadField) {
+		return p.Data, []*FieldError{{Param: UploadField, Message: "can't be changed"}}, nil
+	}
+	return p.Data, nil, nil
+}
+
+// DeleteByPost deletes the files of the post when it is deleted for good.
+func (im *Image) DeleteByPost(postID uint32) (int, error) {
+	p, err := im.Posts.Read(postID)
+	if err == post.ErrNoPost {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	img := picture(p)
+	if img == nil {
+		return 0, nil
+	}
+	return im.Images.Remove(img)
+}
+
+// picture is the stored image of the post, nil for posts of other types.
+func picture(p *post.Post) *media.Image {
+	c := &imageContent{}
+	if p.Type != "image" || p.Content == nil || json.Unmarshal(p.Content, c) != nil {
+		return nil
+	}
+	return c.Image
+}
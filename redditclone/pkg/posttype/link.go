@@ -0,0 +1,179 @@
+package posttype
+
+import (
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/link"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/unfurl"
+	"time"
+)
+
+// Link posts keep a canonical url and get a preview of the page.
+type Link struct {
+	Base
+	Posts post.PostsRepo
+	// EditWindow is how long after posting the url can be changed
+	EditWindow time.Duration
+	// DuplicateWindow is how long a link counts as already submitted to
+	// its category, 0 turns the check off
+	DuplicateWindow time.Duration
+	// Unfurler fetches previews, nil turns them off
+	Unfurler *unfurl.Unfurler
+}
+
+// errMoved stops a preview of a page the post no longer links to.
+var errMoved = errors.New("link changed")
+
+// linkContent is Content of link posts, they have none until the preview
+// is fetched.
+type linkContent struct {
+	Preview *unfurl.Preview `json:"preview"`
+}
+
+type linkForm struct {
+	URL *string `json:"url"`
+	// Resubmit posts the link even if it is already in the category
+	Resubmit bool `json:"resubmit"`
+}
+
+func (l *Link) Name() string     { return "link" }
+func (l *Link) DataKey() string  { return post.URLKey }
+func (l *Link) Fields() []string { return []string{"url", "resubmit"} }
+
+func (l *Link) Build(in *Input, p *post.Post) ([]*FieldError, error) {
+	form := &linkForm{}
+	if err := in.Decode(form); err != nil {
+		return nil, err
+	}
+	raw := ""
+	if form.URL != nil {
+		raw = *form.URL
+	}
+	url, err := link.Canonical(raw)
+	if err != nil {
+		return []*FieldError{{Param: "url", Message: err.Error()}}, nil
+	}
+	if err = l.checkDuplicates(p, url, form.Resubmit); err != nil {
+		return nil, err
+	}
+	p.Data = url
+	return nil, nil
+}
+
+func (l *Link) Created(p *post.Post) {
+	l.unfurl(p.ID, p.Data)
+}
+
+func (l *Link) Edit(in *Input, p *post.Post) (string, []*FieldError, error) {
+	form := &linkForm{}
+	if err := in.Decode(form); err != nil {
+		return "", nil, err
+	}
+	if form.URL == nil || *form.URL == p.Data {
+		return p.Data, nil, nil
+	}
+	if *form.URL == "" {
+		return p.Data, []*FieldError{{Param: "url", Message: "is required"}}, nil
+	}
+	url, err := link.Canonical(*form.URL)
+	if err != nil {
+		return p.Data, []*FieldError{{Param: "url", Message: err.Error()}}, nil
+	}
+	if url == p.Data {
+		return p.Data, nil, nil
+	}
+	if !l.canEdit(p) {
+		return p.Data, []*FieldError{{Param: "url", Message: "can't be changed any more"}}, nil
+	}
+	if err = l.checkDuplicates(p, url, form.Resubmit); err != nil {
+		return p.Data, nil, err
+	}
+	return url, nil, nil
+}
+
+// Edited drops the preview of the old page and asks for a new one.
+func (l *Link) Edited(id uint32, data string) error {
+	_, err := l.Posts.UpdateContent(id, func(p *post.Post) (json.RawMessage, error) {
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	l.unfurl(id, data)
+	return nil
+}
+
+// unfurl asks for a preview of the page, it is kept if the post still
+// links to it when the page is downloaded.
+func (l *Link) unfurl(id uint32, url string) {
+	l.Unfurler.Enqueue(id, url, func(preview *unfurl.Preview) error {
+		_, err := l.Posts.UpdateContent(id, func(p *post.Post) (json.RawMessage, error) {
+			if p.Data != url {
+				return nil, errMoved
+			}
+			return json.Marshal(&linkContent{Preview: preview})
+		})
+		if err == errMoved {
+			return nil
+		}
+		return err
+	})
+}
+
+func (l *Link) canEdit(p *post.Post) bool {
+	created, err := time.Parse(time.RFC3339, p.Created)
+	if err != nil {
+		return false
+	}
+	return time.Since(created) < l.EditWindow
+}
+
+// checkDuplicates returns a DuplicateError if url is already submitted to
+// the category of p by another post, unless resubmit is set. Creating and
+// editing a link both go through it.
+func (l *Link) checkDuplicates(p *post.Post, url string, resubmit bool) error {
+	if resubmit {
+		return nil
+	}
+	dups, err := l.duplicates(p, url)
+	if err != nil {
+		return err
+	}
+	if len(dups) > 0 {
+		return &DuplicateError{Posts: dups}
+	}
+	return nil
+}
+
+// duplicates finds other posts of the category of p with the same link,
+// submitted within DuplicateWindow. Old posts may keep links as they were
+// sent, so they are brought to the canonical form too.
+func (l *Link) duplicates(p *post.Post, url string) ([]*post.Post, error) {
+	if l.DuplicateWindow <= 0 {
+		return nil, nil
+	}
+	posts, err := l.Posts.ReadCategory(p.Category)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-l.DuplicateWindow)
+	res := make([]*post.Post, 0)
+	for _, elem := range posts {
+		if elem.ID == p.ID || elem.Type != l.Name() || elem.DeletedAt != "" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, elem.Created)
+		if err != nil || created.Before(since) {
+			continue
+		}
+		canonical, err := link.Canonical(elem.Data)
+		if err != nil {
+			canonical = elem.Data
+		}
+		if canonical == url {
+			res = append(res, elem)
+		}
+	}
+	return res, nil
+}
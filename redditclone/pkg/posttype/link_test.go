@@ -0,0 +1,78 @@
+package posttype_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/user"
+	"testing"
+	"time"
+)
+
+func input(t *testing.T, fields map[string]interface{}) *posttype.Input {
+	t.Helper()
+	in := &posttype.Input{Fields: make(map[string]json.RawMessage)}
+	for key, value := range fields {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("Marshal %v: %v", key, err)
+		}
+		in.Fields[key] = raw
+	}
+	return in
+}
+
+// TestLinkDuplicates checks that creating and editing a link both find
+// the link already submitted to the category.
+func TestLinkDuplicates(t *testing.T) {
+	posts := post.NewPostsRepo()
+	l := &posttype.Link{Posts: posts, EditWindow: time.Hour, DuplicateWindow: time.Hour}
+	alex := &user.User{ID: 1, Username: "alex"}
+
+	create := func(url string, resubmit bool) (*post.Post, error) {
+		p := &post.Post{Author: alex, Type: "link", Title: "t", Category: "music"}
+		errs, err := l.Build(input(t, map[string]interface{}{"url": url, "resubmit": resubmit}), p)
+		if len(errs) > 0 {
+			t.Fatalf("Build %v: got %v", url, errs[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.ID, err = posts.Create(p); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return p, nil
+	}
+	song, err := create("https://example.com/song/?utm_source=x", false)
+	if err != nil || song.Data != "https://example.com/song" {
+		t.Fatalf("Build: got %+v, %v", song, err)
+	}
+	other, err := create("https://example.com/other", false)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	var dup *posttype.DuplicateError
+	if _, err = create("https://EXAMPLE.com/song", false); !errors.As(err, &dup) || len(dup.Posts) != 1 || dup.Posts[0].ID != song.ID {
+		t.Fatalf("Build of a duplicate: got %v", err)
+	}
+
+	edit := func(p *post.Post, fields map[string]interface{}) (string, error) {
+		data, errs, err := l.Edit(input(t, fields), p)
+		if len(errs) > 0 {
+			t.Fatalf("Edit %v: got %v", fields, errs[0])
+		}
+		return data, err
+	}
+	// the post itself is not a duplicate
+	if data, err := edit(other, map[string]interface{}{"url": "https://example.com/other/"}); data != other.Data || err != nil {
+		t.Fatalf("Edit to the same link: got %v, %v", data, err)
+	}
+	if _, err = edit(other, map[string]interface{}{"url": "https://example.com/song?fbclid=1"}); !errors.As(err, &dup) || dup.Posts[0].ID != song.ID {
+		t.Fatalf("Edit to a duplicate: got %v", err)
+	}
+	data, err := edit(other, map[string]interface{}{"url": "https://example.com/song", "resubmit": true})
+	if data != "https://example.com/song" || err != nil {
+		t.Fatalf("Edit with resubmit: got %v, %v", data, err)
+	}
+}
@@ -0,0 +1,237 @@
+package posttype
+
+import (
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/post"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	minPollOptions = 2
+	maxPollOptions = 10
+	maxOptionLen   = 100
+)
+
+var (
+	ErrNotPoll    = errors.New("post is not a poll")
+	ErrNoOption   = errors.New("no such poll option")
+	ErrPollClosed = errors.New("poll is closed")
+)
+
+// Poll posts ask their title, the text explains it. Every user has one
+// ballot and can move it to another option until the poll closes.
+type Poll struct {
+	Base
+	Posts post.PostsRepo
+}
+
+// pollContent is Content of poll posts.
+type pollContent struct {
+	Poll *poll `json:"poll"`
+}
+
+type poll struct {
+	Options []*pollOption `json:"options"`
+	// Closes is when voting ends, RFC3339, empty for polls open forever
+	Closes  string    `json:"closes,omitempty"`
+	Ballots []*ballot `json:"ballots"`
+}
+
+type pollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+type ballot struct {
+	User   uint32 `json:"user"`
+	Option int    `json:"option"`
+}
+
+type pollForm struct {
+	Text    *string  `json:"text"`
+	Options []string `json:"options"`
+	// Closes is RFC3339, empty for polls open forever
+	Closes string `json:"closes"`
+}
+
+func (pl *Poll) Name() string     { return "poll" }
+func (pl *Poll) DataKey() string  { return post.TextKey }
+func (pl *Poll) Fields() []string { return []string{"text", "options", "closes"} }
+
+// Build makes the poll of a new post. Options are trimmed and must differ
+// regardless of case, the closing time must be in the future.
+func (pl *Poll) Build(in *Input, p *post.Post) ([]*FieldError, error) {
+	form := &pollForm{}
+	if err := in.Decode(form); err != nil {
+		return nil, err
+	}
+
+	errs := make([]*FieldError, 0)
+	if len(form.Options) < minPollOptions || len(form.Options) > maxPollOptions {
+		errs = append(errs, &FieldError{Param: "options", Message: "must be from 2 to 10"})
+	}
+	question := &poll{Options: make([]*pollOption, 0, len(form.Options)), Ballots: make([]*ballot, 0)}
+	seen := make(map[string]bool)
+	for _, elem := range form.Options {
+		text := strings.TrimSpace(elem)
+		key := strings.ToLower(text)
+		switch {
+		case text == "" || utf8.RuneCountInString(text) > maxOptionLen:
+			errs = append(errs, &FieldError{Param: "options", Message: "must be from 1 to 100 characters"})
+		case seen[key]:
+			errs = append(errs, &FieldError{Param: "options", Message: "repeats " + text})
+		}
+		seen[key] = true
+		question.Options = append(question.Options, &pollOption{Text: text})
+	}
+
+	if form.Closes != "" {
+		closes, err := time.Parse(time.RFC3339, form.Closes)
+		if err != nil {
+			errs = append(errs, &FieldError{Param: "closes", Message: "must be an RFC 3339 time"})
+		} else if !closes.After(time.Now()) {
+			errs = append(errs, &FieldError{Param: "closes", Message: "must be in the future"})
+		} else {
+			question.Closes = closes.UTC().Format(time.RFC3339)
+		}
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+	content, err := json.Marshal(&pollContent{Poll: question})
+	if err != nil {
+		return nil, err
+	}
+	if form.Text != nil {
+		p.Data = *form.Text
+	}
+	p.Content = content
+	return nil, nil
+}
+
+// Edit changes the text only, the question stays as people voted on it.
+func (pl *Poll) Edit(in *Input, p *post.Post) (string, []*FieldError, error) {
+	form := &pollForm{}
+	if err := in.Decode(form); err != nil {
+		return "", nil, err
+	}
+	errs := make([]*FieldError, 0)
+	for _, field := range []string{"options", "closes"} {
+		if in.Has(field) {
+			errs = append(errs, &FieldError{Param: field, Message: "can't be changed"})
+		}
+	}
+	if len(errs) > 0 {
+		return p.Data, errs, nil
+	}
+	if form.Text == nil {
+		return p.Data, nil, nil
+	}
+	return *form.Text, nil, nil
+}
+
+// renderedPoll is what clients see of a poll: the counts and the choice of
+// the viewer, never who voted for what.
+type renderedPoll struct {
+	Options []*pollOption `json:"options"`
+	Closes  string        `json:"closes,omitempty"`
+	// Closed is set, so clients don't compare times themselves
+	Closed bool `json:"closed"`
+	// Choice is the option of the viewer, absent if they haven't voted
+	Choice *int `json:"choice,omitempty"`
+}
+
+// Render shows the counts and the choice of the viewer, the ballots stay in
+// Content.
+func (pl *Poll) Render(p *post.Post, viewerID uint32) json.RawMessage {
+	c, err := readPoll(p)
+	if err != nil {
+		log.Printf("ERROR: render poll post_%v: %v", p.ID, err)
+		return nil
+	}
+	res := &renderedPoll{
+		Options: c.Poll.Options,
+		Closes:  c.Poll.Closes,
+		Closed:  c.Poll.closedAt(time.Now()),
+	}
+	for _, elem := range c.Poll.Ballots {
+		if viewerID != 0 && elem.User == viewerID {
+			choice := elem.Option
+			res.Choice = &choice
+		}
+	}
+	raw, err := json.Marshal(map[string]interface{}{"poll": res})
+	if err != nil {
+		log.Printf("ERROR: render poll post_%v: %v", p.ID, err)
+		return nil
+	}
+	return raw
+}
+
+// Vote puts the ballot of the user on the option, a second vote moves it.
+func (pl *Poll) Vote(postID, userID uint32, option int) (*post.Post, error) {
+	return pl.Posts.UpdateContent(postID, func(p *post.Post) (json.RawMessage, error) {
+		c, err := readPoll(p)
+		if err != nil {
+			return nil, err
+		}
+		if c.Poll.closedAt(time.Now()) {
+			return nil, ErrPollClosed
+		}
+		if option < 0 || option >= len(c.Poll.Options) {
+			return nil, ErrNoOption
+		}
+		c.Poll.vote(userID, option)
+		return json.Marshal(c)
+	})
+}
+
+func readPoll(p *post.Post) (*pollContent, error) {
+	c := &pollContent{}
+	if p.Type != "poll" || p.Content == nil {
+		return nil, ErrNotPoll
+	}
+	if err := json.Unmarshal(p.Content, c); err != nil {
+		return nil, err
+	}
+	if c.Poll == nil {
+		return nil, ErrNotPoll
+	}
+	return c, nil
+}
+
+// closedAt tells if voting is over at now.
+func (q *poll) closedAt(now time.Time) bool {
+	if q.Closes == "" {
+		return false
+	}
+	closes, err := time.Parse(time.RFC3339, q.Closes)
+	return err != nil || !now.Before(closes)
+}
+
+// vote puts or moves the ballot of the user and recounts the options.
+func (q *poll) vote(userID uint32, option int) {
+	found := false
+	for _, elem := range q.Ballots {
+		if elem.User == userID {
+			elem.Option = option
+			found = true
+			break
+		}
+	}
+	if !found {
+		q.Ballots = append(q.Ballots, &ballot{User: userID, Option: option})
+	}
+	for _, elem := range q.Options {
+		elem.Votes = 0
+	}
+	for _, elem := range q.Ballots {
+		if elem.Option >= 0 && elem.Option < len(q.Options) {
+			q.Options[elem.Option].Votes++
+		}
+	}
+}
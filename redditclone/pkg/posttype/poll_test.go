@@ -0,0 +1,99 @@
+package posttype_test
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/user"
+	"testing"
+)
+
+type renderedPoll struct {
+	Poll struct {
+		Options []struct {
+			Text  string `json:"text"`
+			Votes int    `json:"votes"`
+		} `json:"options"`
+		Ballots []interface{} `json:"ballots"`
+		Closed  bool          `json:"closed"`
+		Choice  *int          `json:"choice"`
+	} `json:"poll"`
+}
+
+// render renders the poll for the viewer, it fails the test if the ballots
+// are shown.
+func render(t *testing.T, types *posttype.Registry, p *post.Post, viewerID uint32) *renderedPoll {
+	t.Helper()
+	res := &renderedPoll{}
+	if err := json.Unmarshal(types.Render(p, viewerID).Content, res); err != nil {
+		t.Fatalf("Unmarshal rendered poll: %v", err)
+	}
+	if res.Poll.Ballots != nil {
+		t.Fatalf("Render shows the ballots: %+v", res.Poll.Ballots)
+	}
+	return res
+}
+
+// TestPollVotes votes through the poll type, the ballots live in Content.
+func TestPollVotes(t *testing.T) {
+	posts := post.NewPostsRepo()
+	poll := &posttype.Poll{Posts: posts}
+	types := posttype.NewRegistry(posttype.Text{}, poll)
+	alex := &user.User{ID: 1, Username: "alex"}
+
+	p := &post.Post{Author: alex, Type: "poll", Title: "color?", Category: "music"}
+	errs, err := poll.Build(input(t, map[string]interface{}{"options": []string{" red ", "blue"}}), p)
+	if len(errs) > 0 || err != nil {
+		t.Fatalf("Build: got %v, %v", errs, err)
+	}
+	id, err := posts.Create(p)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	got := render(t, types, p, 1)
+	if len(got.Poll.Options) != 2 || got.Poll.Options[0].Text != "red" || got.Poll.Closed || got.Poll.Choice != nil {
+		t.Fatalf("Render new poll: got %+v", got)
+	}
+
+	if _, err = poll.Vote(id, 1, 0); err != nil {
+		t.Fatalf("Vote: %v", err)
+	}
+	if _, err = poll.Vote(id, 2, 0); err != nil {
+		t.Fatalf("Vote: %v", err)
+	}
+	// a second vote moves the ballot
+	p, err = poll.Vote(id, 2, 1)
+	if err != nil {
+		t.Fatalf("Vote again: %v", err)
+	}
+	got = render(t, types, p, 2)
+	if got.Poll.Options[0].Votes != 1 || got.Poll.Options[1].Votes != 1 || got.Poll.Choice == nil || *got.Poll.Choice != 1 {
+		t.Fatalf("Render after votes: got %+v", got)
+	}
+	for _, viewerID := range []uint32{0, 3} {
+		if got = render(t, types, p, viewerID); got.Poll.Choice != nil {
+			t.Fatalf("Render for %v who didn't vote: got choice %v", viewerID, *got.Poll.Choice)
+		}
+	}
+
+	if _, err = poll.Vote(id, 1, 2); err != posttype.ErrNoOption {
+		t.Fatalf("Vote for a missing option: got %v, want %v", err, posttype.ErrNoOption)
+	}
+	text, _ := posts.Create(&post.Post{Author: alex, Type: "text", Title: "t", Category: "music"})
+	if _, err = poll.Vote(text, 1, 0); err != posttype.ErrNotPoll {
+		t.Fatalf("Vote on a text post: got %v, want %v", err, posttype.ErrNotPoll)
+	}
+	if _, err = poll.Vote(text+1, 1, 0); err != post.ErrNoPost {
+		t.Fatalf("Vote on a missing post: got %v, want %v", err, post.ErrNoPost)
+	}
+
+	closed, _ := posts.Create(&post.Post{Author: alex, Type: "poll", Title: "old?", Category: "music",
+		Content: json.RawMessage(`{"poll":{"options":[{"text":"a"},{"text":"b"}],"closes":"2001-01-01T00:00:00Z","ballots":[]}}`)})
+	if _, err = poll.Vote(closed, 1, 0); err != posttype.ErrPollClosed {
+		t.Fatalf("Vote on a closed poll: got %v, want %v", err, posttype.ErrPollClosed)
+	}
+	p, _ = posts.Read(closed)
+	if got = render(t, types, p, 1); !got.Poll.Closed || got.Poll.Choice != nil {
+		t.Fatalf("Render closed poll: got %+v", got)
+	}
+}
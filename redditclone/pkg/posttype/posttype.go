@@ -0,0 +1,226 @@
+package posttype
+
+import (
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/post"
+	"log"
+	"sort"
+)
+
+// UploadField is the multipart file field, an upload is checked against
+// Fields like any other field under this name.
+const UploadField = "image"
+
+var ErrBadForm = errors.New("bad form")
+
+// FieldError is a problem with one field of the form.
+type FieldError struct {
+	Param   string
+	Message string
+}
+
+// DuplicateError stops a post which is already there, Posts are the
+// ones found. The client may send the post again asking to skip the check.
+type DuplicateError struct {
+	Posts []*post.Post
+}
+
+func (e *DuplicateError) Error() string {
+	return "already submitted"
+}
+
+// Input is the type specific part of a post form: json fields by key
+// (multipart values become json strings) and the uploaded file.
+type Input struct {
+	Fields map[string]json.RawMessage
+	Upload []byte
+}
+
+// Has tells if the client sent the field.
+func (in *Input) Has(field string) bool {
+	if field == UploadField && in.Upload != nil {
+		return true
+	}
+	_, ok := in.Fields[field]
+	return ok
+}
+
+// Decode reads the fields into v like json.Unmarshal of the whole form.
+func (in *Input) Decode(v interface{}) error {
+	raw, err := json.Marshal(in.Fields)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(raw, v); err != nil {
+		return ErrBadForm
+	}
+	return nil
+}
+
+// Type is one kind of post. It owns the content of its posts: what the
+// form carries, how it ends up in Post.Data and Post.Content, and under
+// which key clients see Data.
+type Type interface {
+	Name() string
+	// DataKey is post.TextKey or post.URLKey
+	DataKey() string
+	// Fields are the form fields the type reads
+	Fields() []string
+	// Build checks the form and fills Data and Content.
+	// A *DuplicateError means the post is already there.
+	Build(in *Input, p *post.Post) ([]*FieldError, error)
+	// Created runs once the post is stored
+	Created(p *post.Post)
+	// Discard undoes Build when the post couldn't be stored
+	Discard(p *post.Post)
+	// Edit returns the new Data of the post, p is left as is
+	Edit(in *Input, p *post.Post) (string, []*FieldError, error)
+	// Edited runs after Data of the post changed
+	Edited(id uint32, data string) error
+}
+
+// Uploader is a Type taking a file, SizeLimit is the biggest one.
+type Uploader interface {
+	SizeLimit() int64
+}
+
+// Renderer is a Type showing Content to clients other than it is stored,
+// like what depends on the time or on who looks, viewerID is 0 for guests.
+type Renderer interface {
+	Render(p *post.Post, viewerID uint32) json.RawMessage
+}
+
+// Voter is a Type with its own kind of votes, like polls. Vote puts the
+// ballot of the user on the option and returns the post.
+type Voter interface {
+	Vote(postID, userID uint32, option int) (*post.Post, error)
+}
+
+// Base gives a Type nothing to do after its posts are stored or edited.
+type Base struct{}
+
+func (Base) Created(p *post.Post)                {}
+func (Base) Discard(p *post.Post)                {}
+func (Base) Edited(id uint32, data string) error { return nil }
+
+// Registry keeps the types posts can have. Handlers ask it instead of
+// comparing type names.
+type Registry struct {
+	types map[string]Type
+	// fields of all types, to refuse ones of other types on edit
+	fields []string
+}
+
+// NewRegistry registers the types.
+func NewRegistry(types ...Type) *Registry {
+	r := &Registry{types: make(map[string]Type)}
+	seen := make(map[string]bool)
+	for _, t := range types {
+		r.types[t.Name()] = t
+		for _, field := range t.Fields() {
+			if !seen[field] {
+				seen[field] = true
+				r.fields = append(r.fields, field)
+			}
+		}
+		log.Printf("Registered post type: '%v'", t.Name())
+	}
+	sort.Strings(r.fields)
+	return r
+}
+
+func (r *Registry) Get(name string) (Type, bool) {
+	t, ok := r.types[name]
+	return t, ok
+}
+
+// Names lists the types in alphabetical order.
+func (r *Registry) Names() []string {
+	res := make([]string, 0, len(r.types))
+	for name := range r.types {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// HasText tells if Data of posts of the type is a text, not a url. Data of
+// unknown types is taken for text.
+func (r *Registry) HasText(name string) bool {
+	t, ok := r.types[name]
+	return !ok || t.DataKey() == post.TextKey
+}
+
+// Render returns a copy of p the way the viewer sees it: Data under the
+// key of its type and Content as the type shows it. Posts of unknown types
+// are copied as they are.
+func (r *Registry) Render(p *post.Post, viewerID uint32) *post.Post {
+	res := *p
+	t, ok := r.types[p.Type]
+	if !ok {
+		return &res
+	}
+	res.DataKey = t.DataKey()
+	if renderer, ok := t.(Renderer); ok {
+		res.Content = renderer.Render(p, viewerID)
+	}
+	return &res
+}
+
+// SizeLimit is the biggest upload any type takes, 0 when none does.
+func (r *Registry) SizeLimit() int64 {
+	var limit int64
+	for _, t := range r.types {
+		if u, ok := t.(Uploader); ok && u.SizeLimit() > limit {
+			limit = u.SizeLimit()
+		}
+	}
+	return limit
+}
+
+// Build fills the new post p of its type. Forms of clients switching
+// between types keep both text and url, so those are ignored when the
+// type doesn't read them, other fields of other types are refused.
+func (r *Registry) Build(in *Input, p *post.Post) ([]*FieldError, error) {
+	t, ok := r.types[p.Type]
+	if !ok {
+		return []*FieldError{{Param: "type", Message: "unknown post type"}}, nil
+	}
+	errs := r.foreign(in, t, post.TextKey, post.URLKey)
+	if len(errs) > 0 {
+		return errs, nil
+	}
+	return t.Build(in, p)
+}
+
+// Edit checks a change of the content of p and returns the new Data.
+// Unlike Build it refuses text and url of other types as well.
+func (r *Registry) Edit(in *Input, p *post.Post) (string, []*FieldError, error) {
+	t, ok := r.types[p.Type]
+	if !ok {
+		return "", []*FieldError{{Param: "type", Message: "unknown post type"}}, nil
+	}
+	data, typeErrs, err := t.Edit(in, p)
+	return data, append(r.foreign(in, t), typeErrs...), err
+}
+
+// foreign refuses fields of other types the form has, except the allowed.
+func (r *Registry) foreign(in *Input, t Type, allowed ...string) []*FieldError {
+	errs := make([]*FieldError, 0)
+	for _, field := range r.fields {
+		if in.Has(field) && !has(t.Fields(), field) && !has(allowed, field) {
+			errs = append(errs, &FieldError{Param: field, Message: "is not allowed for " + t.Name() + " posts"})
+		}
+	}
+	return errs
+}
+
+func has(fields []string, field string) bool {
+	for _, elem := range fields {
+		if elem == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package posttype
+
+import "fakereddit/redditclone/pkg/post"
+
+// Text posts keep what the author wrote.
+type Text struct {
+	Base
+}
+
+type textForm struct {
+	Text *string `json:"text"`
+}
+
+func (Text) Name() string     { return "text" }
+func (Text) DataKey() string  { return post.TextKey }
+func (Text) Fields() []string { return []string{"text"} }
+
+func (Text) Build(in *Input, p *post.Post) ([]*FieldError, error) {
+	form := &textForm{}
+	if err := in.Decode(form); err != nil {
+		return nil, err
+	}
+	if form.Text != nil {
+		p.Data = *form.Text
+	}
+	return nil, nil
+}
+
+func (Text) Edit(in *Input, p *post.Post) (string, []*FieldError, error) {
+	form := &textForm{}
+	if err := in.Decode(form); err != nil {
+		return "", nil, err
+	}
+	if form.Text == nil {
+		return p.Data, nil, nil
+	}
+	return *form.Text, nil, nil
+}
@@ -0,0 +1,79 @@
+package prefs
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"sync"
+)
+
+const opSet = "set"
+
+// DurablePrefsRepo is a PrefsDataRepo which logs every change to a
+// journal and restores itself from it on start.
+type DurablePrefsRepo struct {
+	*PrefsDataRepo
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+type prefsSnapshot struct {
+	Data map[uint32]*Preferences `json:"data"`
+}
+
+type setEntry struct {
+	UserID uint32 `json:"user"`
+	*Preferences
+}
+
+func NewDurablePrefsRepo(j *journal.Journal) (*DurablePrefsRepo, error) {
+	repo := &DurablePrefsRepo{
+		PrefsDataRepo: NewPrefsRepo(),
+		mu:            &sync.Mutex{},
+		journal:       j,
+	}
+
+	err := j.Load(repo.restore, repo.apply)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (dr *DurablePrefsRepo) restore(state json.RawMessage) error {
+	snap := &prefsSnapshot{}
+	if err := json.Unmarshal(state, snap); err != nil {
+		return err
+	}
+	if snap.Data != nil {
+		dr.Data = snap.Data
+	}
+	return nil
+}
+
+func (dr *DurablePrefsRepo) apply(op string, data json.RawMessage) error {
+	if op != opSet {
+		return nil
+	}
+	e := &setEntry{Preferences: &Preferences{}}
+	if err := json.Unmarshal(data, e); err != nil {
+		return err
+	}
+	return dr.PrefsDataRepo.Set(e.UserID, e.Preferences)
+}
+
+func (dr *DurablePrefsRepo) Set(userID uint32, p *Preferences) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.PrefsDataRepo.Set(userID, p); err != nil {
+		return err
+	}
+	return dr.journal.Append(opSet, &setEntry{UserID: userID, Preferences: p})
+}
+
+func (dr *DurablePrefsRepo) Snapshot() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.PrefsDataRepo.mu.RLock()
+	defer dr.PrefsDataRepo.mu.RUnlock()
+	return dr.journal.Compact(&prefsSnapshot{Data: dr.Data})
+}
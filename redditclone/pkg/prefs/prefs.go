@@ -0,0 +1,38 @@
+// Package prefs keeps how users want to see posts with content warnings.
+package prefs
+
+const (
+	Show = "show"
+	Blur = "blur"
+	Hide = "hide"
+)
+
+// Modes are the ways to show marked posts.
+var Modes = map[string]bool{Show: true, Blur: true, Hide: true}
+
+// Preferences tell how to show NSFW and spoiler posts, one of the Modes
+// each.
+type Preferences struct {
+	NSFW    string `json:"nsfw"`
+	Spoiler string `json:"spoiler"`
+}
+
+// Defaults are the preferences of users who never set them and of
+// anonymous requests.
+var Defaults = Preferences{NSFW: Hide, Spoiler: Blur}
+
+type PrefsRepo interface {
+	// Get returns a copy of Defaults for users without preferences
+	Get(userID uint32) (*Preferences, error)
+	Set(userID uint32, p *Preferences) error
+}
+
+// Hides tells if the post with these warnings is left out of listings.
+func (p *Preferences) Hides(nsfw, spoiler bool) bool {
+	return nsfw && p.NSFW == Hide || spoiler && p.Spoiler == Hide
+}
+
+// Blurs tells if the post with these warnings is blurred.
+func (p *Preferences) Blurs(nsfw, spoiler bool) bool {
+	return nsfw && p.NSFW == Blur || spoiler && p.Spoiler == Blur
+}
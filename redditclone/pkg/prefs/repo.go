@@ -0,0 +1,38 @@
+package prefs
+
+import (
+	"log"
+	"sync"
+)
+
+type PrefsDataRepo struct {
+	mu   *sync.RWMutex
+	Data map[uint32]*Preferences
+}
+
+func NewPrefsRepo() *PrefsDataRepo {
+	log.Printf("NewPrefsRepo: created PrefsDataRepo")
+	return &PrefsDataRepo{
+		Data: make(map[uint32]*Preferences),
+		mu:   &sync.RWMutex{},
+	}
+}
+
+func (pr *PrefsDataRepo) Get(userID uint32) (*Preferences, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	res := Defaults
+	if p, ok := pr.Data[userID]; ok {
+		res = *p
+	}
+	return &res, nil
+}
+
+func (pr *PrefsDataRepo) Set(userID uint32, p *Preferences) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	stored := *p
+	pr.Data[userID] = &stored
+	log.Printf("Set preferences: user %v nsfw %v spoiler %v", userID, p.NSFW, p.Spoiler)
+	return nil
+}
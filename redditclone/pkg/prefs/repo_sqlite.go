@@ -0,0 +1,46 @@
+package prefs
+
+import (
+	"database/sql"
+	"log"
+)
+
+const prefsSchema = `
+CREATE TABLE IF NOT EXISTS preferences (
+	user_id INTEGER PRIMARY KEY REFERENCES users (id),
+	nsfw    TEXT    NOT NULL,
+	spoiler TEXT    NOT NULL
+);`
+
+type PrefsSQLiteRepo struct {
+	db *sql.DB
+}
+
+func NewPrefsSQLiteRepo(db *sql.DB) (*PrefsSQLiteRepo, error) {
+	if _, err := db.Exec(prefsSchema); err != nil {
+		return nil, err
+	}
+	log.Printf("NewPrefsSQLiteRepo: created PrefsSQLiteRepo")
+	return &PrefsSQLiteRepo{db: db}, nil
+}
+
+func (pr *PrefsSQLiteRepo) Get(userID uint32) (*Preferences, error) {
+	res := Defaults
+	err := pr.db.QueryRow(`SELECT nsfw, spoiler FROM preferences WHERE user_id = ?`, userID).
+		Scan(&res.NSFW, &res.Spoiler)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (pr *PrefsSQLiteRepo) Set(userID uint32, p *Preferences) error {
+	_, err := pr.db.Exec(`INSERT INTO preferences (user_id, nsfw, spoiler) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET nsfw = excluded.nsfw, spoiler = excluded.spoiler`,
+		userID, p.NSFW, p.Spoiler)
+	if err != nil {
+		return err
+	}
+	log.Printf("Set preferences: user %v nsfw %v spoiler %v", userID, p.NSFW, p.Spoiler)
+	return nil
+}
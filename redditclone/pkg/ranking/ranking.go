@@ -0,0 +1,133 @@
+// Package ranking orders post listings. Every algorithm is a Ranker
+// registered under the name used in ?sort=.
+package ranking
+
+import (
+	"errors"
+	"fakereddit/redditclone/pkg/post"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknown = errors.New("unknown sort")
+)
+
+// Ranker gives a post its rank, posts with higher rank go first.
+type Ranker interface {
+	Rank(p *post.Post, now time.Time) float64
+}
+
+// RankerFunc lets plain functions be Rankers.
+type RankerFunc func(p *post.Post, now time.Time) float64
+
+func (f RankerFunc) Rank(p *post.Post, now time.Time) float64 {
+	return f(p, now)
+}
+
+var (
+	mu      = &sync.RWMutex{}
+	rankers = map[string]Ranker{
+		"hot":           RankerFunc(Hot),
+		"new":           RankerFunc(New),
+		"top":           RankerFunc(Top),
+		"controversial": RankerFunc(Controversial),
+		"rising":        RankerFunc(Rising),
+	}
+)
+
+// Register adds a ranker or replaces the one with the same name.
+func Register(name string, r Ranker) {
+	mu.Lock()
+	rankers[name] = r
+	mu.Unlock()
+}
+
+func Get(name string) (Ranker, error) {
+	mu.RLock()
+	r, ok := rankers[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknown
+	}
+	return r, nil
+}
+
+// Sort orders posts by the ranker registered as name, ties keep their
+// order. Ranks are calculated once per post, not on every comparison.
+func Sort(posts []*post.Post, name string, now time.Time) error {
+	r, err := Get(name)
+	if err != nil {
+		return err
+	}
+	ranks := make(map[*post.Post]float64, len(posts))
+	for _, p := range posts {
+		ranks[p] = r.Rank(p, now)
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return ranks[posts[i]] > ranks[posts[j]]
+	})
+	return nil
+}
+
+// Hot uses the rank cached by the repo, see post.HotScore.
+func Hot(p *post.Post, _ time.Time) float64 {
+	return p.Hot
+}
+
+func New(p *post.Post, _ time.Time) float64 {
+	created, err := time.Parse(time.RFC3339, p.Created)
+	if err != nil {
+		return 0
+	}
+	return float64(created.Unix())
+}
+
+func Top(p *post.Post, _ time.Time) float64 {
+	return float64(p.Score)
+}
+
+// Controversial ranks high posts with many votes split evenly between up
+// and down.
+func Controversial(p *post.Post, _ time.Time) float64 {
+	ups, downs := 0, 0
+	for _, v := range p.Votes {
+		if v.Vote == post.UpVote {
+			ups++
+		} else if v.Vote == post.DownVote {
+			downs++
+		}
+	}
+	if ups == 0 || downs == 0 {
+		return 0
+	}
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(float64(ups+downs), balance)
+}
+
+// RisingWindow is how far back Rising looks for votes.
+var RisingWindow = 6 * time.Hour
+
+// Rising is the vote velocity: net votes cast within RisingWindow per hour
+// of that window the post has existed for.
+func Rising(p *post.Post, now time.Time) float64 {
+	since := now.Add(-RisingWindow)
+	if created, err := time.Parse(time.RFC3339, p.Created); err == nil && created.After(since) {
+		since = created
+	}
+
+	net := 0
+	for _, v := range p.Votes {
+		at, err := time.Parse(time.RFC3339, v.Created)
+		if err != nil || at.Before(since) {
+			continue
+		}
+		net += v.Vote
+	}
+	return float64(net) / math.Max(now.Sub(since).Hours(), 1)
+}
@@ -0,0 +1,200 @@
+package ranking_test
+
+import (
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/ranking"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// at is now moved by the duration, formatted like the repos store times.
+func at(d time.Duration) string {
+	return now.Add(d).Format(time.RFC3339)
+}
+
+// newPost makes a post created at now+created, votes are pairs of a vote
+// and the time it was cast, relative to now as well.
+func newPost(id uint32, created time.Duration, votes ...interface{}) *post.Post {
+	p := &post.Post{ID: id, Created: at(created), Votes: make([]*post.SingeVote, 0)}
+	for idx := 0; idx < len(votes); idx += 2 {
+		p.Votes = append(p.Votes, &post.SingeVote{
+			UserID:  uint32(idx/2 + 1),
+			Vote:    votes[idx].(int),
+			Created: at(votes[idx+1].(time.Duration)),
+		})
+	}
+	p.Score = post.SetScore(p)
+	p.Hot = post.HotScore(p)
+	return p
+}
+
+func sortedIDs(t *testing.T, posts []*post.Post, name string) string {
+	t.Helper()
+	if err := ranking.Sort(posts, name, now); err != nil {
+		t.Fatalf("Sort %v: %v", name, err)
+	}
+	ids := make([]uint32, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestRising(t *testing.T) {
+	const up, down = post.UpVote, post.DownVote
+	tests := []struct {
+		name string
+		p    *post.Post
+		want float64
+	}{
+		{"no votes", newPost(1, -time.Hour), 0},
+		{"votes in the window", newPost(1, -10*time.Hour, up, -time.Hour, up, -2*time.Hour, down, -3*time.Hour), 1.0 / 6},
+		{"votes before the window", newPost(1, -10*time.Hour, up, -7*time.Hour, up, -8*time.Hour), 0},
+		{"young post", newPost(1, -2*time.Hour, up, -time.Hour, up, -time.Hour, up, -30*time.Minute, up, -time.Minute), 2},
+		{"at least an hour", newPost(1, -10*time.Minute, up, -5*time.Minute, up, -time.Minute), 2},
+		{"down votes", newPost(1, -3*time.Hour, down, -time.Hour, down, -2*time.Hour, down, -time.Hour), -1},
+	}
+	for _, tt := range tests {
+		if got := ranking.Rising(tt.p, now); math.Abs(got-tt.want) > 1e-9 {
+			t.Fatalf("Rising of %v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	posts := []*post.Post{
+		newPost(1, -24*time.Hour, up, -20*time.Hour, up, -20*time.Hour, up, -20*time.Hour),
+		newPost(2, -time.Hour, up, -time.Minute),
+		newPost(3, -6*time.Hour, up, -time.Hour, up, -time.Hour, up, -time.Hour),
+		newPost(4, -time.Hour, down, -time.Minute),
+	}
+	if got, want := sortedIDs(t, posts, "rising"), "[2 3 1 4]"; got != want {
+		t.Fatalf("Sort rising: got %v, want %v", got, want)
+	}
+}
+
+func TestControversial(t *testing.T) {
+	votes := func(ups, downs int) *post.Post {
+		p := &post.Post{}
+		for i := 0; i < ups+downs; i++ {
+			vote := post.UpVote
+			if i >= ups {
+				vote = post.DownVote
+			}
+			p.Votes = append(p.Votes, &post.SingeVote{UserID: uint32(i + 1), Vote: vote})
+		}
+		return p
+	}
+	tests := []struct {
+		ups, downs int
+		want       float64
+	}{
+		{0, 0, 0},
+		{5, 0, 0},
+		{0, 5, 0},
+		{2, 2, 4},
+		{5, 5, 10},
+		{4, 2, math.Sqrt(6)},
+		{2, 4, math.Sqrt(6)},
+		{9, 1, math.Pow(10, 1.0/9)},
+	}
+	for _, tt := range tests {
+		if got := ranking.Controversial(votes(tt.ups, tt.downs), now); math.Abs(got-tt.want) > 1e-9 {
+			t.Fatalf("Controversial of %v up, %v down: got %v, want %v", tt.ups, tt.downs, got, tt.want)
+		}
+	}
+
+	posts := []*post.Post{votes(9, 1), votes(2, 2), votes(10, 0), votes(5, 5), votes(4, 2)}
+	for idx, p := range posts {
+		p.ID = uint32(idx + 1)
+	}
+	if got, want := sortedIDs(t, posts, "controversial"), "[4 2 5 1 3]"; got != want {
+		t.Fatalf("Sort controversial: got %v, want %v", got, want)
+	}
+}
+
+func TestHot(t *testing.T) {
+	const up, down = post.UpVote, post.DownVote
+	// ten times the score weighs as much as 12.5 hours of age: ten votes
+	// 25 hours ago lose to one 12 hours ago and even to a fresh -2
+	posts := []*post.Post{
+		newPost(1, -25*time.Hour, up, -time.Hour, up, -time.Hour, up, -time.Hour, up, -time.Hour, up, -time.Hour,
+			up, -time.Hour, up, -time.Hour, up, -time.Hour, up, -time.Hour, up, -time.Hour),
+		newPost(2, -time.Hour),
+		newPost(3, -12*time.Hour, up, -time.Hour),
+		newPost(4, -time.Hour, down, -time.Minute, down, -time.Minute),
+		newPost(5, -2*time.Hour, up, -time.Minute, up, -time.Minute),
+	}
+	if got, want := sortedIDs(t, posts, "hot"), "[5 2 4 3 1]"; got != want {
+		t.Fatalf("Sort hot: got %v, want %v", got, want)
+	}
+	if got := ranking.Hot(posts[0], now); got != posts[0].Hot {
+		t.Fatalf("Hot: got %v, want the cached %v", got, posts[0].Hot)
+	}
+}
+
+func TestSortUnknown(t *testing.T) {
+	if err := ranking.Sort(nil, "best", now); err != ranking.ErrUnknown {
+		t.Fatalf("Sort by an unknown name: got %v, want %v", err, ranking.ErrUnknown)
+	}
+}
+
+// TestRisingAfterRestore replays a journal of votes cast hours ago, rising
+// must count them at the time they were cast, not at the replay.
+func TestRisingAfterRestore(t *testing.T) {
+	dir := t.TempDir()
+	j, err := journal.Open(dir, "posts")
+	if err != nil {
+		t.Fatalf("Open journal: %v", err)
+	}
+	alex := &user.User{ID: 1, Username: "alex"}
+	for id := uint32(1); id <= 3; id++ {
+		err = j.Append("create", &post.Post{ID: id, Author: alex, Type: "text", Category: "music", Created: at(-24 * time.Hour)})
+		if err != nil {
+			t.Fatalf("Append create: %v", err)
+		}
+	}
+	// post 1 has most votes but all of them old
+	votes := []struct {
+		postID, userID uint32
+		at             time.Duration
+	}{
+		{1, 1, -20 * time.Hour}, {1, 2, -20 * time.Hour}, {1, 3, -20 * time.Hour},
+		{2, 1, -time.Hour},
+		{3, 1, -2 * time.Hour}, {3, 2, -time.Hour},
+	}
+	for _, v := range votes {
+		err = j.Append("upvote", map[string]interface{}{"post": v.postID, "user": v.userID, "at": at(v.at)})
+		if err != nil {
+			t.Fatalf("Append upvote: %v", err)
+		}
+	}
+	j.Close()
+
+	const want = "[3 2 1]"
+	for _, name := range []string{"replayed", "restored from a snapshot"} {
+		j, err = journal.Open(dir, "posts")
+		if err != nil {
+			t.Fatalf("Open journal: %v", err)
+		}
+		repo, err := post.NewDurablePostsRepo(j)
+		if err != nil {
+			t.Fatalf("NewDurablePostsRepo: %v", err)
+		}
+		posts, err := repo.ReadAll()
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		if got := sortedIDs(t, posts, "rising"); got != want {
+			t.Fatalf("Sort rising %v: got %v, want %v", name, got, want)
+		}
+		if err = repo.Snapshot(); err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+		j.Close()
+	}
+}
@@ -0,0 +1,108 @@
+package repotest
+
+import (
+	"database/sql"
+	"fakereddit/redditclone/pkg/category"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/prefs"
+	"fakereddit/redditclone/pkg/saved"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"sync/atomic"
+	"testing"
+)
+
+// Memory is the Factory of the in-memory repos.
+func Memory(t *testing.T) *Repos {
+	return &Repos{
+		Posts:      post.NewPostsRepo(),
+		Comments:   comment.NewCommentsRepo(),
+		Users:      user.NewUsersRepo(),
+		Categories: category.NewCategoriesRepo(),
+		Saved:      saved.NewSavedRepo(),
+		Mutes:      mute.NewMutesRepo(),
+		Prefs:      prefs.NewPrefsRepo(),
+	}
+}
+
+// databases numbers in-memory sqlite databases, each name is a separate one
+var databases int64
+
+// SQLite is the Factory of the sqlite repos, on a fresh in-memory database
+// for every test.
+func SQLite(t *testing.T) *Repos {
+	dsn := fmt.Sprintf("file:repotest%d?mode=memory&cache=shared&_foreign_keys=on", atomic.AddInt64(&databases, 1))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("Open sqlite: %v", err)
+	}
+	// as in main, one connection serializes writers
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	r := &Repos{}
+	if r.Users, err = user.NewUsersSQLiteRepo(db); err != nil {
+		t.Fatalf("NewUsersSQLiteRepo: %v", err)
+	}
+	if r.Posts, err = post.NewPostsSQLiteRepo(db); err != nil {
+		t.Fatalf("NewPostsSQLiteRepo: %v", err)
+	}
+	if r.Comments, err = comment.NewCommentsSQLiteRepo(db); err != nil {
+		t.Fatalf("NewCommentsSQLiteRepo: %v", err)
+	}
+	if r.Categories, err = category.NewCategoriesSQLiteRepo(db); err != nil {
+		t.Fatalf("NewCategoriesSQLiteRepo: %v", err)
+	}
+	if r.Saved, err = saved.NewSavedSQLiteRepo(db); err != nil {
+		t.Fatalf("NewSavedSQLiteRepo: %v", err)
+	}
+	if r.Mutes, err = mute.NewMutesSQLiteRepo(db); err != nil {
+		t.Fatalf("NewMutesSQLiteRepo: %v", err)
+	}
+	if r.Prefs, err = prefs.NewPrefsSQLiteRepo(db); err != nil {
+		t.Fatalf("NewPrefsSQLiteRepo: %v", err)
+	}
+	return r
+}
+
+// Durable is the Factory of the journaled repos, in a temporary directory.
+func Durable(t *testing.T) *Repos {
+	dir := t.TempDir()
+	open := func(name string) *journal.Journal {
+		j, err := journal.Open(dir, name)
+		if err != nil {
+			t.Fatalf("Open journal %v: %v", name, err)
+		}
+		t.Cleanup(func() { j.Close() })
+		return j
+	}
+
+	r := &Repos{}
+	var err error
+	if r.Posts, err = post.NewDurablePostsRepo(open("posts")); err != nil {
+		t.Fatalf("NewDurablePostsRepo: %v", err)
+	}
+	if r.Comments, err = comment.NewDurableCommentsRepo(open("comments")); err != nil {
+		t.Fatalf("NewDurableCommentsRepo: %v", err)
+	}
+	if r.Users, err = user.NewDurableUsersRepo(open("users")); err != nil {
+		t.Fatalf("NewDurableUsersRepo: %v", err)
+	}
+	if r.Categories, err = category.NewDurableCategoriesRepo(open("categories")); err != nil {
+		t.Fatalf("NewDurableCategoriesRepo: %v", err)
+	}
+	if r.Saved, err = saved.NewDurableSavedRepo(open("saved")); err != nil {
+		t.Fatalf("NewDurableSavedRepo: %v", err)
+	}
+	if r.Mutes, err = mute.NewDurableMutesRepo(open("mutes")); err != nil {
+		t.Fatalf("NewDurableMutesRepo: %v", err)
+	}
+	if r.Prefs, err = prefs.NewDurablePrefsRepo(open("preferences")); err != nil {
+		t.Fatalf("NewDurablePrefsRepo: %v", err)
+	}
+	return r
+}
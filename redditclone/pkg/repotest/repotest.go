@@ -0,0 +1,1593 @@
+// Package repotest is a behaviour suite shared by all storage backends.
+// A backend proves it behaves like the in-memory repos with
+//
+//	func TestRepos(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) *repotest.Repos {
+//			return &repotest.Repos{...fresh empty repos...}
+//		})
+//	}
+//
+// and `go test -race`. Memory, SQLite and Durable are the factories of the
+// backends the server has, repotest_test.go runs the suite on each of them.
+package repotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fakereddit/redditclone/pkg/category"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/mute"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/prefs"
+	"fakereddit/redditclone/pkg/saved"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Repos is one storage: all repos share it, because backends like sqlite
+// check that authors and posts exist.
+type Repos struct {
+	Posts      post.PostsRepo
+	Comments   comment.CommentsRepo
+	Users      user.UsersRepo
+	Categories category.CategoriesRepo
+	Saved      saved.SavedRepo
+	Mutes      mute.MutesRepo
+	Prefs      prefs.PrefsRepo
+}
+
+// Factory returns fresh empty repos for every test.
+type Factory func(t *testing.T) *Repos
+
+func Run(t *testing.T, newRepos Factory) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepos(t)) })
+	t.Run("PostIDs", func(t *testing.T) { testPostIDs(t, newRepos(t)) })
+	t.Run("Votes", func(t *testing.T) { testVotes(t, newRepos(t)) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newRepos(t)) })
+	t.Run("Ordering", func(t *testing.T) { testOrdering(t, newRepos(t)) })
+	t.Run("DeletePost", func(t *testing.T) { testDeletePost(t, newRepos(t)) })
+	t.Run("Comments", func(t *testing.T) { testComments(t, newRepos(t)) })
+	t.Run("CommentsByPost", func(t *testing.T) { testCommentsByPost(t, newRepos(t)) })
+	t.Run("CommentsByUser", func(t *testing.T) { testCommentsByUser(t, newRepos(t)) })
+	t.Run("TrashPosts", func(t *testing.T) { testTrashPosts(t, newRepos(t)) })
+	t.Run("TrashComments", func(t *testing.T) { testTrashComments(t, newRepos(t)) })
+	t.Run("Revisions", func(t *testing.T) { testRevisions(t, newRepos(t)) })
+	t.Run("CommentRevisions", func(t *testing.T) { testCommentRevisions(t, newRepos(t)) })
+	t.Run("Replies", func(t *testing.T) { testReplies(t, newRepos(t)) })
+	t.Run("CommentVotes", func(t *testing.T) { testCommentVotes(t, newRepos(t)) })
+	t.Run("HotRank", func(t *testing.T) { testHotRank(t, newRepos(t)) })
+	t.Run("ReadPage", func(t *testing.T) { testReadPage(t, newRepos(t)) })
+	t.Run("Tags", func(t *testing.T) { testTags(t, newRepos(t)) })
+	t.Run("Views", func(t *testing.T) { testViews(t, newRepos(t)) })
+	t.Run("Marks", func(t *testing.T) { testMarks(t, newRepos(t)) })
+	t.Run("Content", func(t *testing.T) { testContent(t, newRepos(t)) })
+	t.Run("ConcurrentContent", func(t *testing.T) { testConcurrentContent(t, newRepos(t)) })
+	t.Run("Categories", func(t *testing.T) { testCategories(t, newRepos(t)) })
+	t.Run("Subscriptions", func(t *testing.T) { testSubscriptions(t, newRepos(t)) })
+	t.Run("Follows", func(t *testing.T) { testFollows(t, newRepos(t)) })
+	t.Run("Saved", func(t *testing.T) { testSaved(t, newRepos(t)) })
+	t.Run("Mutes", func(t *testing.T) { testMutes(t, newRepos(t)) })
+	t.Run("Prefs", func(t *testing.T) { testPrefs(t, newRepos(t)) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, newRepos(t)) })
+	t.Run("ConcurrentTrash", func(t *testing.T) { testConcurrentTrash(t, newRepos(t)) })
+	t.Run("ConcurrentPosts", func(t *testing.T) { testConcurrentPosts(t, newRepos(t)) })
+}
+
+func testUsers(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	if alex.ID != 1 || bob.ID != 2 {
+		t.Fatalf("user ids: got %v, %v, want 1, 2", alex.ID, bob.ID)
+	}
+
+	_, err := r.Users.CreateUser("alex", "other")
+	if err != user.ErrAlreadyExist {
+		t.Fatalf("duplicate user: got %v, want %v", err, user.ErrAlreadyExist)
+	}
+	carl := mustUser(t, r, "carl")
+	if carl.ID != 3 {
+		t.Fatalf("duplicate user must not take an id: got %v, want 3", carl.ID)
+	}
+
+	u, err := r.Users.Authorize("alex", "alex-pass")
+	if err != nil || u.ID != alex.ID || u.Username != "alex" {
+		t.Fatalf("Authorize: got %+v, %v", u, err)
+	}
+	if _, err = r.Users.Authorize("alex", "wrong"); err != user.ErrWrongPassword {
+		t.Fatalf("Authorize with wrong password: got %v, want %v", err, user.ErrWrongPassword)
+	}
+	if _, err = r.Users.Authorize("nobody", "pass"); err != user.ErrNoUser {
+		t.Fatalf("Authorize unknown user: got %v, want %v", err, user.ErrNoUser)
+	}
+
+	u, err = r.Users.Get("bob")
+	if err != nil || u.ID != bob.ID {
+		t.Fatalf("Get: got %+v, %v", u, err)
+	}
+	if _, err = r.Users.Get("nobody"); err != user.ErrNoUser {
+		t.Fatalf("Get unknown user: got %v, want %v", err, user.ErrNoUser)
+	}
+}
+
+func testPostIDs(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	for want := uint32(1); want <= 3; want++ {
+		p := &post.Post{Author: alex, Type: "text", Title: "title", Category: "music", Data: "text"}
+		id, err := r.Posts.Create(p)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if id != want || p.ID != want {
+			t.Fatalf("Create: got id %v (post.ID %v), want %v", id, p.ID, want)
+		}
+		if p.Created == "" {
+			t.Fatalf("Create: post %v has no created time", id)
+		}
+	}
+
+	if _, err := r.Posts.Delete(3); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	id := mustPost(t, r, alex, "music")
+	if id != 4 {
+		t.Fatalf("ids must not be reused after delete: got %v, want 4", id)
+	}
+
+	p, err := r.Posts.Read(4)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if p.ID != 4 || p.Author.ID != alex.ID || p.Author.Username != "alex" ||
+		p.Type != "text" || p.Title != "title" || p.Category != "music" || p.Data != "text" {
+		t.Fatalf("Read: got %+v", p)
+	}
+	if _, err = r.Posts.Read(3); err != post.ErrNoPost {
+		t.Fatalf("Read deleted post: got %v, want %v", err, post.ErrNoPost)
+	}
+}
+
+func testVotes(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	id := mustPost(t, r, alex, "music")
+
+	steps := []struct {
+		name    string
+		vote    func(uint32, *user.User) (*post.Post, error)
+		u       *user.User
+		score   int
+		percent int
+		votes   int
+	}{
+		{"alex up", r.Posts.UpVote, alex, 1, 100, 1},
+		{"alex up again", r.Posts.UpVote, alex, 1, 100, 1},
+		{"bob down", r.Posts.DownVote, bob, 0, 50, 2},
+		{"alex down", r.Posts.DownVote, alex, -2, 0, 2},
+		{"bob unvote", r.Posts.UnVote, bob, -1, 0, 1},
+		{"bob unvote again", r.Posts.UnVote, bob, -1, 0, 1},
+		{"alex up", r.Posts.UpVote, alex, 1, 100, 1},
+		{"bob up", r.Posts.UpVote, bob, 2, 100, 2},
+		{"alex unvote", r.Posts.UnVote, alex, 1, 100, 1},
+		{"bob unvote", r.Posts.UnVote, bob, 0, 0, 0},
+	}
+	for _, step := range steps {
+		p, err := step.vote(id, step.u)
+		if err != nil {
+			t.Fatalf("%v: %v", step.name, err)
+		}
+		checkVotes(t, step.name, p, step.score, step.percent, step.votes)
+
+		p, err = r.Posts.Read(id)
+		if err != nil {
+			t.Fatalf("%v: Read: %v", step.name, err)
+		}
+		checkVotes(t, step.name+" (read)", p, step.score, step.percent, step.votes)
+	}
+
+	if _, err := r.Posts.UpVote(100, alex); err != post.ErrNoPost {
+		t.Fatalf("UpVote missing post: got %v, want %v", err, post.ErrNoPost)
+	}
+	if _, err := r.Posts.DownVote(100, alex); err != post.ErrNoPost {
+		t.Fatalf("DownVote missing post: got %v, want %v", err, post.ErrNoPost)
+	}
+	if _, err := r.Posts.UnVote(100, alex); err != post.ErrNoPost {
+		t.Fatalf("UnVote missing post: got %v, want %v", err, post.ErrNoPost)
+	}
+}
+
+func testFilters(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	mustPost(t, r, alex, "music")
+	mustPost(t, r, bob, "music")
+	mustPost(t, r, bob, "news")
+
+	checkIDs(t, "ReadCategory music", read(t, r.Posts.ReadCategory, "music"), 1, 2)
+	checkIDs(t, "ReadCategory news", read(t, r.Posts.ReadCategory, "news"), 3)
+	checkIDs(t, "ReadCategory unknown", read(t, r.Posts.ReadCategory, "funny"))
+	checkIDs(t, "ReadUser alex", read(t, r.Posts.ReadUser, "alex"), 1)
+	checkIDs(t, "ReadUser bob", read(t, r.Posts.ReadUser, "bob"), 2, 3)
+	checkIDs(t, "ReadUser unknown", read(t, r.Posts.ReadUser, "nobody"))
+}
+
+func testOrdering(t *testing.T, r *Repos) {
+	users := make([]*user.User, 3)
+	for i := range users {
+		users[i] = mustUser(t, r, fmt.Sprintf("user%v", i))
+	}
+	low := mustPost(t, r, users[0], "music")
+	high := mustPost(t, r, users[0], "music")
+	mid := mustPost(t, r, users[1], "news")
+
+	for _, u := range users {
+		mustVote(t, r.Posts.UpVote, high, u)
+	}
+	mustVote(t, r.Posts.UpVote, mid, users[0])
+	mustVote(t, r.Posts.DownVote, low, users[0])
+
+	all, err := r.Posts.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	checkIDs(t, "ReadAll", all, high, mid, low)
+	checkIDs(t, "ReadCategory", read(t, r.Posts.ReadCategory, "music"), high, low)
+	checkIDs(t, "ReadUser", read(t, r.Posts.ReadUser, "user0"), high, low)
+
+	for _, u := range users {
+		mustVote(t, r.Posts.DownVote, high, u)
+	}
+	all, err = r.Posts.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	checkIDs(t, "ReadAll after votes", all, mid, low, high)
+}
+
+func testDeletePost(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, alex, "music")
+
+	ok, err := r.Posts.Delete(first)
+	if !ok || err != nil {
+		t.Fatalf("Delete: got %v, %v", ok, err)
+	}
+	ok, err = r.Posts.Delete(first)
+	if ok || err != post.ErrNoPost {
+		t.Fatalf("Delete twice: got %v, %v, want false, %v", ok, err, post.ErrNoPost)
+	}
+	ok, err = r.Posts.Delete(100)
+	if ok || err != post.ErrNoPost {
+		t.Fatalf("Delete missing: got %v, %v, want false, %v", ok, err, post.ErrNoPost)
+	}
+
+	all, err := r.Posts.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	checkIDs(t, "ReadAll", all, second)
+}
+
+func testComments(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, alex, "music")
+
+	comments, err := r.Comments.ReadAll(first)
+	if err != nil || len(comments) != 0 {
+		t.Fatalf("ReadAll without comments: got %v, %v", comments, err)
+	}
+
+	// ids are allocated per post
+	for want := uint32(1); want <= 3; want++ {
+		comm := &comment.Comment{PostID: first, Author: bob, Body: fmt.Sprintf("comment %v", want)}
+		id, err := r.Comments.Create(comm)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if id != want || comm.ID != want || comm.Created == "" {
+			t.Fatalf("Create: got id %v, comment %+v, want id %v", id, comm, want)
+		}
+	}
+	id := mustComment(t, r, second, alex)
+	if id != 1 {
+		t.Fatalf("Create on other post: got id %v, want 1", id)
+	}
+
+	ok, err := r.Comments.Delete(first, 3)
+	if !ok || err != nil {
+		t.Fatalf("Delete: got %v, %v", ok, err)
+	}
+	ok, err = r.Comments.Delete(first, 3)
+	if ok || err != comment.ErrNoComm {
+		t.Fatalf("Delete twice: got %v, %v, want false, %v", ok, err, comment.ErrNoComm)
+	}
+	ok, err = r.Comments.Delete(second, 100)
+	if ok || err != comment.ErrNoComm {
+		t.Fatalf("Delete missing: got %v, %v, want false, %v", ok, err, comment.ErrNoComm)
+	}
+	id = mustComment(t, r, first, alex)
+	if id != 4 {
+		t.Fatalf("ids must not be reused after delete: got %v, want 4", id)
+	}
+
+	comments, err = r.Comments.ReadAll(first)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(comments) != 3 || comments[0].ID != 1 || comments[1].ID != 2 || comments[2].ID != 4 {
+		t.Fatalf("ReadAll: got %v comments %+v", len(comments), comments)
+	}
+	if comments[0].Body != "comment 1" || comments[0].Author.ID != bob.ID ||
+		comments[0].Author.Username != "bob" || comments[0].PostID != first {
+		t.Fatalf("ReadAll: got %+v", comments[0])
+	}
+
+	all, err := r.Comments.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(all[first]) != 3 || len(all[second]) != 1 {
+		t.Fatalf("List: got %v and %v comments, want 3 and 1", len(all[first]), len(all[second]))
+	}
+}
+
+func testCommentsByPost(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, alex, "music")
+	for i := 0; i < 3; i++ {
+		mustComment(t, r, first, alex)
+	}
+	mustComment(t, r, second, alex)
+
+	n, err := r.Comments.DeleteByPost(first)
+	if n != 3 || err != nil {
+		t.Fatalf("DeleteByPost: got %v, %v, want 3", n, err)
+	}
+	n, err = r.Comments.DeleteByPost(first)
+	if n != 0 || err != nil {
+		t.Fatalf("DeleteByPost twice: got %v, %v, want 0", n, err)
+	}
+
+	all, err := r.Comments.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if _, ok := all[first]; ok || len(all[second]) != 1 {
+		t.Fatalf("List after DeleteByPost: got %v", all)
+	}
+}
+
+func testCommentsByUser(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, alex, "music")
+	mustComment(t, r, second, bob)
+	mustComment(t, r, second, alex)
+	mustComment(t, r, first, bob)
+	trashed := mustComment(t, r, first, bob)
+	if _, err := r.Comments.Trash(first, trashed, bob); err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+
+	list, err := r.Comments.ReadUser("bob")
+	if err != nil {
+		t.Fatalf("ReadUser: %v", err)
+	}
+	got := make([][2]uint32, 0)
+	for _, elem := range list {
+		got = append(got, [2]uint32{elem.PostID, elem.ID})
+	}
+	want := [][2]uint32{{first, 1}, {second, 1}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ReadUser: got %v, want %v", got, want)
+	}
+	if list, err = r.Comments.ReadUser("nobody"); len(list) != 0 || err != nil {
+		t.Fatalf("ReadUser of nobody: got %v, %v", list, err)
+	}
+}
+
+func testTrashPosts(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	admin := mustUser(t, r, "admin")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, alex, "music")
+
+	p, err := r.Posts.Trash(first, admin)
+	if err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	if p.DeletedAt == "" || p.DeletedBy == nil || p.DeletedBy.ID != admin.ID {
+		t.Fatalf("Trash: got deletedAt %q, deletedBy %+v", p.DeletedAt, p.DeletedBy)
+	}
+	deletedAt := p.DeletedAt
+	p, err = r.Posts.Trash(first, alex)
+	if err != nil || p.DeletedAt != deletedAt || p.DeletedBy.ID != admin.ID {
+		t.Fatalf("Trash twice must keep the first deletion: got %+v, %v", p, err)
+	}
+	if _, err = r.Posts.Trash(100, alex); err != post.ErrNoPost {
+		t.Fatalf("Trash missing: got %v, want %v", err, post.ErrNoPost)
+	}
+
+	all, err := r.Posts.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	checkIDs(t, "ReadAll", all, second)
+	checkIDs(t, "ReadCategory", read(t, r.Posts.ReadCategory, "music"), second)
+	checkIDs(t, "ReadUser", read(t, r.Posts.ReadUser, "alex"), second)
+	trash, err := r.Posts.ReadTrash()
+	if err != nil {
+		t.Fatalf("ReadTrash: %v", err)
+	}
+	checkIDs(t, "ReadTrash", trash, first)
+	if p, err = r.Posts.Read(first); err != nil || p.DeletedAt == "" {
+		t.Fatalf("Read trashed post: got %+v, %v", p, err)
+	}
+
+	p, err = r.Posts.Restore(first)
+	if err != nil || p.DeletedAt != "" || p.DeletedBy != nil {
+		t.Fatalf("Restore: got %+v, %v", p, err)
+	}
+	if _, err = r.Posts.Restore(100); err != post.ErrNoPost {
+		t.Fatalf("Restore missing: got %v, want %v", err, post.ErrNoPost)
+	}
+	all, err = r.Posts.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("ReadAll after Restore: got %v posts, want 2", len(all))
+	}
+	trash, err = r.Posts.ReadTrash()
+	if err != nil {
+		t.Fatalf("ReadTrash: %v", err)
+	}
+	checkIDs(t, "ReadTrash after Restore", trash)
+}
+
+func testRevisions(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	admin := mustUser(t, r, "admin")
+	id := mustPost(t, r, alex, "music")
+
+	revs, err := r.Posts.ReadRevisions(id)
+	if err != nil || len(revs) != 1 || revs[0].Version != 1 || revs[0].Data != "text" || revs[0].Author.ID != alex.ID {
+		t.Fatalf("ReadRevisions of a new post: got %+v, %v", revs, err)
+	}
+
+	p, err := r.Posts.Update(id, "second", "text 2", alex)
+	if err != nil || p.Title != "second" || p.Data != "text 2" || p.Edited == "" {
+		t.Fatalf("Update: got %+v, %v", p, err)
+	}
+	if _, err = r.Posts.Update(id, "third", "text 3", admin); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err = r.Posts.Update(100, "title", "text", alex); err != post.ErrNoPost {
+		t.Fatalf("Update missing: got %v, want %v", err, post.ErrNoPost)
+	}
+	if p, err = r.Posts.Read(id); err != nil || p.Title != "third" || p.Data != "text 3" {
+		t.Fatalf("Read after Update: got %+v, %v", p, err)
+	}
+
+	revs, err = r.Posts.ReadRevisions(id)
+	if err != nil {
+		t.Fatalf("ReadRevisions: %v", err)
+	}
+	want := []struct {
+		title, data string
+		author      uint32
+	}{{"title", "text", alex.ID}, {"second", "text 2", alex.ID}, {"third", "text 3", admin.ID}}
+	if len(revs) != len(want) {
+		t.Fatalf("ReadRevisions: got %v revisions, want %v", len(revs), len(want))
+	}
+	for i, w := range want {
+		if revs[i].Version != i+1 || revs[i].Title != w.title || revs[i].Data != w.data || revs[i].Author.ID != w.author {
+			t.Fatalf("revision %v: got %+v, want %+v", i+1, revs[i], w)
+		}
+	}
+	if _, err = r.Posts.ReadRevisions(100); err != post.ErrNoPost {
+		t.Fatalf("ReadRevisions missing: got %v, want %v", err, post.ErrNoPost)
+	}
+}
+
+func testCommentRevisions(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	admin := mustUser(t, r, "admin")
+	postID := mustPost(t, r, alex, "music")
+	id := mustComment(t, r, postID, alex)
+	other := mustComment(t, r, postID, alex)
+
+	comm, err := r.Comments.Update(postID, id, "second", alex)
+	if err != nil || comm.Body != "second" || comm.Edited == "" {
+		t.Fatalf("Update: got %+v, %v", comm, err)
+	}
+	if _, err = r.Comments.Update(postID, id, "third", admin); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err = r.Comments.Update(postID, 100, "body", alex); err != comment.ErrNoComm {
+		t.Fatalf("Update missing: got %v, want %v", err, comment.ErrNoComm)
+	}
+
+	comments, err := r.Comments.ReadAll(postID)
+	if err != nil || len(comments) != 2 {
+		t.Fatalf("ReadAll: got %v comments, %v", len(comments), err)
+	}
+	if comments[0].Body != "third" || comments[1].Body != "body" || comments[1].Edited != "" {
+		t.Fatalf("ReadAll after Update: got %+v, %+v", comments[0], comments[1])
+	}
+
+	revs, err := r.Comments.ReadRevisions(postID, id)
+	if err != nil {
+		t.Fatalf("ReadRevisions: %v", err)
+	}
+	want := []struct {
+		body   string
+		author uint32
+	}{{"body", alex.ID}, {"second", alex.ID}, {"third", admin.ID}}
+	if len(revs) != len(want) {
+		t.Fatalf("ReadRevisions: got %v revisions, want %v", len(revs), len(want))
+	}
+	for i, w := range want {
+		if revs[i].Version != i+1 || revs[i].Body != w.body || revs[i].Author.ID != w.author {
+			t.Fatalf("revision %v: got %+v, want %+v", i+1, revs[i], w)
+		}
+	}
+	revs, err = r.Comments.ReadRevisions(postID, other)
+	if err != nil || len(revs) != 1 || revs[0].Body != "body" {
+		t.Fatalf("ReadRevisions of a new comment: got %+v, %v", revs, err)
+	}
+	if _, err = r.Comments.ReadRevisions(postID, 100); err != comment.ErrNoComm {
+		t.Fatalf("ReadRevisions missing: got %v, want %v", err, comment.ErrNoComm)
+	}
+}
+
+func testReplies(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	postID := mustPost(t, r, alex, "music")
+	top := mustComment(t, r, postID, alex)
+	reply, err := r.Comments.Create(&comment.Comment{PostID: postID, ParentID: top, Author: alex, Body: "reply"})
+	if err != nil {
+		t.Fatalf("Create reply: %v", err)
+	}
+	nested, err := r.Comments.Create(&comment.Comment{PostID: postID, ParentID: reply, Author: alex, Body: "nested"})
+	if err != nil {
+		t.Fatalf("Create nested reply: %v", err)
+	}
+
+	comments, err := r.Comments.ReadAll(postID)
+	if err != nil || len(comments) != 3 {
+		t.Fatalf("ReadAll: got %v comments, %v", len(comments), err)
+	}
+	if comments[0].ParentID != 0 || comments[1].ParentID != top || comments[2].ParentID != reply {
+		t.Fatalf("ReadAll: got parents %v, %v, %v, want 0, %v, %v",
+			comments[0].ParentID, comments[1].ParentID, comments[2].ParentID, top, reply)
+	}
+
+	// replies of a deleted comment move up to its parent
+	if _, err = r.Comments.Delete(postID, reply); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	comments, err = r.Comments.ReadAll(postID)
+	if err != nil || len(comments) != 2 {
+		t.Fatalf("ReadAll after Delete: got %v comments, %v", len(comments), err)
+	}
+	if comments[1].ID != nested || comments[1].ParentID != top {
+		t.Fatalf("ReadAll after Delete: got %+v, want parent %v", comments[1], top)
+	}
+}
+
+func testCommentVotes(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	postID := mustPost(t, r, alex, "music")
+	id := mustComment(t, r, postID, alex)
+	mustComment(t, r, postID, alex)
+
+	check := func(name string, comm *comment.Comment, err error, score, percent, votes int) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if comm.Score != score || comm.UpvotePercentage != percent || len(comm.Votes) != votes {
+			t.Fatalf("%v: got score %v, upvotePercentage %v, %v votes, want %v, %v, %v",
+				name, comm.Score, comm.UpvotePercentage, len(comm.Votes), score, percent, votes)
+		}
+	}
+
+	comm, err := r.Comments.UpVote(postID, id, alex)
+	check("UpVote", comm, err, 1, 100, 1)
+	comm, err = r.Comments.UpVote(postID, id, alex)
+	check("UpVote twice", comm, err, 1, 100, 1)
+	comm, err = r.Comments.DownVote(postID, id, bob)
+	check("DownVote", comm, err, 0, 50, 2)
+	comm, err = r.Comments.DownVote(postID, id, alex)
+	check("DownVote after UpVote", comm, err, -2, 0, 2)
+	comm, err = r.Comments.UnVote(postID, id, bob)
+	check("UnVote", comm, err, -1, 0, 1)
+	comm, err = r.Comments.UnVote(postID, id, bob)
+	check("UnVote without vote", comm, err, -1, 0, 1)
+	if _, err = r.Comments.UpVote(postID, 100, alex); err != comment.ErrNoComm {
+		t.Fatalf("UpVote missing: got %v, want %v", err, comment.ErrNoComm)
+	}
+
+	comments, err := r.Comments.ReadAll(postID)
+	if err != nil || len(comments) != 2 {
+		t.Fatalf("ReadAll: got %v comments, %v", len(comments), err)
+	}
+	check("ReadAll", comments[0], nil, -1, 0, 1)
+	check("ReadAll other", comments[1], nil, 0, 0, 0)
+	if comments[0].Votes[0].UserID != alex.ID || comments[0].Votes[0].Vote != comment.DownVote {
+		t.Fatalf("ReadAll: got vote %+v", comments[0].Votes[0])
+	}
+	all, err := r.Comments.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	check("List", all[postID][0], nil, -1, 0, 1)
+}
+
+func testHotRank(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	id := mustPost(t, r, alex, "music")
+
+	p, err := r.Posts.Read(id)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if p.Hot == 0 || p.Hot != post.HotScore(p) {
+		t.Fatalf("Create: got hot %v, want %v", p.Hot, post.HotScore(p))
+	}
+	created := p.Hot
+
+	mustVote(t, r.Posts.UpVote, id, alex)
+	mustVote(t, r.Posts.UpVote, id, bob)
+	p, err = r.Posts.Read(id)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if p.Hot <= created || p.Hot != post.HotScore(p) {
+		t.Fatalf("UpVote: got hot %v, want %v > %v", p.Hot, post.HotScore(p), created)
+	}
+	for _, v := range p.Votes {
+		if v.Created == "" {
+			t.Fatalf("UpVote: vote %+v has no time", v)
+		}
+	}
+
+	mustVote(t, r.Posts.DownVote, id, alex)
+	mustVote(t, r.Posts.DownVote, id, bob)
+	p, err = r.Posts.Read(id)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if p.Hot >= created || p.Hot != post.HotScore(p) {
+		t.Fatalf("DownVote: got hot %v, want %v < %v", p.Hot, post.HotScore(p), created)
+	}
+}
+
+func testReadPage(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, bob, "music")
+	third := mustPost(t, r, alex, "funny")
+	fourth := mustPost(t, r, alex, "music")
+	if _, err := r.Posts.Trash(third, alex); err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	// votes must not move posts between pages
+	mustVote(t, r.Posts.UpVote, first, bob)
+
+	page := func(q *post.Query) []*post.Post {
+		t.Helper()
+		res, err := r.Posts.ReadPage(q)
+		if err != nil {
+			t.Fatalf("ReadPage %+v: %v", *q, err)
+		}
+		return res
+	}
+	checkIDs(t, "ReadPage", page(&post.Query{Limit: 2}), fourth, second)
+	checkIDs(t, "ReadPage after", page(&post.Query{After: second, Limit: 2}), first)
+	checkIDs(t, "ReadPage after last", page(&post.Query{After: first, Limit: 2}))
+	checkIDs(t, "ReadPage category", page(&post.Query{Category: "music", Limit: 10}), fourth, second, first)
+	checkIDs(t, "ReadPage author", page(&post.Query{Author: "alex", Limit: 10}), fourth, first)
+	checkIDs(t, "ReadPage author after", page(&post.Query{Author: "alex", After: fourth, Limit: 1}), first)
+
+	fifth := mustPost(t, r, bob, "news")
+	mustPost(t, r, bob, "videos")
+	checkIDs(t, "ReadPage categories", page(&post.Query{Categories: []string{"news", "funny", "music"}, Limit: 3}),
+		fifth, fourth, second)
+	checkIDs(t, "ReadPage categories after", page(&post.Query{Categories: []string{"news", "music"}, After: second, Limit: 3}),
+		first)
+}
+
+func testTags(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	ids := make([]uint32, 0, 4)
+	for _, p := range []*post.Post{
+		{Category: "music", Flair: "news", Tags: []string{"go", "rock"}},
+		{Category: "funny", Tags: []string{"go"}},
+		{Category: "music", Flair: "news"},
+		{Category: "news", Tags: []string{"rock", "go"}},
+	} {
+		p.Author, p.Type, p.Title, p.Data = alex, "text", "title", "text"
+		id, err := r.Posts.Create(p)
+		if err != nil {
+			t.Fatalf("Create post: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	p, err := r.Posts.Read(ids[3])
+	if err != nil || fmt.Sprint(p.Tags) != "[rock go]" || p.Flair != "" {
+		t.Fatalf("Read tagged post: got %+v, %v", p, err)
+	}
+	p, err = r.Posts.Read(ids[2])
+	if err != nil || len(p.Tags) != 0 || p.Flair != "news" {
+		t.Fatalf("Read post with flair: got %+v, %v", p, err)
+	}
+
+	tagged := func(tag string, want ...uint32) {
+		t.Helper()
+		posts, err := r.Posts.ReadTag(tag)
+		if err != nil {
+			t.Fatalf("ReadTag %v: %v", tag, err)
+		}
+		got := make([]uint32, 0, len(posts))
+		for _, elem := range posts {
+			got = append(got, elem.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("ReadTag %v: got %v, want %v", tag, got, want)
+		}
+	}
+	tagged("go", ids[0], ids[1], ids[3])
+	tagged("rock", ids[0], ids[3])
+	tagged("jazz")
+
+	for _, tc := range []struct {
+		q    *post.Query
+		want []uint32
+	}{
+		{&post.Query{Tag: "go", Limit: 10}, []uint32{ids[3], ids[1], ids[0]}},
+		{&post.Query{Flair: "news", Limit: 10}, []uint32{ids[2], ids[0]}},
+		{&post.Query{Flair: "news", Tag: "rock", Limit: 10}, []uint32{ids[0]}},
+		{&post.Query{Category: "funny", Tag: "rock", Limit: 10}, []uint32{}},
+	} {
+		page, err := r.Posts.ReadPage(tc.q)
+		if err != nil {
+			t.Fatalf("ReadPage %+v: %v", *tc.q, err)
+		}
+		got := make([]uint32, 0, len(page))
+		for _, elem := range page {
+			got = append(got, elem.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Fatalf("ReadPage %+v: got %v, want %v", *tc.q, got, tc.want)
+		}
+	}
+
+	if _, err = r.Posts.Trash(ids[1], alex); err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	tagged("go", ids[0], ids[3])
+	if _, err = r.Posts.Delete(ids[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	tagged("go", ids[3])
+	tagged("rock", ids[3])
+}
+
+func testViews(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	id := mustPost(t, r, alex, "music")
+	for i := 1; i <= 3; i++ {
+		p, err := r.Posts.IncViews(id)
+		if err != nil || p.Views != uint32(i) {
+			t.Fatalf("IncViews %v: got %+v, %v", i, p, err)
+		}
+	}
+	p, err := r.Posts.Read(id)
+	if err != nil || p.Views != 3 {
+		t.Fatalf("Read after IncViews: got %+v, %v", p, err)
+	}
+	if _, err = r.Posts.IncViews(id + 1); err != post.ErrNoPost {
+		t.Fatalf("IncViews of a missing post: got %v, want %v", err, post.ErrNoPost)
+	}
+}
+
+func testMarks(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	id, err := r.Posts.Create(&post.Post{Author: alex, Type: "text", Title: "title", Category: "music", Data: "text", NSFW: true})
+	if err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	p, err := r.Posts.Read(id)
+	if err != nil || !p.NSFW || p.Spoiler {
+		t.Fatalf("Read marked post: got %+v, %v", p, err)
+	}
+
+	p, err = r.Posts.Mark(id, false, true)
+	if err != nil || p.NSFW || !p.Spoiler {
+		t.Fatalf("Mark: got %+v, %v", p, err)
+	}
+	p, err = r.Posts.Read(id)
+	if err != nil || p.NSFW || !p.Spoiler {
+		t.Fatalf("Read after Mark: got %+v, %v", p, err)
+	}
+	if _, err = r.Posts.Mark(id+1, true, true); err != post.ErrNoPost {
+		t.Fatalf("Mark of a missing post: got %v, want %v", err, post.ErrNoPost)
+	}
+}
+
+func testContent(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	content := `{"image":{"url":"/media/a.jpg","width":640}}`
+	id, err := r.Posts.Create(&post.Post{Author: alex, Type: "image", Title: "title", Category: "music",
+		Data: "/media/a.jpg", Content: json.RawMessage(content)})
+	if err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	p, err := r.Posts.Read(id)
+	if err != nil || string(p.Content) != content || p.Data != "/media/a.jpg" {
+		t.Fatalf("Read post with content: got %+v, %v", p, err)
+	}
+	posts, err := r.Posts.ReadCategory("music")
+	if err != nil || len(posts) != 1 || string(posts[0].Content) != content {
+		t.Fatalf("ReadCategory: got %+v, %v", posts, err)
+	}
+
+	// change sees the current post
+	var seen string
+	next := `{"image":{"url":"/media/b.jpg"}}`
+	p, err = r.Posts.UpdateContent(id, func(p *post.Post) (json.RawMessage, error) {
+		seen = string(p.Content)
+		return json.RawMessage(next), nil
+	})
+	if err != nil || seen != content || string(p.Content) != next {
+		t.Fatalf("UpdateContent: got %+v, %v, change saw %v", p, err, seen)
+	}
+	p, err = r.Posts.Read(id)
+	if err != nil || string(p.Content) != next {
+		t.Fatalf("Read after UpdateContent: got %+v, %v", p, err)
+	}
+
+	// an error of change leaves the content as is
+	errRefused := errors.New("refused")
+	_, err = r.Posts.UpdateContent(id, func(p *post.Post) (json.RawMessage, error) {
+		return nil, errRefused
+	})
+	if err != errRefused {
+		t.Fatalf("UpdateContent refused: got %v, want %v", err, errRefused)
+	}
+	if p, err = r.Posts.Read(id); err != nil || string(p.Content) != next {
+		t.Fatalf("Read after a refused UpdateContent: got %+v, %v", p, err)
+	}
+
+	p, err = r.Posts.UpdateContent(id, func(p *post.Post) (json.RawMessage, error) { return nil, nil })
+	if err != nil || p.Content != nil {
+		t.Fatalf("UpdateContent to nothing: got %+v, %v", p, err)
+	}
+	if p, err = r.Posts.Read(id); err != nil || p.Content != nil {
+		t.Fatalf("Read after clearing the content: got %+v, %v", p, err)
+	}
+	_, err = r.Posts.UpdateContent(id+1, func(p *post.Post) (json.RawMessage, error) { return nil, nil })
+	if err != post.ErrNoPost {
+		t.Fatalf("UpdateContent of a missing post: got %v, want %v", err, post.ErrNoPost)
+	}
+}
+
+// testConcurrentContent counts in the content of a post from many
+// goroutines, no update may be lost.
+func testConcurrentContent(t *testing.T, r *Repos) {
+	const workers = 8
+	alex := mustUser(t, r, "alex")
+	id := mustPost(t, r, alex, "music")
+
+	type counter struct {
+		N int `json:"n"`
+	}
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Posts.UpdateContent(id, func(p *post.Post) (json.RawMessage, error) {
+				c := &counter{}
+				if p.Content != nil {
+					if err := json.Unmarshal(p.Content, c); err != nil {
+						return nil, err
+					}
+				}
+				c.N++
+				return json.Marshal(c)
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent UpdateContent: %v", err)
+		}
+	}
+
+	p, err := r.Posts.Read(id)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	c := &counter{}
+	if err = json.Unmarshal(p.Content, c); err != nil || c.N != workers {
+		t.Fatalf("Read after concurrent UpdateContent: got %s, %v, want %v updates", p.Content, err, workers)
+	}
+}
+
+func testTrashComments(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	id := mustPost(t, r, alex, "music")
+	mustComment(t, r, id, alex)
+	mustComment(t, r, id, alex)
+
+	comm, err := r.Comments.Trash(id, 1, alex)
+	if err != nil || comm.DeletedAt == "" || comm.DeletedBy == nil || comm.DeletedBy.ID != alex.ID {
+		t.Fatalf("Trash: got %+v, %v", comm, err)
+	}
+	if _, err = r.Comments.Trash(id, 100, alex); err != comment.ErrNoComm {
+		t.Fatalf("Trash missing: got %v, want %v", err, comment.ErrNoComm)
+	}
+
+	// trashed comments stay in the thread
+	comments, err := r.Comments.ReadAll(id)
+	if err != nil || len(comments) != 2 || comments[0].DeletedAt == "" || comments[1].DeletedAt != "" {
+		t.Fatalf("ReadAll: got %+v, %v", comments, err)
+	}
+	trash, err := r.Comments.ReadTrash()
+	if err != nil || len(trash) != 1 || trash[0].ID != 1 || trash[0].PostID != id || trash[0].Body != "body" {
+		t.Fatalf("ReadTrash: got %+v, %v", trash, err)
+	}
+
+	comm, err = r.Comments.Restore(id, 1)
+	if err != nil || comm.DeletedAt != "" || comm.DeletedBy != nil {
+		t.Fatalf("Restore: got %+v, %v", comm, err)
+	}
+	if _, err = r.Comments.Restore(id, 100); err != comment.ErrNoComm {
+		t.Fatalf("Restore missing: got %v, want %v", err, comment.ErrNoComm)
+	}
+	trash, err = r.Comments.ReadTrash()
+	if err != nil || len(trash) != 0 {
+		t.Fatalf("ReadTrash after Restore: got %+v, %v", trash, err)
+	}
+}
+
+func testConcurrent(t *testing.T, r *Repos) {
+	const workers = 8
+	users := make([]*user.User, workers)
+	for i := range users {
+		users[i] = mustUser(t, r, fmt.Sprintf("user%v", i))
+	}
+	target := mustPost(t, r, users[0], "music")
+
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, workers*8)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(u *user.User) {
+			defer wg.Done()
+			_, err := r.Posts.Create(&post.Post{Author: u, Type: "text", Title: "title", Category: "music"})
+			errs <- err
+			_, err = r.Posts.DownVote(target, u)
+			errs <- err
+			_, err = r.Posts.UpVote(target, u)
+			errs <- err
+			_, err = r.Comments.Create(&comment.Comment{PostID: target, Author: u, Body: "body"})
+			errs <- err
+			_, err = r.Posts.ReadAll()
+			errs <- err
+			_, err = r.Posts.ReadCategory("music")
+			errs <- err
+			_, err = r.Comments.List()
+			errs <- err
+			_, err = r.Users.Get(u.Username)
+			errs <- err
+		}(users[i])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent call: %v", err)
+		}
+	}
+
+	all, err := r.Posts.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(all) != workers+1 {
+		t.Fatalf("ReadAll: got %v posts, want %v", len(all), workers+1)
+	}
+	p, err := r.Posts.Read(target)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	checkVotes(t, "after concurrent votes", p, workers, 100, workers)
+
+	comments, err := r.Comments.ReadAll(target)
+	if err != nil {
+		t.Fatalf("ReadAll comments: %v", err)
+	}
+	seen := make(map[uint32]bool)
+	for _, comm := range comments {
+		seen[comm.ID] = true
+	}
+	if len(comments) != workers || len(seen) != workers {
+		t.Fatalf("concurrent comments: got %v comments with %v distinct ids, want %v", len(comments), len(seen), workers)
+	}
+}
+
+// testConcurrentTrash reads the deletion marks of comments handed out by
+// the repo while they are trashed and restored, for -race to check.
+func testConcurrentTrash(t *testing.T, r *Repos) {
+	const rounds = 20
+	alex := mustUser(t, r, "alex")
+	postID := mustPost(t, r, alex, "music")
+	commID := mustComment(t, r, postID, alex)
+	handed, err := r.Comments.ReadAll(postID)
+	if err != nil || len(handed) != 1 {
+		t.Fatalf("ReadAll comments: got %v, %v", handed, err)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	errs := make(chan error, rounds*2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			_, err := r.Comments.Trash(postID, commID, alex)
+			errs <- err
+			_, err = r.Comments.Restore(postID, commID)
+			errs <- err
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds*100; i++ {
+			if handed[0].DeletedAt != "" || handed[0].DeletedBy != nil {
+				break
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent trash: %v", err)
+		}
+	}
+	if _, err = r.Comments.Trash(postID, commID, alex); err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	if handed[0].DeletedAt != "" || handed[0].DeletedBy != nil {
+		t.Fatalf("Trash changed a comment handed out before: %+v", handed[0])
+	}
+	comm, err := r.Comments.Restore(postID, commID)
+	if err != nil || comm.DeletedAt != "" || comm.DeletedBy != nil {
+		t.Fatalf("Restore after concurrent trash: got %+v, %v", comm, err)
+	}
+}
+
+// testConcurrentPosts marshals posts handed out by the repo while votes,
+// trash, marks, views and edits change them.
+func testConcurrentPosts(t *testing.T, r *Repos) {
+	const rounds = 20
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	id, err := r.Posts.Create(&post.Post{
+		Author:   alex,
+		Category: "music",
+		Type:     "text",
+		Title:    "title",
+		Data:     "data",
+		Tags:     []string{"rock"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	handed, err := r.Posts.Read(id)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	before, err := json.Marshal(handed)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, rounds*10)
+	changes := []func(){
+		func() {
+			for i := 0; i < rounds; i++ {
+				_, err := r.Posts.UpVote(id, alex)
+				errs <- err
+				_, err = r.Posts.DownVote(id, bob)
+				errs <- err
+				_, err = r.Posts.UnVote(id, alex)
+				errs <- err
+			}
+		},
+		func() {
+			for i := 0; i < rounds; i++ {
+				_, err := r.Posts.Trash(id, alex)
+				errs <- err
+				_, err = r.Posts.Restore(id)
+				errs <- err
+			}
+		},
+		func() {
+			for i := 0; i < rounds; i++ {
+				_, err := r.Posts.Mark(id, i%2 == 0, i%2 == 1)
+				errs <- err
+				_, err = r.Posts.IncViews(id)
+				errs <- err
+				_, err = r.Posts.Update(id, "title", fmt.Sprintf("data %v", i), alex)
+				errs <- err
+			}
+		},
+	}
+	for _, change := range changes {
+		wg.Add(1)
+		go func(change func()) {
+			defer wg.Done()
+			change()
+		}(change)
+	}
+	readers := []func() ([]*post.Post, error){
+		r.Posts.ReadAll,
+		func() ([]*post.Post, error) { return r.Posts.ReadTag("rock") },
+		func() ([]*post.Post, error) {
+			p, err := r.Posts.Read(id)
+			return []*post.Post{p}, err
+		},
+	}
+	for _, readPosts := range readers {
+		wg.Add(1)
+		go func(readPosts func() ([]*post.Post, error)) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				posts, err := readPosts()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, err = json.Marshal(posts); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(readPosts)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent post changes: %v", err)
+		}
+	}
+
+	after, err := json.Marshal(handed)
+	if err != nil || string(after) != string(before) {
+		t.Fatalf("changes reached a post handed out before: got %s, %v, want %s", after, err, before)
+	}
+	p, err := r.Posts.Read(id)
+	if err != nil || p.DeletedAt != "" || p.Views != rounds || p.Data != fmt.Sprintf("data %v", rounds-1) {
+		t.Fatalf("Read after concurrent changes: got %+v, %v", p, err)
+	}
+	checkVotes(t, "after concurrent votes", p, -1, 0, 1)
+}
+
+func testSaved(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, alex, "music")
+	comm := mustComment(t, r, first, bob)
+
+	for _, item := range []*saved.Item{
+		{UserID: alex.ID, PostID: first},
+		{UserID: alex.ID, PostID: first, CommentID: comm, Folder: "later"},
+		{UserID: alex.ID, PostID: second, Folder: "later"},
+		{UserID: bob.ID, PostID: first},
+	} {
+		if err := r.Saved.Save(item); err != nil {
+			t.Fatalf("Save %+v: %v", item, err)
+		}
+	}
+
+	items := func(u *user.User, folder string, want ...string) {
+		t.Helper()
+		list, err := r.Saved.List(u.ID, folder)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		got := make([]string, 0, len(list))
+		for _, elem := range list {
+			got = append(got, fmt.Sprintf("%v/%v:%v", elem.PostID, elem.CommentID, elem.Folder))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("List %v of %v: got %v, want %v", folder, u.Username, got, want)
+		}
+	}
+	items(alex, "", "2/0:later", "1/1:later", "1/0:saved")
+	items(alex, "later", "2/0:later", "1/1:later")
+	items(bob, "", "1/0:saved")
+
+	// saving again moves the item to the top of another folder
+	if err := r.Saved.Save(&saved.Item{UserID: alex.ID, PostID: first, Folder: "later"}); err != nil {
+		t.Fatalf("Save again: %v", err)
+	}
+	items(alex, "", "1/0:later", "2/0:later", "1/1:later")
+	folders, err := r.Saved.Folders(alex.ID)
+	if err != nil || len(folders) != 1 || folders[0].Name != "later" || folders[0].Count != 3 {
+		t.Fatalf("Folders: got %+v, %v", folders, err)
+	}
+
+	ok, err := r.Saved.Unsave(alex.ID, second, 0)
+	if err != nil || !ok {
+		t.Fatalf("Unsave: got %v, %v", ok, err)
+	}
+	if ok, err = r.Saved.Unsave(alex.ID, second, 0); err != nil || ok {
+		t.Fatalf("Unsave twice: got %v, %v", ok, err)
+	}
+	items(alex, "", "1/0:later", "1/1:later")
+
+	if err = r.Saved.Save(&saved.Item{UserID: bob.ID, PostID: first, CommentID: comm}); err != nil {
+		t.Fatalf("Save comment: %v", err)
+	}
+	n, err := r.Saved.DeleteByComment(first, comm)
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteByComment: got %v, %v, want 2", n, err)
+	}
+	if n, err = r.Saved.DeleteByComment(first, comm); err != nil || n != 0 {
+		t.Fatalf("DeleteByComment twice: got %v, %v, want 0", n, err)
+	}
+	items(alex, "", "1/0:later")
+	items(bob, "", "1/0:saved")
+
+	n, err = r.Saved.DeleteByPost(first)
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteByPost: got %v, %v, want 2", n, err)
+	}
+	if n, err = r.Saved.DeleteByPost(first); err != nil || n != 0 {
+		t.Fatalf("DeleteByPost twice: got %v, %v, want 0", n, err)
+	}
+	items(alex, "")
+	items(bob, "")
+}
+
+func testMutes(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	first := mustPost(t, r, alex, "music")
+	second := mustPost(t, r, alex, "music")
+
+	for _, id := range []uint32{second, first, second} {
+		if err := r.Mutes.Hide(alex.ID, id); err != nil {
+			t.Fatalf("Hide %v: %v", id, err)
+		}
+	}
+	if err := r.Mutes.Hide(bob.ID, first); err != nil {
+		t.Fatalf("Hide: %v", err)
+	}
+	hidden := func(u *user.User, want ...uint32) {
+		t.Helper()
+		ids, err := r.Mutes.Hidden(u.ID)
+		if err != nil || fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Fatalf("Hidden of %v: got %v, %v, want %v", u.Username, ids, err, want)
+		}
+	}
+	hidden(alex, second, first)
+	hidden(bob, first)
+
+	ok, err := r.Mutes.Unhide(alex.ID, second)
+	if err != nil || !ok {
+		t.Fatalf("Unhide: got %v, %v", ok, err)
+	}
+	if ok, err = r.Mutes.Unhide(alex.ID, second); err != nil || ok {
+		t.Fatalf("Unhide twice: got %v, %v", ok, err)
+	}
+	hidden(alex, first)
+
+	n, err := r.Mutes.DeleteByPost(first)
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteByPost: got %v, %v, want 2", n, err)
+	}
+	hidden(alex)
+	hidden(bob)
+
+	for _, rule := range []*mute.Rule{
+		{Kind: mute.KindKeyword, Value: "spoiler"},
+		{Kind: mute.KindAuthor, Value: "bob"},
+		{Kind: mute.KindKeyword, Value: "spoiler"},
+	} {
+		if err = r.Mutes.AddRule(alex.ID, rule); err != nil {
+			t.Fatalf("AddRule %+v: %v", rule, err)
+		}
+	}
+	rules := func(u *user.User, want ...string) {
+		t.Helper()
+		list, err := r.Mutes.Rules(u.ID)
+		if err != nil {
+			t.Fatalf("Rules: %v", err)
+		}
+		got := make([]string, 0, len(list))
+		for _, elem := range list {
+			got = append(got, elem.Kind+":"+elem.Value)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("Rules of %v: got %v, want %v", u.Username, got, want)
+		}
+	}
+	rules(alex, "keyword:spoiler", "author:bob")
+	rules(bob)
+
+	ok, err = r.Mutes.RemoveRule(alex.ID, &mute.Rule{Kind: mute.KindKeyword, Value: "spoiler"})
+	if err != nil || !ok {
+		t.Fatalf("RemoveRule: got %v, %v", ok, err)
+	}
+	if ok, err = r.Mutes.RemoveRule(alex.ID, &mute.Rule{Kind: mute.KindAuthor, Value: "carl"}); err != nil || ok {
+		t.Fatalf("RemoveRule of a missing rule: got %v, %v", ok, err)
+	}
+	rules(alex, "author:bob")
+}
+
+func testPrefs(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+
+	p, err := r.Prefs.Get(alex.ID)
+	if err != nil || *p != prefs.Defaults {
+		t.Fatalf("Get unset: got %+v, %v, want %+v", p, err, prefs.Defaults)
+	}
+	// the copy of defaults is the caller's
+	p.NSFW = prefs.Show
+	if p, err = r.Prefs.Get(bob.ID); err != nil || *p != prefs.Defaults {
+		t.Fatalf("Get after changing a copy: got %+v, %v", p, err)
+	}
+
+	want := prefs.Preferences{NSFW: prefs.Blur, Spoiler: prefs.Show}
+	if err = r.Prefs.Set(alex.ID, &want); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if p, err = r.Prefs.Get(alex.ID); err != nil || *p != want {
+		t.Fatalf("Get: got %+v, %v, want %+v", p, err, want)
+	}
+	want.Spoiler = prefs.Hide
+	if err = r.Prefs.Set(alex.ID, &want); err != nil {
+		t.Fatalf("Set again: %v", err)
+	}
+	if p, err = r.Prefs.Get(alex.ID); err != nil || *p != want {
+		t.Fatalf("Get after Set again: got %+v, %v, want %+v", p, err, want)
+	}
+	if p, err = r.Prefs.Get(bob.ID); err != nil || *p != prefs.Defaults {
+		t.Fatalf("Get of another user: got %+v, %v", p, err)
+	}
+}
+
+func mustUser(t *testing.T, r *Repos, login string) *user.User {
+	t.Helper()
+	u, err := r.Users.CreateUser(login, login+"-pass")
+	if err != nil {
+		t.Fatalf("CreateUser %v: %v", login, err)
+	}
+	return u
+}
+
+func mustPost(t *testing.T, r *Repos, author *user.User, category string) uint32 {
+	t.Helper()
+	id, err := r.Posts.Create(&post.Post{Author: author, Type: "text", Title: "title", Category: category, Data: "text"})
+	if err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	return id
+}
+
+func mustComment(t *testing.T, r *Repos, postID uint32, author *user.User) uint32 {
+	t.Helper()
+	id, err := r.Comments.Create(&comment.Comment{PostID: postID, Author: author, Body: "body"})
+	if err != nil {
+		t.Fatalf("Create comment: %v", err)
+	}
+	return id
+}
+
+func mustVote(t *testing.T, vote func(uint32, *user.User) (*post.Post, error), id uint32, u *user.User) {
+	t.Helper()
+	if _, err := vote(id, u); err != nil {
+		t.Fatalf("vote for %v: %v", id, err)
+	}
+}
+
+func read(t *testing.T, list func(string) ([]*post.Post, error), arg string) []*post.Post {
+	t.Helper()
+	res, err := list(arg)
+	if err != nil {
+		t.Fatalf("list %v: %v", arg, err)
+	}
+	return res
+}
+
+func checkIDs(t *testing.T, name string, posts []*post.Post, want ...uint32) {
+	t.Helper()
+	got := make([]uint32, 0, len(posts))
+	for _, p := range posts {
+		got = append(got, p.ID)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("%v: got posts %v, want %v", name, got, want)
+	}
+}
+
+func checkVotes(t *testing.T, name string, p *post.Post, score, percent, votes int) {
+	t.Helper()
+	if p.Score != score || p.UpvotePercentage != percent || len(p.Votes) != votes {
+		t.Fatalf("%v: got score %v, upvotePercentage %v, %v votes, want %v, %v, %v",
+			name, p.Score, p.UpvotePercentage, len(p.Votes), score, percent, votes)
+	}
+}
+
+func testCategories(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	if err := category.Seed(r.Categories); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	if err := category.Seed(r.Categories); err != nil {
+		t.Fatalf("Seed twice: %v", err)
+	}
+
+	golang := &category.Category{
+		Name:      "golang",
+		Title:     "Go",
+		Creator:   alex,
+		Rules:     []string{"be nice", "no spam"},
+		PostTypes: []string{"text"},
+	}
+	if err := r.Categories.Create(golang); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if golang.Created == "" {
+		t.Fatalf("Create must set the creation time")
+	}
+	err := r.Categories.Create(&category.Category{Name: "golang", Title: "Other"})
+	if err != category.ErrAlreadyExist {
+		t.Fatalf("duplicate category: got %v, want %v", err, category.ErrAlreadyExist)
+	}
+
+	c, err := r.Categories.Get("golang")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if c.Title != "Go" || c.Creator == nil || c.Creator.Username != "alex" ||
+		len(c.Rules) != 2 || c.Rules[1] != "no spam" || !c.Allows("text") || c.Allows("link") {
+		t.Fatalf("Get: got %+v", c)
+	}
+	music, err := r.Categories.Get("music")
+	if err != nil || music.Creator != nil || !music.Allows("link") {
+		t.Fatalf("default category: got %+v, %v", music, err)
+	}
+	if _, err = r.Categories.Get("nope"); err != category.ErrNoCategory {
+		t.Fatalf("Get unknown: got %v, want %v", err, category.ErrNoCategory)
+	}
+
+	list, err := r.Categories.List()
+	if err != nil || len(list) != len(category.Defaults)+1 {
+		t.Fatalf("List: got %v categories, %v", len(list), err)
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Name >= list[i].Name {
+			t.Fatalf("List must be sorted by name: %v before %v", list[i-1].Name, list[i].Name)
+		}
+	}
+}
+
+func testSubscriptions(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	if err := category.Seed(r.Categories); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+
+	subs := func(u *user.User, want ...string) {
+		t.Helper()
+		got, err := r.Categories.Subscriptions(u.ID)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("Subscriptions of %v: got %v, %v, want %v", u.Username, got, err, want)
+		}
+	}
+	subs(alex)
+
+	for _, name := range []string{"news", "music", "news"} {
+		if err := r.Categories.Subscribe(name, alex); err != nil {
+			t.Fatalf("Subscribe %v: %v", name, err)
+		}
+	}
+	if err := r.Categories.Subscribe("funny", bob); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := r.Categories.Subscribe("nope", alex); err != category.ErrNoCategory {
+		t.Fatalf("Subscribe unknown: got %v, want %v", err, category.ErrNoCategory)
+	}
+	subs(alex, "music", "news")
+	subs(bob, "funny")
+
+	if err := r.Categories.Unsubscribe("news", alex); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if err := r.Categories.Unsubscribe("videos", alex); err != nil {
+		t.Fatalf("Unsubscribe not subscribed: %v", err)
+	}
+	if err := r.Categories.Unsubscribe("nope", alex); err != category.ErrNoCategory {
+		t.Fatalf("Unsubscribe unknown: got %v, want %v", err, category.ErrNoCategory)
+	}
+	subs(alex, "music")
+	subs(bob, "funny")
+}
+
+func testFollows(t *testing.T, r *Repos) {
+	alex := mustUser(t, r, "alex")
+	bob := mustUser(t, r, "bob")
+	carl := mustUser(t, r, "carl")
+
+	logins := func(what string, list func(string) ([]*user.User, error), login string, want ...string) {
+		t.Helper()
+		users, err := list(login)
+		if err != nil {
+			t.Fatalf("%v of %v: %v", what, login, err)
+		}
+		got := make([]string, 0, len(users))
+		for _, u := range users {
+			got = append(got, u.Username)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%v of %v: got %v, want %v", what, login, got, want)
+		}
+	}
+
+	for _, f := range []struct {
+		follower *user.User
+		login    string
+	}{{alex, "carl"}, {alex, "bob"}, {alex, "bob"}, {carl, "bob"}} {
+		if err := r.Users.Follow(f.follower, f.login); err != nil {
+			t.Fatalf("Follow %v: %v", f.login, err)
+		}
+	}
+	if err := r.Users.Follow(alex, "alex"); err != user.ErrSelfFollow {
+		t.Fatalf("Follow self: got %v, want %v", err, user.ErrSelfFollow)
+	}
+	if err := r.Users.Follow(alex, "nobody"); err != user.ErrNoUser {
+		t.Fatalf("Follow unknown: got %v, want %v", err, user.ErrNoUser)
+	}
+	logins("Following", r.Users.Following, "alex", "bob", "carl")
+	logins("Followers", r.Users.Followers, "bob", "alex", "carl")
+	logins("Followers", r.Users.Followers, "alex")
+
+	if err := r.Users.Unfollow(alex, "bob"); err != nil {
+		t.Fatalf("Unfollow: %v", err)
+	}
+	if err := r.Users.Unfollow(bob, "alex"); err != nil {
+		t.Fatalf("Unfollow not followed: %v", err)
+	}
+	logins("Following", r.Users.Following, "alex", "carl")
+	logins("Followers", r.Users.Followers, "bob", "carl")
+	if _, err := r.Users.Followers("nobody"); err != user.ErrNoUser {
+		t.Fatalf("Followers of unknown: got %v, want %v", err, user.ErrNoUser)
+	}
+}
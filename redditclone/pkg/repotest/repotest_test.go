@@ -0,0 +1,27 @@
+package repotest_test
+
+import (
+	"fakereddit/redditclone/pkg/repotest"
+	"fakereddit/redditclone/pkg/user"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// the suite creates hundreds of users, hashing is not what it tests
+	user.PasswordCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+func TestMemoryRepos(t *testing.T) {
+	repotest.Run(t, repotest.Memory)
+}
+
+func TestSQLiteRepos(t *testing.T) {
+	repotest.Run(t, repotest.SQLite)
+}
+
+func TestDurableRepos(t *testing.T) {
+	repotest.Run(t, repotest.Durable)
+}
@@ -0,0 +1,117 @@
+package saved
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"sync"
+)
+
+const (
+	opSave         = "save"
+	opUnsave       = "unsave"
+	opDeleteByPost = "deletepost"
+	opDeleteByComm = "deletecomment"
+)
+
+// DurableSavedRepo is a SavedDataRepo which logs every mutation to a
+// journal and restores itself from it on start.
+type DurableSavedRepo struct {
+	*SavedDataRepo
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+type savedSnapshot struct {
+	Data map[uint32][]*Item `json:"data"`
+}
+
+func NewDurableSavedRepo(j *journal.Journal) (*DurableSavedRepo, error) {
+	repo := &DurableSavedRepo{
+		SavedDataRepo: NewSavedRepo(),
+		mu:            &sync.Mutex{},
+		journal:       j,
+	}
+
+	err := j.Load(repo.restore, repo.apply)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (dr *DurableSavedRepo) restore(state json.RawMessage) error {
+	snap := &savedSnapshot{}
+	if err := json.Unmarshal(state, snap); err != nil {
+		return err
+	}
+	if snap.Data != nil {
+		dr.Data = snap.Data
+	}
+	return nil
+}
+
+func (dr *DurableSavedRepo) apply(op string, data json.RawMessage) error {
+	item := &Item{}
+	if err := json.Unmarshal(data, item); err != nil {
+		return err
+	}
+	var err error
+	switch op {
+	case opSave:
+		err = dr.SavedDataRepo.Save(item)
+	case opUnsave:
+		_, err = dr.SavedDataRepo.Unsave(item.UserID, item.PostID, item.CommentID)
+	case opDeleteByPost:
+		_, err = dr.SavedDataRepo.DeleteByPost(item.PostID)
+	case opDeleteByComm:
+		_, err = dr.SavedDataRepo.DeleteByComment(item.PostID, item.CommentID)
+	}
+	return err
+}
+
+func (dr *DurableSavedRepo) Save(item *Item) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.SavedDataRepo.Save(item); err != nil {
+		return err
+	}
+	return dr.journal.Append(opSave, item)
+}
+
+func (dr *DurableSavedRepo) Unsave(userID, postID, commentID uint32) (bool, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	ok, err := dr.SavedDataRepo.Unsave(userID, postID, commentID)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, dr.journal.Append(opUnsave, &Item{UserID: userID, PostID: postID, CommentID: commentID})
+}
+
+func (dr *DurableSavedRepo) DeleteByPost(postID uint32) (int, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	n, err := dr.SavedDataRepo.DeleteByPost(postID)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, dr.journal.Append(opDeleteByPost, &Item{PostID: postID})
+}
+
+func (dr *DurableSavedRepo) DeleteByComment(postID, commentID uint32) (int, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	n, err := dr.SavedDataRepo.DeleteByComment(postID, commentID)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, dr.journal.Append(opDeleteByComm, &Item{PostID: postID, CommentID: commentID})
+}
+
+func (dr *DurableSavedRepo) Snapshot() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.SavedDataRepo.mu.RLock()
+	defer dr.SavedDataRepo.mu.RUnlock()
+	return dr.journal.Compact(&savedSnapshot{Data: dr.Data})
+}
@@ -0,0 +1,118 @@
+package saved
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type SavedDataRepo struct {
+	mu *sync.RWMutex
+	// Data are items of every user in the order they were saved
+	Data map[uint32][]*Item
+}
+
+func NewSavedRepo() *SavedDataRepo {
+	log.Printf("NewSavedRepo: created SavedDataRepo")
+	return &SavedDataRepo{
+		Data: make(map[uint32][]*Item),
+		mu:   &sync.RWMutex{},
+	}
+}
+
+func (sr *SavedDataRepo) Save(item *Item) error {
+	if item.Folder == "" {
+		item.Folder = DefaultFolder
+	}
+	if item.Saved == "" {
+		item.Saved = time.Now().Format(time.RFC3339)
+	}
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.remove(item.UserID, item.PostID, item.CommentID)
+	sr.Data[item.UserID] = append(sr.Data[item.UserID], item)
+	log.Printf("Save: user %v saved %v/%v to '%v'", item.UserID, item.PostID, item.CommentID, item.Folder)
+	return nil
+}
+
+func (sr *SavedDataRepo) Unsave(userID, postID, commentID uint32) (bool, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	ok := sr.remove(userID, postID, commentID)
+	log.Printf("Unsave: user %v removed %v/%v: %v", userID, postID, commentID, ok)
+	return ok, nil
+}
+
+func (sr *SavedDataRepo) List(userID uint32, folder string) ([]*Item, error) {
+	res := make([]*Item, 0)
+	sr.mu.RLock()
+	items := sr.Data[userID]
+	for idx := len(items) - 1; idx >= 0; idx-- {
+		if folder == "" || items[idx].Folder == folder {
+			res = append(res, items[idx])
+		}
+	}
+	sr.mu.RUnlock()
+	return res, nil
+}
+
+func (sr *SavedDataRepo) Folders(userID uint32) ([]*Folder, error) {
+	counts := make(map[string]int)
+	sr.mu.RLock()
+	for _, elem := range sr.Data[userID] {
+		counts[elem.Folder]++
+	}
+	sr.mu.RUnlock()
+
+	res := make([]*Folder, 0, len(counts))
+	for name, count := range counts {
+		res = append(res, &Folder{Name: name, Count: count})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (sr *SavedDataRepo) DeleteByPost(postID uint32) (int, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	n := 0
+	for userID, items := range sr.Data {
+		kept := make([]*Item, 0, len(items))
+		for _, elem := range items {
+			if elem.PostID != postID {
+				kept = append(kept, elem)
+			}
+		}
+		n += len(items) - len(kept)
+		sr.Data[userID] = kept
+	}
+	log.Printf("DeleteByPost: removed %v saved items of post %v", n, postID)
+	return n, nil
+}
+
+func (sr *SavedDataRepo) DeleteByComment(postID, commentID uint32) (int, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	n := 0
+	for userID := range sr.Data {
+		if sr.remove(userID, postID, commentID) {
+			n++
+		}
+	}
+	log.Printf("DeleteByComment: removed %v saved items of comment %v/%v", n, postID, commentID)
+	return n, nil
+}
+
+// remove drops the item of the user, the caller holds mu.
+func (sr *SavedDataRepo) remove(userID, postID, commentID uint32) bool {
+	items := sr.Data[userID]
+	for idx, elem := range items {
+		if elem.PostID == postID && elem.CommentID == commentID {
+			sr.Data[userID] = append(items[:idx:idx], items[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package saved
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// comment_id is 0 for saved posts
+const savedSchema = `
+CREATE TABLE IF NOT EXISTS saved (
+	user_id    INTEGER NOT NULL REFERENCES users (id),
+	post_id    INTEGER NOT NULL REFERENCES posts (id),
+	comment_id INTEGER NOT NULL DEFAULT 0,
+	folder     TEXT    NOT NULL,
+	saved      TEXT    NOT NULL,
+	seq        INTEGER NOT NULL,
+	PRIMARY KEY (user_id, post_id, comment_id)
+);
+CREATE INDEX IF NOT EXISTS saved_post ON saved (post_id);`
+
+type SavedSQLiteRepo struct {
+	db *sql.DB
+}
+
+func NewSavedSQLiteRepo(db *sql.DB) (*SavedSQLiteRepo, error) {
+	if _, err := db.Exec(savedSchema); err != nil {
+		return nil, err
+	}
+	log.Printf("NewSavedSQLiteRepo: created SavedSQLiteRepo")
+	return &SavedSQLiteRepo{db: db}, nil
+}
+
+// Save keeps the order of saving in seq, saved has only seconds.
+func (sr *SavedSQLiteRepo) Save(item *Item) error {
+	if item.Folder == "" {
+		item.Folder = DefaultFolder
+	}
+	if item.Saved == "" {
+		item.Saved = time.Now().Format(time.RFC3339)
+	}
+	_, err := sr.db.Exec(`INSERT INTO saved (user_id, post_id, comment_id, folder, saved, seq)
+		VALUES (?, ?, ?, ?, ?, (SELECT coalesce(max(seq), 0) + 1 FROM saved))
+		ON CONFLICT (user_id, post_id, comment_id) DO UPDATE
+		SET folder = excluded.folder, saved = excluded.saved, seq = excluded.seq`,
+		item.UserID, item.PostID, item.CommentID, item.Folder, item.Saved)
+	if err != nil {
+		return err
+	}
+	log.Printf("Save: user %v saved %v/%v to '%v'", item.UserID, item.PostID, item.CommentID, item.Folder)
+	return nil
+}
+
+func (sr *SavedSQLiteRepo) Unsave(userID, postID, commentID uint32) (bool, error) {
+	res, err := sr.db.Exec(`DELETE FROM saved WHERE user_id = ? AND post_id = ? AND comment_id = ?`,
+		userID, postID, commentID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Unsave: user %v removed %v/%v: %v", userID, postID, commentID, n > 0)
+	return n > 0, nil
+}
+
+func (sr *SavedSQLiteRepo) List(userID uint32, folder string) ([]*Item, error) {
+	rows, err := sr.db.Query(`SELECT user_id, post_id, comment_id, folder, saved FROM saved
+		WHERE user_id = ? AND (? = '' OR folder = ?) ORDER BY seq DESC`, userID, folder, folder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Item, 0)
+	for rows.Next() {
+		item := &Item{}
+		if err = rows.Scan(&item.UserID, &item.PostID, &item.CommentID, &item.Folder, &item.Saved); err != nil {
+			return nil, err
+		}
+		res = append(res, item)
+	}
+	return res, rows.Err()
+}
+
+func (sr *SavedSQLiteRepo) Folders(userID uint32) ([]*Folder, error) {
+	rows, err := sr.db.Query(`SELECT folder, count(*) FROM saved WHERE user_id = ? GROUP BY folder ORDER BY folder`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*Folder, 0)
+	for rows.Next() {
+		f := &Folder{}
+		if err = rows.Scan(&f.Name, &f.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, rows.Err()
+}
+
+func (sr *SavedSQLiteRepo) DeleteByPost(postID uint32) (int, error) {
+	res, err := sr.db.Exec(`DELETE FROM saved WHERE post_id = ?`, postID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("DeleteByPost: removed %v saved items of post %v", n, postID)
+	return int(n), nil
+}
+
+func (sr *SavedSQLiteRepo) DeleteByComment(postID, commentID uint32) (int, error) {
+	res, err := sr.db.Exec(`DELETE FROM saved WHERE post_id = ? AND comment_id = ?`, postID, commentID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("DeleteByComment: removed %v saved items of comment %v/%v", n, postID, commentID)
+	return int(n), nil
+}
@@ -0,0 +1,35 @@
+// Package saved keeps posts and comments users bookmarked, sorted into
+// folders.
+package saved
+
+// DefaultFolder is where items saved without a folder go.
+const DefaultFolder = "saved"
+
+// Item is a saved post or comment, CommentID is 0 for posts.
+type Item struct {
+	UserID    uint32 `json:"user"`
+	PostID    uint32 `json:"post"`
+	CommentID uint32 `json:"comment,omitempty"`
+	Folder    string `json:"folder"`
+	Saved     string `json:"saved"`
+}
+
+// Folder is a folder of the user with the number of items in it, folders
+// exist while they have items.
+type Folder struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type SavedRepo interface {
+	// Save bookmarks the item, saving it again moves it to item.Folder
+	Save(item *Item) error
+	Unsave(userID, postID, commentID uint32) (bool, error)
+	// List returns items of the folder, of all folders for "", newest first
+	List(userID uint32, folder string) ([]*Item, error)
+	Folders(userID uint32) ([]*Folder, error)
+	// DeleteByPost removes the post and its comments from all users
+	DeleteByPost(postID uint32) (int, error)
+	// DeleteByComment removes the comment from all users
+	DeleteByComment(postID, commentID uint32) (int, error)
+}
@@ -0,0 +1,185 @@
+package search
+
+import (
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Executor runs parsed queries. Words and phrases are looked up in the
+// index, the rest of the conditions are checked against the posts and
+// comments in the repos. Allows, if set, hides posts from the results
+// before they count towards the limit.
+type Executor struct {
+	Index    *Index
+	Posts    post.PostsRepo
+	Comments comment.CommentsRepo
+	Allows   func(p *post.Post) bool
+}
+
+type Result struct {
+	Post    *post.Post
+	Score   float64
+	Snippet string
+}
+
+// Run returns up to limit posts matching expr, best first. Queries without
+// words are not ranked and return newest posts first.
+func (ex *Executor) Run(expr *Expr, limit int) ([]*Result, error) {
+	words := strings.Join(append(append([]string{}, expr.Words...), expr.Phrases...), " ")
+
+	var hits []*Hit
+	if len(uniqueTerms(words)) > 0 {
+		hits = ex.Index.Match(&Query{Text: words, Category: expr.Category, Author: expr.Author})
+	} else {
+		var err error
+		hits, err = ex.scan(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]*Result, 0)
+	for _, hit := range hits {
+		if limit > 0 && len(res) == limit {
+			break
+		}
+		p, err := ex.Posts.Read(hit.PostID)
+		if err == post.ErrNoPost {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ex.Allows != nil && !ex.Allows(p) {
+			continue
+		}
+		ok, err := ex.match(expr, p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, &Result{Post: p, Score: hit.Score, Snippet: ex.Index.Snippet(p.ID, words)})
+		}
+	}
+	return res, nil
+}
+
+// scan lists the posts for queries the index can't answer.
+func (ex *Executor) scan(expr *Expr) ([]*Hit, error) {
+	var (
+		posts []*post.Post
+		err   error
+	)
+	switch {
+	case expr.Author != "":
+		posts, err = ex.Posts.ReadUser(expr.Author)
+	case expr.Category != "":
+		posts, err = ex.Posts.ReadCategory(expr.Category)
+	default:
+		posts, err = ex.Posts.ReadAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]*Hit, 0, len(posts))
+	for _, elem := range posts {
+		hits = append(hits, &Hit{PostID: elem.ID})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].PostID > hits[j].PostID })
+	return hits, nil
+}
+
+// match checks everything but the words. before: is up to the start of
+// the day, after: is from the end of it.
+func (ex *Executor) match(expr *Expr, p *post.Post) (bool, error) {
+	if p.DeletedAt != "" {
+		return false, nil
+	}
+	if expr.Author != "" && p.Author.Username != expr.Author ||
+		expr.Category != "" && p.Category != expr.Category ||
+		expr.Type != "" && p.Type != expr.Type ||
+		expr.Score != nil && !expr.Score.Match(p.Score) {
+		return false, nil
+	}
+
+	if !expr.Before.IsZero() || !expr.After.IsZero() {
+		created, err := time.Parse(time.RFC3339, p.Created)
+		if err != nil {
+			return false, nil
+		}
+		if !expr.Before.IsZero() && !created.Before(expr.Before) ||
+			!expr.After.IsZero() && created.Before(expr.After.AddDate(0, 0, 1)) {
+			return false, nil
+		}
+	}
+
+	if len(expr.Phrases) == 0 && len(expr.Excluded) == 0 && len(expr.ExcludedPhrases) == 0 {
+		return true, nil
+	}
+
+	texts := []string{p.Title}
+	if ex.Index.types.HasText(p.Type) {
+		texts = append(texts, p.Data)
+	}
+	comments, err := ex.Comments.ReadAll(p.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, comm := range comments {
+		if comm.DeletedAt == "" {
+			texts = append(texts, comm.Body)
+		}
+	}
+
+	for _, phrase := range expr.Phrases {
+		if !containsPhrase(texts, phrase) {
+			return false, nil
+		}
+	}
+	for _, phrase := range expr.ExcludedPhrases {
+		if containsPhrase(texts, phrase) {
+			return false, nil
+		}
+	}
+	if len(expr.Excluded) > 0 {
+		found := make(map[string]bool)
+		for _, text := range texts {
+			for _, term := range Terms(text) {
+				found[term] = true
+			}
+		}
+		for _, word := range expr.Excluded {
+			if containsAll(found, Terms(word)) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// containsPhrase looks for the phrase ignoring case and extra spaces.
+func containsPhrase(texts []string, phrase string) bool {
+	phrase = strings.ToLower(phrase)
+	for _, text := range texts {
+		if strings.Contains(strings.Join(strings.Fields(strings.ToLower(text)), " "), phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(found map[string]bool, terms []string) bool {
+	if len(terms) == 0 {
+		return false
+	}
+	for _, term := range terms {
+		if !found[term] {
+			return false
+		}
+	}
+	return true
+}
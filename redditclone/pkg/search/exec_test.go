@@ -0,0 +1,122 @@
+package search_test
+
+import (
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/search"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	"testing"
+)
+
+// newExecutor indexes four posts: 1 and 3 of alex about go, 2 a link of
+// bob, 4 a trashed post of bob. Post 3 has a vote and a comment.
+func newExecutor(t *testing.T) (*search.Executor, *posttype.Registry) {
+	t.Helper()
+	bob := &user.User{ID: 2, Username: "bob"}
+	posts := post.NewPostsRepo()
+	comments := comment.NewCommentsRepo()
+	types := posttype.NewRegistry(posttype.Text{}, &posttype.Link{Posts: posts})
+	fixture := []*post.Post{
+		{Author: alex, Category: "music", Type: "text", Title: "Go tips", Data: "go channels and goroutines"},
+		{Author: bob, Category: "music", Type: "link", Title: "Rust news", Data: "https://rust.example.com/"},
+		{Author: alex, Category: "news", Type: "text", Title: "Go release", Data: "the new  Go release is out"},
+		{Author: bob, Category: "music", Type: "text", Title: "Cooking", Data: "pasta recipe"},
+	}
+	for _, elem := range fixture {
+		if _, err := posts.Create(elem); err != nil {
+			t.Fatalf("Create post: %v", err)
+		}
+	}
+	posts.UpVote(3, bob)
+	posts.Trash(4, bob)
+	if _, err := comments.Create(&comment.Comment{PostID: 3, Author: bob, Body: "great release notes"}); err != nil {
+		t.Fatalf("Create comment: %v", err)
+	}
+
+	ix := search.NewIndex(types)
+	if err := ix.Build(posts, comments); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return &search.Executor{Index: ix, Posts: posts, Comments: comments}, types
+}
+
+func resultIDs(res []*search.Result) string {
+	ids := make([]uint32, 0, len(res))
+	for _, elem := range res {
+		ids = append(ids, elem.Post.ID)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestExecutor(t *testing.T) {
+	ex, types := newExecutor(t)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"go", "[1 3]"},
+		{"GO Release", "[3]"},
+		{`"new go release"`, "[3]"},
+		{`"release notes"`, "[3]"},
+		{`"go release notes"`, "[]"},
+		{"go -goroutines", "[3]"},
+		{`go -"release notes"`, "[1]"},
+		{"go -notes -channels", "[]"},
+		{"rust", "[2]"},
+		{"example", "[]"},
+		{"pasta", "[]"},
+		{"author:bob", "[2]"},
+		{"author:alex", "[3 1]"},
+		{"category:music", "[2 1]"},
+		{"go category:news", "[3]"},
+		{"go author:bob", "[]"},
+		{"type:link", "[2]"},
+		{"type:text -release", "[1]"},
+		{"score:>0", "[3]"},
+		{"score:0", "[2 1]"},
+		{"before:2000-01-01", "[]"},
+		{"after:2000-01-01 author:alex", "[3 1]"},
+	}
+	for _, tt := range tests {
+		expr, err := search.Parse(tt.query, types)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		res, err := ex.Run(expr, 0)
+		if err != nil {
+			t.Fatalf("Run(%q): %v", tt.query, err)
+		}
+		if got := resultIDs(res); got != tt.want {
+			t.Fatalf("Run(%q): got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestExecutorLimit(t *testing.T) {
+	ex, _ := newExecutor(t)
+	expr := &search.Expr{Category: "music"}
+	res, err := ex.Run(expr, 1)
+	if err != nil || resultIDs(res) != "[2]" {
+		t.Fatalf("Run with limit 1: got %v, %v, want [2]", resultIDs(res), err)
+	}
+
+	// hidden posts don't take the place of others
+	ex.Allows = func(p *post.Post) bool { return p.Author.Username != "bob" }
+	res, err = ex.Run(expr, 1)
+	if err != nil || resultIDs(res) != "[1]" {
+		t.Fatalf("Run with Allows: got %v, %v, want [1]", resultIDs(res), err)
+	}
+}
+
+func TestExecutorSnippet(t *testing.T) {
+	ex, _ := newExecutor(t)
+	res, err := ex.Run(&search.Expr{Phrases: []string{"release notes"}}, 0)
+	if err != nil || len(res) != 1 {
+		t.Fatalf("Run: got %v, %v", resultIDs(res), err)
+	}
+	if want := "Go <mark>release</mark>"; res[0].Snippet != want {
+		t.Fatalf("Snippet: got %q, want %q", res[0].Snippet, want)
+	}
+}
@@ -0,0 +1,362 @@
+// Package search is an in-process full-text index of posts and their
+// comments.
+package search
+
+import (
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// field weights, a word in the title counts like three in the body
+const (
+	titleWeight   = 3
+	bodyWeight    = 1
+	commentWeight = 0.5
+
+	// BM25 parameters
+	k1 = 1.2
+	b  = 0.75
+
+	snippetBefore = 8
+	snippetAfter  = 16
+)
+
+// Query is a plain keyword search, every word must match. Empty Category
+// and Author match all posts.
+type Query struct {
+	Text     string
+	Category string
+	Author   string
+	Limit    int
+}
+
+type Hit struct {
+	PostID  uint32
+	Score   float64
+	Snippet string
+}
+
+type doc struct {
+	title    string
+	body     string
+	category string
+	author   string
+	terms    map[string]float64 // weighted term frequency
+	length   float64
+}
+
+// Index keeps the words of posts and comments. Data of a post is indexed
+// if its type says it is a text.
+type Index struct {
+	types    *posttype.Registry
+	mu       *sync.RWMutex
+	docs     map[uint32]*doc
+	comments map[uint32]map[uint32]string
+	postings map[string]map[uint32]bool
+	total    float64 // sum of doc lengths
+}
+
+func NewIndex(types *posttype.Registry) *Index {
+	return &Index{
+		types:    types,
+		mu:       &sync.RWMutex{},
+		docs:     make(map[uint32]*doc),
+		comments: make(map[uint32]map[uint32]string),
+		postings: make(map[string]map[uint32]bool),
+	}
+}
+
+// Build indexes everything visible in the repos.
+func (ix *Index) Build(posts post.PostsRepo, comments comment.CommentsRepo) error {
+	all, err := posts.ReadAll()
+	if err != nil {
+		return err
+	}
+	byPost, err := comments.List()
+	if err != nil {
+		return err
+	}
+	for _, list := range byPost {
+		for _, comm := range list {
+			if comm.DeletedAt == "" {
+				ix.AddComment(comm)
+			}
+		}
+	}
+	for _, p := range all {
+		ix.AddPost(p)
+	}
+	log.Printf("search: indexed %v posts", len(all))
+	return nil
+}
+
+// AddPost indexes the post or reindexes it after an edit.
+func (ix *Index) AddPost(p *post.Post) {
+	d := &doc{
+		title:    p.Title,
+		category: p.Category,
+		author:   p.Author.Username,
+	}
+	if ix.types.HasText(p.Type) {
+		d.body = p.Data
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.unlink(p.ID)
+	ix.docs[p.ID] = d
+	ix.link(p.ID)
+}
+
+func (ix *Index) RemovePost(id uint32) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.unlink(id)
+	delete(ix.docs, id)
+}
+
+// RemovePostComments forgets the comments of a post deleted for good.
+func (ix *Index) RemovePostComments(id uint32) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	delete(ix.comments, id)
+	if ix.docs[id] != nil {
+		ix.unlink(id)
+		ix.link(id)
+	}
+}
+
+// AddComment indexes the comment or reindexes it after an edit. Comments
+// of trashed posts are kept, so they are found again after a restore.
+func (ix *Index) AddComment(comm *comment.Comment) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.comments[comm.PostID] == nil {
+		ix.comments[comm.PostID] = make(map[uint32]string)
+	}
+	ix.comments[comm.PostID][comm.ID] = comm.Body
+	if ix.docs[comm.PostID] != nil {
+		ix.unlink(comm.PostID)
+		ix.link(comm.PostID)
+	}
+}
+
+func (ix *Index) RemoveComment(postID, commentID uint32) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	delete(ix.comments[postID], commentID)
+	if ix.docs[postID] != nil {
+		ix.unlink(postID)
+		ix.link(postID)
+	}
+}
+
+// link counts terms of the doc and adds it to the postings, the caller
+// holds mu.
+func (ix *Index) link(id uint32) {
+	d := ix.docs[id]
+	d.terms = make(map[string]float64)
+	d.length = 0
+	add := func(text string, weight float64) {
+		for _, term := range Terms(text) {
+			d.terms[term] += weight
+			d.length += weight
+		}
+	}
+	add(d.title, titleWeight)
+	add(d.body, bodyWeight)
+	for _, body := range ix.comments[id] {
+		add(body, commentWeight)
+	}
+
+	for term := range d.terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[uint32]bool)
+		}
+		ix.postings[term][id] = true
+	}
+	ix.total += d.length
+}
+
+// unlink removes the doc from the postings, the caller holds mu.
+func (ix *Index) unlink(id uint32) {
+	d := ix.docs[id]
+	if d == nil {
+		return
+	}
+	for term := range d.terms {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	ix.total -= d.length
+}
+
+// Search ranks posts having all the words of the query with BM25.
+func (ix *Index) Search(q *Query) []*Hit {
+	hits := ix.Match(q)
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	for _, hit := range hits {
+		hit.Snippet = ix.Snippet(hit.PostID, q.Text)
+	}
+	return hits
+}
+
+// Match is Search without snippets, Limit is ignored.
+func (ix *Index) Match(q *Query) []*Hit {
+	terms := uniqueTerms(q.Text)
+	if len(terms) == 0 {
+		return []*Hit{}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	// start from the rarest term, it has the fewest posts to check
+	sort.Slice(terms, func(i, j int) bool {
+		return len(ix.postings[terms[i]]) < len(ix.postings[terms[j]])
+	})
+
+	hits := make([]*Hit, 0)
+	for id := range ix.postings[terms[0]] {
+		d := ix.docs[id]
+		if q.Category != "" && d.category != q.Category || q.Author != "" && d.author != q.Author {
+			continue
+		}
+		score, ok := ix.score(d, terms)
+		if !ok {
+			continue
+		}
+		hits = append(hits, &Hit{PostID: id, Score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].PostID > hits[j].PostID
+	})
+	return hits
+}
+
+// Snippet highlights the words of text in the post, empty if there are
+// none.
+func (ix *Index) Snippet(id uint32, text string) string {
+	terms := uniqueTerms(text)
+	if len(terms) == 0 {
+		return ""
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if ix.docs[id] == nil {
+		return ""
+	}
+	return ix.snippet(id, terms)
+}
+
+// score is BM25 of the doc, false when a term is missing, the caller
+// holds mu.
+func (ix *Index) score(d *doc, terms []string) (float64, bool) {
+	n := float64(len(ix.docs))
+	avg := ix.total / n
+	score := 0.0
+	for _, term := range terms {
+		tf := d.terms[term]
+		if tf == 0 {
+			return 0, false
+		}
+		df := float64(len(ix.postings[term]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*d.length/avg))
+	}
+	return score, true
+}
+
+// snippet is a piece of the title, the body or a comment around the first
+// matched word, matches are wrapped in <mark>. The caller holds mu.
+func (ix *Index) snippet(id uint32, terms []string) string {
+	wanted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	d := ix.docs[id]
+	texts := []string{d.title, d.body}
+	commentIDs := make([]uint32, 0, len(ix.comments[id]))
+	for commentID := range ix.comments[id] {
+		commentIDs = append(commentIDs, commentID)
+	}
+	sort.Slice(commentIDs, func(i, j int) bool { return commentIDs[i] < commentIDs[j] })
+	for _, commentID := range commentIDs {
+		texts = append(texts, ix.comments[id][commentID])
+	}
+
+	for _, text := range texts {
+		tokens := Tokenize(text)
+		first := -1
+		for idx, t := range tokens {
+			if wanted[t.Term] {
+				first = idx
+				break
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		return highlight(text, tokens, first, wanted)
+	}
+	return ""
+}
+
+func highlight(text string, tokens []*Token, first int, wanted map[string]bool) string {
+	from := first - snippetBefore
+	if from < 0 {
+		from = 0
+	}
+	to := first + snippetAfter
+	if to > len(tokens)-1 {
+		to = len(tokens) - 1
+	}
+
+	res := &strings.Builder{}
+	if from > 0 {
+		res.WriteString("…")
+	}
+	pos := tokens[from].Start
+	for _, t := range tokens[from : to+1] {
+		res.WriteString(html.EscapeString(text[pos:t.Start]))
+		if wanted[t.Term] {
+			res.WriteString("<mark>" + html.EscapeString(text[t.Start:t.End]) + "</mark>")
+		} else {
+			res.WriteString(html.EscapeString(text[t.Start:t.End]))
+		}
+		pos = t.End
+	}
+	if to < len(tokens)-1 {
+		res.WriteString("…")
+	}
+	return res.String()
+}
+
+func uniqueTerms(text string) []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, term := range Terms(text) {
+		if !seen[term] {
+			seen[term] = true
+			res = append(res, term)
+		}
+	}
+	return res
+}
@@ -0,0 +1,123 @@
+package search_test
+
+import (
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/search"
+	"fakereddit/redditclone/pkg/user"
+	"fmt"
+	"math"
+	"testing"
+)
+
+var alex = &user.User{ID: 1, Username: "alex"}
+
+// newIndex indexes text posts with ids from 1 in the order of texts, each
+// text is a title and a body.
+func newIndex(texts ...[2]string) *search.Index {
+	ix := search.NewIndex(posttype.NewRegistry(posttype.Text{}))
+	for idx, text := range texts {
+		ix.AddPost(&post.Post{
+			ID:       uint32(idx + 1),
+			Author:   alex,
+			Category: "music",
+			Type:     "text",
+			Title:    text[0],
+			Data:     text[1],
+		})
+	}
+	return ix
+}
+
+func hitIDs(hits []*search.Hit) string {
+	ids := make([]uint32, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.PostID)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestBM25Order(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts [][2]string
+		query string
+		want  string
+	}{
+		{
+			name:  "term frequency",
+			texts: [][2]string{{"", "go x x"}, {"", "go go go"}, {"", "rust x x"}, {"", "go go x"}},
+			query: "go",
+			want:  "[2 4 1]",
+		},
+		{
+			name:  "doc length",
+			texts: [][2]string{{"", "go x x x x x x x"}, {"", "go x"}, {"", "go x x x"}},
+			query: "go",
+			want:  "[2 3 1]",
+		},
+		{
+			name:  "title weight",
+			texts: [][2]string{{"rust", "go"}, {"go", "rust"}},
+			query: "go",
+			want:  "[2 1]",
+		},
+		{
+			name:  "rare term counts more",
+			texts: [][2]string{{"", "go go rust"}, {"", "go rust rust"}, {"", "go x x"}, {"", "go x x"}},
+			query: "go rust",
+			want:  "[2 1]",
+		},
+		{
+			name:  "equal scores by newest",
+			texts: [][2]string{{"", "go x"}, {"", "go x"}, {"", "x x"}},
+			query: "go",
+			want:  "[2 1]",
+		},
+		{
+			name:  "every term must match",
+			texts: [][2]string{{"", "go"}, {"", "rust"}},
+			query: "go rust",
+			want:  "[]",
+		},
+		{
+			name:  "stems match",
+			texts: [][2]string{{"", "running dogs"}, {"", "runs"}},
+			query: "run dog",
+			want:  "[1]",
+		},
+	}
+	for _, tt := range tests {
+		ix := newIndex(tt.texts...)
+		if got := hitIDs(ix.Match(&search.Query{Text: tt.query})); got != tt.want {
+			t.Fatalf("%v: Match(%q): got %v, want %v", tt.name, tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestBM25Score checks the score against the formula: three docs of three
+// words out of four have the term, the best one three times.
+func TestBM25Score(t *testing.T) {
+	ix := newIndex([2]string{"", "go x x"}, [2]string{"", "go go go"}, [2]string{"", "rust x x"}, [2]string{"", "go go x"})
+	hits := ix.Match(&search.Query{Text: "go"})
+	if len(hits) != 3 {
+		t.Fatalf("Match: got %v hits, want 3", len(hits))
+	}
+
+	idf := math.Log(1 + (4-3+0.5)/(3+0.5))
+	for _, want := range []struct {
+		id uint32
+		tf float64
+	}{{2, 3}, {4, 2}, {1, 1}} {
+		score := idf * want.tf * 2.2 / (want.tf + 1.2)
+		hit := hits[0]
+		for _, elem := range hits {
+			if elem.PostID == want.id {
+				hit = elem
+			}
+		}
+		if math.Abs(hit.Score-score) > 1e-9 {
+			t.Fatalf("score of post %v: got %v, want %v", want.id, hit.Score, score)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package search
+
+import (
+	"fakereddit/redditclone/pkg/posttype"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const dateLayout = "2006-01-02"
+
+// Expr is a parsed query like
+//
+//	author:alex category:music type:link score:>10 before:2026-01-01 "exact phrase" -excluded
+//
+// Words and phrases must all be found, excluded ones must not.
+type Expr struct {
+	Words    []string
+	Phrases  []string
+	Excluded []string // words
+	// ExcludedPhrases come from -"some phrase"
+	ExcludedPhrases []string
+
+	Author   string
+	Category string
+	Type     string
+	Score    *Compare
+	// Before and After bound the post creation time, zero means no bound
+	Before time.Time
+	After  time.Time
+}
+
+// Compare is a score condition, Op is one of = > >= < <=.
+type Compare struct {
+	Op    string
+	Value int
+}
+
+func (c *Compare) Match(v int) bool {
+	switch c.Op {
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	}
+	return v == c.Value
+}
+
+// SyntaxError points at the part of the query which can't be parsed, Pos
+// is the byte offset of Term in the query.
+type SyntaxError struct {
+	Pos  int
+	Term string
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%v at %v: %v", e.Term, e.Pos, e.Msg)
+}
+
+// SyntaxErrors are all the errors of one query.
+type SyntaxErrors []*SyntaxError
+
+func (es SyntaxErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type term struct {
+	pos    int
+	text   string
+	quoted bool
+	negate bool
+}
+
+// Parse parses the query, type: must be one of types. A failed Parse
+// returns SyntaxErrors.
+func Parse(query string, types *posttype.Registry) (*Expr, error) {
+	terms, errs := split(query)
+	expr := &Expr{}
+	for _, t := range terms {
+		if t.quoted {
+			if t.negate {
+				expr.ExcludedPhrases = append(expr.ExcludedPhrases, t.text)
+			} else {
+				expr.Phrases = append(expr.Phrases, t.text)
+			}
+			continue
+		}
+
+		colon := strings.IndexByte(t.text, ':')
+		if colon < 0 {
+			if t.negate {
+				expr.Excluded = append(expr.Excluded, t.text)
+			} else {
+				expr.Words = append(expr.Words, t.text)
+			}
+			continue
+		}
+		key, value := strings.ToLower(t.text[:colon]), t.text[colon+1:]
+		if err := expr.setField(key, value, types); err != nil {
+			errs = append(errs, &SyntaxError{Pos: t.pos, Term: t.text, Msg: err.Error()})
+			continue
+		}
+		if t.negate {
+			errs = append(errs, &SyntaxError{Pos: t.pos, Term: t.text, Msg: "only words and phrases can be excluded"})
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Pos < errs[j].Pos })
+		return nil, errs
+	}
+	return expr, nil
+}
+
+func (expr *Expr) setField(key, value string, types *posttype.Registry) error {
+	if value == "" {
+		return fmt.Errorf("%v needs a value", key)
+	}
+	switch key {
+	case "author":
+		expr.Author = value
+	case "category":
+		expr.Category = value
+	case "type":
+		if _, ok := types.Get(value); !ok {
+			return fmt.Errorf("type must be one of %v", strings.Join(types.Names(), ", "))
+		}
+		expr.Type = value
+	case "score":
+		cmp := &Compare{Op: "="}
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(value, op) {
+				cmp.Op = op
+				value = value[len(op):]
+				break
+			}
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("score must be a number")
+		}
+		cmp.Value = n
+		expr.Score = cmp
+	case "before", "after":
+		at, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return fmt.Errorf("%v must be a date like 2026-01-31", key)
+		}
+		if key == "before" {
+			expr.Before = at
+		} else {
+			expr.After = at
+		}
+	default:
+		return fmt.Errorf("unknown field %v", key)
+	}
+	return nil
+}
+
+// split cuts the query by spaces, double quotes keep a phrase together.
+func split(query string) ([]*term, SyntaxErrors) {
+	terms := make([]*term, 0)
+	errs := make(SyntaxErrors, 0)
+	pos := 0
+	for pos < len(query) {
+		r := rune(query[pos])
+		if unicode.IsSpace(r) {
+			pos++
+			continue
+		}
+
+		t := &term{pos: pos}
+		if query[pos] == '-' {
+			t.negate = true
+			pos++
+		}
+		if pos < len(query) && query[pos] == '"' {
+			end := strings.IndexByte(query[pos+1:], '"')
+			if end < 0 {
+				errs = append(errs, &SyntaxError{Pos: t.pos, Term: query[t.pos:], Msg: "unclosed quote"})
+				break
+			}
+			t.quoted = true
+			t.text = strings.Join(strings.Fields(query[pos+1:pos+1+end]), " ")
+			pos += end + 2
+			if t.text == "" {
+				errs = append(errs, &SyntaxError{Pos: t.pos, Term: query[t.pos:pos], Msg: "empty phrase"})
+				continue
+			}
+			terms = append(terms, t)
+			continue
+		}
+
+		end := strings.IndexFunc(query[pos:], unicode.IsSpace)
+		if end < 0 {
+			end = len(query) - pos
+		}
+		t.text = query[pos : pos+end]
+		pos += end
+		if t.text == "" {
+			errs = append(errs, &SyntaxError{Pos: t.pos, Term: "-", Msg: "nothing to exclude"})
+			continue
+		}
+		terms = append(terms, t)
+	}
+	return terms, errs
+}
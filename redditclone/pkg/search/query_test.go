@@ -0,0 +1,106 @@
+package search_test
+
+import (
+	"fakereddit/redditclone/pkg/posttype"
+	"fakereddit/redditclone/pkg/search"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	types := posttype.NewRegistry(posttype.Text{}, &posttype.Link{})
+	day := func(s string) time.Time {
+		at, _ := time.Parse("2006-01-02", s)
+		return at
+	}
+	tests := []struct {
+		query string
+		want  *search.Expr
+	}{
+		{"", &search.Expr{}},
+		{"  go   rust ", &search.Expr{Words: []string{"go", "rust"}}},
+		{`"exact   phrase" word`, &search.Expr{Words: []string{"word"}, Phrases: []string{"exact phrase"}}},
+		{`-excluded -"bad  thing" kept`, &search.Expr{
+			Words:           []string{"kept"},
+			Excluded:        []string{"excluded"},
+			ExcludedPhrases: []string{"bad thing"},
+		}},
+		{"author:alex Category:music type:link", &search.Expr{Author: "alex", Category: "music", Type: "link"}},
+		{"score:10", &search.Expr{Score: &search.Compare{Op: "=", Value: 10}}},
+		{"score:>=-3", &search.Expr{Score: &search.Compare{Op: ">=", Value: -3}}},
+		{"score:<5", &search.Expr{Score: &search.Compare{Op: "<", Value: 5}}},
+		{"before:2026-02-01 after:2026-01-01", &search.Expr{Before: day("2026-02-01"), After: day("2026-01-01")}},
+		{"go-lang half-life", &search.Expr{Words: []string{"go-lang", "half-life"}}},
+	}
+	for _, tt := range tests {
+		got, err := search.Parse(tt.query, types)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("Parse(%q): got %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	types := posttype.NewRegistry(posttype.Text{}, &posttype.Link{})
+	tests := []struct {
+		query string
+		// want are the positions and terms of the errors
+		want []search.SyntaxError
+	}{
+		{`"unclosed phrase`, []search.SyntaxError{{Pos: 0, Term: `"unclosed phrase`}}},
+		{`go ""`, []search.SyntaxError{{Pos: 3, Term: `""`}}},
+		{"go - rust", []search.SyntaxError{{Pos: 3, Term: "-"}}},
+		{"color:red", []search.SyntaxError{{Pos: 0, Term: "color:red"}}},
+		{"author:", []search.SyntaxError{{Pos: 0, Term: "author:"}}},
+		{"type:video", []search.SyntaxError{{Pos: 0, Term: "type:video"}}},
+		{"score:>ten", []search.SyntaxError{{Pos: 0, Term: "score:>ten"}}},
+		{"before:yesterday", []search.SyntaxError{{Pos: 0, Term: "before:yesterday"}}},
+		{"-author:bob", []search.SyntaxError{{Pos: 0, Term: "author:bob"}}},
+		{`x -author:bob type:video - ""`, []search.SyntaxError{
+			{Pos: 2, Term: "author:bob"},
+			{Pos: 14, Term: "type:video"},
+			{Pos: 25, Term: "-"},
+			{Pos: 27, Term: `""`},
+		}},
+	}
+	for _, tt := range tests {
+		expr, err := search.Parse(tt.query, types)
+		errs, ok := err.(search.SyntaxErrors)
+		if !ok || expr != nil {
+			t.Fatalf("Parse(%q): got %+v, %v, want SyntaxErrors", tt.query, expr, err)
+		}
+		if len(errs) != len(tt.want) {
+			t.Fatalf("Parse(%q): got %v, want %v errors", tt.query, errs, len(tt.want))
+		}
+		for idx, want := range tt.want {
+			if errs[idx].Pos != want.Pos || errs[idx].Term != want.Term || errs[idx].Msg == "" {
+				t.Fatalf("Parse(%q) error %v: got %+v, want %+v", tt.query, idx, errs[idx], want)
+			}
+		}
+	}
+}
+
+func TestCompareMatch(t *testing.T) {
+	tests := []struct {
+		op   string
+		want [3]bool // for 4, 5, 6 against 5
+	}{
+		{"=", [3]bool{false, true, false}},
+		{">", [3]bool{false, false, true}},
+		{">=", [3]bool{false, true, true}},
+		{"<", [3]bool{true, false, false}},
+		{"<=", [3]bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		cmp := &search.Compare{Op: tt.op, Value: 5}
+		for idx, v := range []int{4, 5, 6} {
+			if got := cmp.Match(v); got != tt.want[idx] {
+				t.Fatalf("%v 5 on %v: got %v, want %v", tt.op, v, got, tt.want[idx])
+			}
+		}
+	}
+}
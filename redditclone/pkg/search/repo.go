@@ -0,0 +1,128 @@
+package search
+
+import (
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/user"
+)
+
+// IndexedPostsRepo keeps the index in step with the wrapped repo, trashed
+// posts are not searchable.
+type IndexedPostsRepo struct {
+	post.PostsRepo
+	Index *Index
+}
+
+func NewIndexedPostsRepo(repo post.PostsRepo, ix *Index) *IndexedPostsRepo {
+	return &IndexedPostsRepo{PostsRepo: repo, Index: ix}
+}
+
+func (ir *IndexedPostsRepo) Create(p *post.Post) (uint32, error) {
+	id, err := ir.PostsRepo.Create(p)
+	if err != nil {
+		return 0, err
+	}
+	ir.Index.AddPost(p)
+	return id, nil
+}
+
+func (ir *IndexedPostsRepo) Update(id uint32, title, data string, editor *user.User) (*post.Post, error) {
+	p, err := ir.PostsRepo.Update(id, title, data, editor)
+	if err != nil {
+		return nil, err
+	}
+	ir.Index.AddPost(p)
+	return p, nil
+}
+
+func (ir *IndexedPostsRepo) Delete(id uint32) (bool, error) {
+	ok, err := ir.PostsRepo.Delete(id)
+	if err != nil {
+		return ok, err
+	}
+	ir.Index.RemovePost(id)
+	return ok, nil
+}
+
+func (ir *IndexedPostsRepo) Trash(id uint32, by *user.User) (*post.Post, error) {
+	p, err := ir.PostsRepo.Trash(id, by)
+	if err != nil {
+		return nil, err
+	}
+	ir.Index.RemovePost(id)
+	return p, nil
+}
+
+func (ir *IndexedPostsRepo) Restore(id uint32) (*post.Post, error) {
+	p, err := ir.PostsRepo.Restore(id)
+	if err != nil {
+		return nil, err
+	}
+	ir.Index.AddPost(p)
+	return p, nil
+}
+
+// IndexedCommentsRepo keeps comment bodies in the index in step with the
+// wrapped repo.
+type IndexedCommentsRepo struct {
+	comment.CommentsRepo
+	Index *Index
+}
+
+func NewIndexedCommentsRepo(repo comment.CommentsRepo, ix *Index) *IndexedCommentsRepo {
+	return &IndexedCommentsRepo{CommentsRepo: repo, Index: ix}
+}
+
+func (ir *IndexedCommentsRepo) Create(comm *comment.Comment) (uint32, error) {
+	id, err := ir.CommentsRepo.Create(comm)
+	if err != nil {
+		return 0, err
+	}
+	ir.Index.AddComment(comm)
+	return id, nil
+}
+
+func (ir *IndexedCommentsRepo) Update(postID, commentID uint32, body string, editor *user.User) (*comment.Comment, error) {
+	comm, err := ir.CommentsRepo.Update(postID, commentID, body, editor)
+	if err != nil {
+		return nil, err
+	}
+	ir.Index.AddComment(comm)
+	return comm, nil
+}
+
+func (ir *IndexedCommentsRepo) Delete(postID, commentID uint32) (bool, error) {
+	ok, err := ir.CommentsRepo.Delete(postID, commentID)
+	if err != nil {
+		return ok, err
+	}
+	ir.Index.RemoveComment(postID, commentID)
+	return ok, nil
+}
+
+func (ir *IndexedCommentsRepo) DeleteByPost(postID uint32) (int, error) {
+	n, err := ir.CommentsRepo.DeleteByPost(postID)
+	if err != nil {
+		return n, err
+	}
+	ir.Index.RemovePostComments(postID)
+	return n, nil
+}
+
+func (ir *IndexedCommentsRepo) Trash(postID, commentID uint32, by *user.User) (*comment.Comment, error) {
+	comm, err := ir.CommentsRepo.Trash(postID, commentID, by)
+	if err != nil {
+		return nil, err
+	}
+	ir.Index.RemoveComment(postID, commentID)
+	return comm, nil
+}
+
+func (ir *IndexedCommentsRepo) Restore(postID, commentID uint32) (*comment.Comment, error) {
+	comm, err := ir.CommentsRepo.Restore(postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	ir.Index.AddComment(comm)
+	return comm, nil
+}
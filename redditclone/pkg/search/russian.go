@@ -0,0 +1,147 @@
+package search
+
+// stemRussian is the Snowball Russian stemmer,
+// https://snowballstem.org/algorithms/russian/stemmer.html
+func stemRussian(word string) string {
+	w := []rune(word)
+	for i, r := range w {
+		if r == 'ё' {
+			w[i] = 'е'
+		}
+	}
+
+	rv := len(w)
+	for i, r := range w {
+		if isRussianVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	r2 := regionR2(w)
+	if rv >= len(w) {
+		return string(w)
+	}
+
+	// step 1
+	if n := endingAfterAorYa(w, rv, gerund1); n > 0 {
+		w = w[:len(w)-n]
+	} else if n = ending(w, rv, gerund2); n > 0 {
+		w = w[:len(w)-n]
+	} else {
+		if n = ending(w, rv, reflexive); n > 0 {
+			w = w[:len(w)-n]
+		}
+		if n = adjectival(w, rv); n > 0 {
+			w = w[:len(w)-n]
+		} else if n = endingAfterAorYa(w, rv, verb1); n > 0 {
+			w = w[:len(w)-n]
+		} else if n = ending(w, rv, verb2); n > 0 {
+			w = w[:len(w)-n]
+		} else if n = ending(w, rv, noun); n > 0 {
+			w = w[:len(w)-n]
+		}
+	}
+
+	// step 2
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+
+	// step 3
+	if n := ending(w, r2, derivational); n > 0 {
+		w = w[:len(w)-n]
+	}
+
+	// step 4
+	if n := ending(w, rv, superlative); n > 0 {
+		w = w[:len(w)-n]
+	}
+	if len(w)-2 >= rv && w[len(w)-1] == 'н' && w[len(w)-2] == 'н' {
+		w = w[:len(w)-1]
+	} else if len(w) > rv && w[len(w)-1] == 'ь' {
+		w = w[:len(w)-1]
+	}
+	return string(w)
+}
+
+var (
+	gerund1      = []string{"вшись", "вши", "в"}
+	gerund2      = []string{"ившись", "ывшись", "ивши", "ывши", "ив", "ыв"}
+	reflexive    = []string{"ся", "сь"}
+	adjective    = []string{"ими", "ыми", "его", "ого", "ему", "ому", "ее", "ие", "ые", "ое", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	participle1  = []string{"ем", "нн", "вш", "ющ", "щ"}
+	participle2  = []string{"ивш", "ывш", "ующ"}
+	verb1        = []string{"ете", "йте", "ешь", "нно", "ла", "на", "ли", "ем", "ло", "но", "ет", "ют", "ны", "ть", "й", "л", "н"}
+	verb2        = []string{"ейте", "уйте", "ила", "ыла", "ена", "ите", "или", "ыли", "ило", "ыло", "ено", "ует", "уют", "ены", "ить", "ыть", "ишь", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ят", "ит", "ыт", "ую", "ю"}
+	noun         = []string{"иями", "ями", "ами", "ией", "иям", "ием", "иях", "ев", "ов", "ие", "ье", "еи", "ии", "ей", "ой", "ий", "ям", "ем", "ам", "ом", "ах", "ях", "ию", "ью", "ия", "ья", "а", "е", "и", "й", "о", "у", "ы", "ь", "ю", "я"}
+	derivational = []string{"ость", "ост"}
+	superlative  = []string{"ейше", "ейш"}
+)
+
+func isRussianVowel(r rune) bool {
+	switch r {
+	case 'а', 'е', 'и', 'о', 'у', 'ы', 'э', 'ю', 'я':
+		return true
+	}
+	return false
+}
+
+// regionR2 returns where R2 starts: R1 is after the first non-vowel
+// following a vowel, R2 is the same inside R1.
+func regionR2(w []rune) int {
+	r1 := regionAfterVC(w, 0)
+	return regionAfterVC(w, r1)
+}
+
+func regionAfterVC(w []rune, from int) int {
+	for i := from + 1; i < len(w); i++ {
+		if !isRussianVowel(w[i]) && isRussianVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// ending returns the length of the longest ending from the list which
+// fits into the region starting at from, 0 if none.
+func ending(w []rune, from int, endings []string) int {
+	best := 0
+	for _, e := range endings {
+		n := len([]rune(e))
+		if n > best && len(w)-n >= from && string(w[len(w)-n:]) == e {
+			best = n
+		}
+	}
+	return best
+}
+
+// endingAfterAorYa is ending for groups which must follow а or я, the
+// letter itself stays.
+func endingAfterAorYa(w []rune, from int, endings []string) int {
+	best := 0
+	for _, e := range endings {
+		n := len([]rune(e))
+		if n <= best || len(w)-n-1 < from || string(w[len(w)-n:]) != e {
+			continue
+		}
+		if prev := w[len(w)-n-1]; prev == 'а' || prev == 'я' {
+			best = n
+		}
+	}
+	return best
+}
+
+// adjectival is an adjective ending, maybe preceded by a participle one.
+func adjectival(w []rune, rv int) int {
+	n := ending(w, rv, adjective)
+	if n == 0 {
+		return 0
+	}
+	rest := w[:len(w)-n]
+	if p := endingAfterAorYa(rest, rv, participle1); p > 0 {
+		n += p
+	} else if p = ending(rest, rv, participle2); p > 0 {
+		n += p
+	}
+	return n
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a word of a text with its place in it, Term is the word as
+// the index keeps it.
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into words, lower cases and stems them. Cyrillic
+// words go through the Russian stemmer, the rest through the English one.
+func Tokenize(text string) []*Token {
+	res := make([]*Token, 0)
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			res = append(res, &Token{Term: Stem(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		res = append(res, &Token{Term: Stem(text[start:]), Start: start, End: len(text)})
+	}
+	return res
+}
+
+// Terms returns only the index terms of the text.
+func Terms(text string) []string {
+	tokens := Tokenize(text)
+	res := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		res = append(res, t.Term)
+	}
+	return res
+}
+
+func Stem(word string) string {
+	word = strings.ToLower(word)
+	for _, r := range word {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return stemRussian(word)
+		}
+	}
+	if isASCII(word) {
+		return stemEnglish(word)
+	}
+	return word
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package search_test
+
+import (
+	"fakereddit/redditclone/pkg/search"
+	"fmt"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", "[]"},
+		{"  ,.!  ", "[]"},
+		{"Hello, World!", "[hello 0:5 world 7:12]"},
+		{"don't", "[don 0:3 t 4:5]"},
+		{"go1.22 x", "[go1 0:3 22 4:6 x 7:8]"},
+		{"Кошки и Dogs", "[кошк 0:10 и 11:13 dog 14:18]"},
+		{"café Crème", "[café 0:5 crème 6:12]"},
+		{"snake_case-words", "[snake 0:5 case 6:10 word 11:16]"},
+	}
+	for _, tt := range tests {
+		got := make([]string, 0)
+		for _, tok := range search.Tokenize(tt.text) {
+			got = append(got, fmt.Sprintf("%v %v:%v", tok.Term, tok.Start, tok.End))
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Fatalf("Tokenize(%q): got %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestStemEnglish checks the Porter stemmer on the examples of the paper,
+// https://tartarus.org/martin/PorterStemmer/def.txt
+func TestStemEnglish(t *testing.T) {
+	tests := []struct {
+		step  string
+		words map[string]string
+	}{
+		{"1a", map[string]string{"caresses": "caress", "ponies": "poni", "ties": "ti", "caress": "caress", "cats": "cat"}},
+		{"1b", map[string]string{
+			"feed": "feed", "agreed": "agre", "plastered": "plaster", "bled": "bled", "motoring": "motor", "sing": "sing",
+			"conflated": "conflat", "troubled": "troubl", "sized": "size", "hopping": "hop", "tanned": "tan",
+			"falling": "fall", "hissing": "hiss", "fizzed": "fizz", "failing": "fail", "filing": "file",
+		}},
+		{"1c", map[string]string{"happy": "happi", "sky": "sky"}},
+		{"2", map[string]string{
+			"relational": "relat", "conditional": "condit", "rational": "ration", "digitizer": "digit",
+			"operator": "oper", "generalizations": "gener",
+		}},
+		{"3", map[string]string{"triplicate": "triplic", "formative": "form", "electrical": "electr", "hopeful": "hope", "goodness": "good"}},
+		{"4", map[string]string{
+			"revival": "reviv", "allowance": "allow", "inference": "infer", "adjustable": "adjust", "irritant": "irrit",
+			"replacement": "replac", "adoption": "adopt", "effective": "effect", "bowdlerize": "bowdler",
+		}},
+		{"5", map[string]string{"probate": "probat", "rate": "rate", "cease": "ceas", "controlling": "control", "roll": "roll"}},
+		{"case and short words", map[string]string{"Running": "run", "a": "a", "is": "is", "42": "42"}},
+	}
+	for _, tt := range tests {
+		for word, want := range tt.words {
+			if got := search.Stem(word); got != want {
+				t.Fatalf("step %v: Stem(%q): got %q, want %q", tt.step, word, got, want)
+			}
+		}
+	}
+}
+
+// TestStemRussian checks every suffix class of the Snowball Russian stemmer.
+func TestStemRussian(t *testing.T) {
+	tests := []struct {
+		class string
+		words map[string]string
+	}{
+		{"perfective gerund after а/я", map[string]string{"сделав": "сдела", "прочитавшись": "прочита", "потеряв": "потеря"}},
+		{"perfective gerund", map[string]string{"купившись": "куп", "забыв": "заб", "умывши": "ум"}},
+		{"reflexive", map[string]string{"умывается": "умыва", "учились": "уч"}},
+		{"adjective", map[string]string{"красивые": "красив", "новыми": "нов", "синего": "син"}},
+		{"participle", map[string]string{"читающий": "чита", "играющая": "игра", "торгующий": "торг"}},
+		{"verb", map[string]string{"бегать": "бега", "ездят": "езд", "говорили": "говор", "читает": "чита"}},
+		{"noun", map[string]string{"машины": "машин", "книгами": "книг", "станции": "станц", "жизнь": "жизн"}},
+		{"derivational", map[string]string{"активность": "активн", "сложность": "сложност"}},
+		{"superlative", map[string]string{"красивейший": "красив", "новейшая": "нов"}},
+		{"нн and ь", map[string]string{"длинный": "длин", "длинн": "длин"}},
+		{"ё and case", map[string]string{"Ёлки": "елк", "ЁЖ": "еж"}},
+		{"no vowel", map[string]string{"вз": "вз", "т": "т"}},
+	}
+	for _, tt := range tests {
+		for word, want := range tt.words {
+			if got := search.Stem(word); got != want {
+				t.Fatalf("%v: Stem(%q): got %q, want %q", tt.class, word, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"net/http"
+	"sync"
+)
+
+const (
+	opCreate = "create"
+)
+
+// DurableSessionsManager is a SessionsManager which logs every created
+// session to a journal, so logged in users stay logged in after restart.
+type DurableSessionsManager struct {
+	*SessionsManager
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+func NewDurableSessionsManager(j *journal.Journal) (*DurableSessionsManager, error) {
+	sm := &DurableSessionsManager{
+		SessionsManager: NewSessionsManager(),
+		mu:              &sync.Mutex{},
+		journal:         j,
+	}
+
+	err := j.Load(sm.restore, sm.apply)
+	if err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (sm *DurableSessionsManager) restore(state json.RawMessage) error {
+	return json.Unmarshal(state, &sm.data)
+}
+
+func (sm *DurableSessionsManager) apply(op string, data json.RawMessage) error {
+	if op != opCreate {
+		return nil
+	}
+	sess := &Session{}
+	if err := json.Unmarshal(data, sess); err != nil {
+		return err
+	}
+	sm.data[sess.ID] = sess
+	return nil
+}
+
+func (sm *DurableSessionsManager) Create(w http.ResponseWriter, userID uint32, login string) (*Session, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sess, err := sm.SessionsManager.Create(w, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	return sess, sm.journal.Append(opCreate, sess)
+}
+
+func (sm *DurableSessionsManager) Snapshot() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.SessionsManager.mu.RLock()
+	defer sm.SessionsManager.mu.RUnlock()
+	return sm.journal.Compact(sm.data)
+}
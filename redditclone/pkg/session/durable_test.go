@@ -0,0 +1,69 @@
+package session_test
+
+import (
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/session"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openSessions(t *testing.T, dir string) (*session.DurableSessionsManager, *journal.Journal) {
+	t.Helper()
+	j, err := journal.Open(dir, "sessions")
+	if err != nil {
+		t.Fatalf("Open journal: %v", err)
+	}
+	sm, err := session.NewDurableSessionsManager(j)
+	if err != nil {
+		t.Fatalf("NewDurableSessionsManager: %v", err)
+	}
+	return sm, j
+}
+
+func checkSessions(t *testing.T, name string, sm *session.DurableSessionsManager, want []*session.Session) {
+	t.Helper()
+	for _, elem := range want {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+elem.AccessToken)
+		sess, err := sm.Check(r)
+		if err != nil || *sess != *elem {
+			t.Fatalf("%v: Check %v: got %+v, %v, want %+v", name, elem.UserName, sess, err, elem)
+		}
+	}
+}
+
+func TestDurableSessionsReplay(t *testing.T) {
+	dir := t.TempDir()
+	sm, j := openSessions(t, dir)
+	alex, _ := sm.Create(nil, 1, "alex")
+	if err := sm.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	bob, _ := sm.Create(nil, 2, "bob")
+	want := []*session.Session{alex, bob}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close journal: %v", err)
+	}
+
+	reopened, j := openSessions(t, dir)
+	checkSessions(t, "Replayed state", reopened, want)
+	j.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, "sessions.log"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Open log: %v", err)
+	}
+	f.WriteString(`{"seq":99,"op":"create","data":{"ID`)
+	f.Close()
+
+	reopened, j = openSessions(t, dir)
+	defer j.Close()
+	checkSessions(t, "State with a truncated record", reopened, want)
+	carol, err := reopened.Create(nil, 3, "carol")
+	if err != nil {
+		t.Fatalf("Create after the truncated record: %v", err)
+	}
+	checkSessions(t, "After Create", reopened, append(want, carol))
+}
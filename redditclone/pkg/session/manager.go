@@ -14,6 +14,11 @@ var (
 	ErrBadSign      = errors.New("bad sign method")
 )
 
+type Manager interface {
+	Check(r *http.Request) (*Session, error)
+	Create(w http.ResponseWriter, userID uint32, login string) (*Session, error)
+}
+
 type SessionsManager struct {
 	data map[string]*Session
 	mu   *sync.RWMutex
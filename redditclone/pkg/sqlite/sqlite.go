@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// AddColumn adds a column to a table created by an older version of the
+// schema, CREATE TABLE IF NOT EXISTS leaves such tables untouched.
+func AddColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			def     sql.NullString
+			pk      int
+		)
+		if err = rows.Scan(&cid, &name, &typ, &notNull, &def, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	if err != nil {
+		return err
+	}
+	log.Printf("sqlite: added column %v.%v", table, column)
+	return nil
+}
@@ -0,0 +1,88 @@
+package trash
+
+import (
+	"fakereddit/redditclone/pkg/cascade"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/saved"
+	"log"
+	"time"
+)
+
+// Purger hard-deletes posts and comments which stay in the trash longer
+// than Retention. Posts go through the Deleter, so their comments go too,
+// comments are removed from Saved here.
+type Purger struct {
+	Posts     post.PostsRepo
+	Comments  comment.CommentsRepo
+	Saved     saved.SavedRepo
+	Deleter   *cascade.Deleter
+	Retention time.Duration
+}
+
+// Purge removes everything deleted before now-Retention and returns how
+// many posts and comments were removed.
+func (p *Purger) Purge(now time.Time) (int, int, error) {
+	deadline := now.Add(-p.Retention)
+
+	posts, err := p.Posts.ReadTrash()
+	if err != nil {
+		return 0, 0, err
+	}
+	purgedPosts := 0
+	for _, elem := range posts {
+		if !expired(elem.DeletedAt, deadline) {
+			continue
+		}
+		if _, err = p.Deleter.Delete(elem.ID); err != nil && err != post.ErrNoPost {
+			return purgedPosts, 0, err
+		}
+		purgedPosts++
+	}
+
+	comments, err := p.Comments.ReadTrash()
+	if err != nil {
+		return purgedPosts, 0, err
+	}
+	purgedComments := 0
+	for _, elem := range comments {
+		if !expired(elem.DeletedAt, deadline) {
+			continue
+		}
+		if _, err = p.Comments.Delete(elem.PostID, elem.ID); err != nil && err != comment.ErrNoComm {
+			return purgedPosts, purgedComments, err
+		}
+		if _, err = p.Saved.DeleteByComment(elem.PostID, elem.ID); err != nil {
+			return purgedPosts, purgedComments, err
+		}
+		purgedComments++
+	}
+
+	log.Printf("Purged %v posts and %v comments deleted before %v", purgedPosts, purgedComments, deadline.Format(time.RFC3339))
+	return purgedPosts, purgedComments, nil
+}
+
+// Every purges the trash each interval until stop is closed.
+func (p *Purger) Every(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if _, _, err := p.Purge(now); err != nil {
+				log.Printf("ERROR: purge: %v", err)
+			}
+		}
+	}
+}
+
+func expired(deletedAt string, deadline time.Time) bool {
+	at, err := time.Parse(time.RFC3339, deletedAt)
+	if err != nil {
+		log.Printf("ERROR: purge: bad deletion time '%v'", deletedAt)
+		return false
+	}
+	return at.Before(deadline)
+}
@@ -0,0 +1,67 @@
+package trash_test
+
+import (
+	"fakereddit/redditclone/pkg/cascade"
+	"fakereddit/redditclone/pkg/comment"
+	"fakereddit/redditclone/pkg/post"
+	"fakereddit/redditclone/pkg/saved"
+	"fakereddit/redditclone/pkg/trash"
+	"fakereddit/redditclone/pkg/user"
+	"testing"
+	"time"
+)
+
+// TestPurge trashes a post and a comment of another post, both saved by
+// alex, and purges them once they are older than the retention.
+func TestPurge(t *testing.T) {
+	alex := &user.User{ID: 1, Username: "alex"}
+	posts := post.NewPostsRepo()
+	comments := comment.NewCommentsRepo()
+	savedRepo := saved.NewSavedRepo()
+	d := cascade.NewDeleter(posts)
+	d.Register("comments", comments)
+	d.Register("saved", savedRepo)
+
+	for i := 0; i < 2; i++ {
+		if _, err := posts.Create(&post.Post{Author: alex, Type: "text", Category: "music"}); err != nil {
+			t.Fatalf("Create post: %v", err)
+		}
+		if _, err := comments.Create(&comment.Comment{PostID: uint32(i + 1), Author: alex, Body: "body"}); err != nil {
+			t.Fatalf("Create comment: %v", err)
+		}
+	}
+	for _, item := range []*saved.Item{
+		{UserID: alex.ID, PostID: 1},
+		{UserID: alex.ID, PostID: 2},
+		{UserID: alex.ID, PostID: 2, CommentID: 1},
+	} {
+		if err := savedRepo.Save(item); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if _, err := posts.Trash(1, alex); err != nil {
+		t.Fatalf("Trash post: %v", err)
+	}
+	if _, err := comments.Trash(2, 1, alex); err != nil {
+		t.Fatalf("Trash comment: %v", err)
+	}
+
+	p := &trash.Purger{Posts: posts, Comments: comments, Saved: savedRepo, Deleter: d, Retention: time.Hour}
+	if purgedPosts, purgedComments, err := p.Purge(time.Now()); purgedPosts != 0 || purgedComments != 0 || err != nil {
+		t.Fatalf("Purge within retention: got %v, %v, %v, want 0, 0", purgedPosts, purgedComments, err)
+	}
+	if purgedPosts, purgedComments, err := p.Purge(time.Now().Add(2 * time.Hour)); purgedPosts != 1 || purgedComments != 1 || err != nil {
+		t.Fatalf("Purge after retention: got %v, %v, %v, want 1, 1", purgedPosts, purgedComments, err)
+	}
+
+	if _, err := posts.Read(1); err != post.ErrNoPost {
+		t.Fatalf("Read purged post: got %v, want %v", err, post.ErrNoPost)
+	}
+	if left, err := comments.ReadAll(2); err != nil || len(left) != 0 {
+		t.Fatalf("ReadAll after purge: got %v, %v, want none", left, err)
+	}
+	items, err := savedRepo.List(alex.ID, "")
+	if err != nil || len(items) != 1 || items[0].PostID != 2 || items[0].CommentID != 0 {
+		t.Fatalf("List saved after purge: got %+v, %v, want only post 2", items, err)
+	}
+}
@@ -0,0 +1,236 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultMaxBytes = 1 << 20
+
+	maxRedirects = 5
+	maxTitle     = 300
+	maxDesc      = 1000
+)
+
+var (
+	ErrBadURL        = errors.New("only http and https links can be unfurled")
+	ErrForbiddenAddr = errors.New("link points to a private address")
+	ErrNotHTML       = errors.New("link is not an html page")
+)
+
+var (
+	metaRe  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrRe  = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>/]+))`)
+	titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	spaceRe = regexp.MustCompile(`\s+`)
+)
+
+// reserved are the ranges net.IP has no predicate for: "this network",
+// carrier-grade NAT, benchmarking and the old class E.
+var reserved = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "198.18.0.0/15", "240.0.0.0/4"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// Preview is what a page is about, from its Open Graph and HTML meta
+// tags. URL is where the link led after redirects.
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+	Fetched     string `json:"fetched"`
+}
+
+// Fetcher downloads a page and builds its preview. Every address the
+// client connects to, redirects included, is checked, so a link can't
+// make the server call its own network unless AllowPrivate is set.
+type Fetcher struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	AllowPrivate bool
+}
+
+// Fetch returns the preview of the page at link.
+func (f *Fetcher) Fetch(link string) (*Preview, error) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrBadURL
+	}
+
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if !f.AllowPrivate {
+		dialer.Control = checkAddr
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %v redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrBadURL
+			}
+			return nil
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "redditclone-unfurl/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenAddr) {
+			return nil, ErrForbiddenAddr
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return nil, ErrNotHTML
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	preview := Parse(string(body), resp.Request.URL)
+	log.Printf("Fetch: unfurled '%v'", preview.URL)
+	return preview, nil
+}
+
+// Parse builds a preview from the page found at base. Open Graph tags win
+// over twitter cards, which win over the plain title and description.
+func Parse(page string, base *url.URL) *Preview {
+	props := map[string]string{}
+	for _, tag := range metaRe.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, m := range attrRe.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		if _, ok := props[key]; !ok && key != "" {
+			props[key] = clean(attrs["content"])
+		}
+	}
+
+	title := ""
+	if m := titleRe.FindStringSubmatch(page); m != nil {
+		title = clean(m[1])
+	}
+
+	preview := &Preview{
+		URL:         base.String(),
+		Title:       truncate(first(props["og:title"], props["twitter:title"], title), maxTitle),
+		Description: truncate(first(props["og:description"], props["twitter:description"], props["description"]), maxDesc),
+		SiteName:    truncate(props["og:site_name"], maxTitle),
+		Fetched:     time.Now().Format(time.RFC3339),
+	}
+	if image := first(props["og:image"], props["og:image:url"], props["twitter:image"]); image != "" {
+		if ref, err := base.Parse(image); err == nil && (ref.Scheme == "http" || ref.Scheme == "https") {
+			preview.Image = ref.String()
+		}
+	}
+	return preview
+}
+
+// checkAddr refuses connections to loopback, private, link-local and
+// other addresses that are not on the public internet.
+func checkAddr(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !public(ip) {
+		return ErrForbiddenAddr
+	}
+	return nil
+}
+
+func public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		for _, n := range reserved {
+			if n.Contains(ip4) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func clean(s string) string {
+	s = html.UnescapeString(strings.ToValidUTF8(s, ""))
+	return strings.TrimSpace(spaceRe.ReplaceAllString(s, " "))
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
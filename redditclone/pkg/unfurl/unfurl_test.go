@@ -0,0 +1,98 @@
+package unfurl_test
+
+import (
+	"fakereddit/redditclone/pkg/unfurl"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	pages := map[string]string{
+		"/og": `<html><head><title>Plain title</title>
+<meta property="og:title" content="OG &quot;title&quot;">
+<meta name="twitter:title" content="Twitter title">
+<meta content="/pic.png" property="og:image" />
+<meta name='description' content='Plain description'></head></html>`,
+		"/twitter": `<title>Plain title</title>
+<META NAME="twitter:title" CONTENT="Twitter title"><meta name="twitter:description" content="Card">`,
+		"/title": "<title>\n  Only   the\ttitle </title><meta property=\"og:image\" content=\"javascript:alert(1)\">",
+		"/big":   strings.Repeat("x", 2000) + "<title>Too late</title>",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/og", http.StatusFound)
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"title": "json"}`)
+		case "/png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "\x89PNG")
+		default:
+			page, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, page)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetch(t *testing.T) {
+	srv := newServer(t)
+	f := &unfurl.Fetcher{AllowPrivate: true, MaxBytes: 1000}
+
+	tests := []struct {
+		path, url, title, desc, image string
+	}{
+		{"/og", "/og", `OG "title"`, "Plain description", srv.URL + "/pic.png"},
+		{"/redirect", "/og", `OG "title"`, "Plain description", srv.URL + "/pic.png"},
+		{"/twitter", "/twitter", "Twitter title", "Card", ""},
+		{"/title", "/title", "Only the title", "", ""},
+		// the title is past MaxBytes
+		{"/big", "/big", "", "", ""},
+	}
+	for _, tc := range tests {
+		p, err := f.Fetch(srv.URL + tc.path)
+		if err != nil {
+			t.Fatalf("Fetch %v: %v", tc.path, err)
+		}
+		if p.URL != srv.URL+tc.url || p.Title != tc.title || p.Description != tc.desc || p.Image != tc.image {
+			t.Fatalf("Fetch %v: got %+v, want url %v, title %q, description %q, image %q",
+				tc.path, p, tc.url, tc.title, tc.desc, tc.image)
+		}
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	srv := newServer(t)
+	f := &unfurl.Fetcher{AllowPrivate: true}
+
+	for _, path := range []string{"/json", "/png"} {
+		if _, err := f.Fetch(srv.URL + path); err != unfurl.ErrNotHTML {
+			t.Fatalf("Fetch %v: got %v, want %v", path, err, unfurl.ErrNotHTML)
+		}
+	}
+	if _, err := f.Fetch(srv.URL + "/missing"); err == nil {
+		t.Fatalf("Fetch of a missing page: got no error")
+	}
+	for _, link := range []string{"ftp://example.com/", "/og", "http://"} {
+		if _, err := f.Fetch(link); err != unfurl.ErrBadURL {
+			t.Fatalf("Fetch %q: got %v, want %v", link, err, unfurl.ErrBadURL)
+		}
+	}
+
+	// httptest listens on loopback
+	for _, path := range []string{"/og", "/redirect"} {
+		if _, err := (&unfurl.Fetcher{}).Fetch(srv.URL + path); err != unfurl.ErrForbiddenAddr {
+			t.Fatalf("Fetch %v without AllowPrivate: got %v, want %v", path, err, unfurl.ErrForbiddenAddr)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package unfurl
+
+import "log"
+
+type job struct {
+	postID uint32
+	url    string
+	done   func(preview *Preview) error
+}
+
+// Unfurler fetches previews of link posts in the background, one at a
+// time, so creating a post never waits for the remote site.
+type Unfurler struct {
+	Fetcher *Fetcher
+	queue   chan job
+}
+
+func NewUnfurler(f *Fetcher, size int) *Unfurler {
+	return &Unfurler{
+		Fetcher: f,
+		queue:   make(chan job, size),
+	}
+}
+
+// Enqueue asks for a preview of the link of the post, done gets it once
+// the page is fetched. When the queue is full the link is dropped, the
+// post just stays without a preview.
+func (u *Unfurler) Enqueue(postID uint32, url string, done func(preview *Preview) error) {
+	if u == nil {
+		return
+	}
+	select {
+	case u.queue <- job{postID: postID, url: url, done: done}:
+	default:
+		log.Printf("ERROR: unfurl: queue is full, post_%v skipped", postID)
+	}
+}
+
+// Run handles queued links until stop is closed.
+func (u *Unfurler) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case j := <-u.queue:
+			u.unfurl(j)
+		}
+	}
+}
+
+func (u *Unfurler) unfurl(j job) {
+	preview, err := u.Fetcher.Fetch(j.url)
+	if err != nil {
+		log.Printf("ERROR: unfurl post_%v: %v", j.postID, err)
+		return
+	}
+	if err = j.done(preview); err != nil {
+		log.Printf("ERROR: unfurl post_%v: %v", j.postID, err)
+	}
+}
@@ -0,0 +1,171 @@
+package user
+
+import (
+	"encoding/json"
+	"fakereddit/redditclone/pkg/journal"
+	"sync"
+)
+
+const (
+	opCreateUser = "create"
+	opFollow     = "follow"
+	opUnfollow   = "unfollow"
+)
+
+// DurableUsersRepo is a UsersDataRepo which logs every created user to a
+// journal and restores itself from it on start.
+type DurableUsersRepo struct {
+	*UsersDataRepo
+	mu      *sync.Mutex
+	journal *journal.Journal
+}
+
+// userRecord is the stored form of User, which hides the password hash
+// from json. Password is the password itself, which older versions stored;
+// it is only read and hashed on load.
+type userRecord struct {
+	ID           uint32 `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"passwordHash,omitempty"`
+	Password     string `json:"password,omitempty"`
+}
+
+type usersSnapshot struct {
+	LastID  uint32                     `json:"lastID"`
+	Data    []*userRecord              `json:"data"`
+	Follows map[uint32]map[uint32]bool `json:"follows"`
+}
+
+type followEntry struct {
+	Follower uint32 `json:"follower"`
+	Login    string `json:"login"`
+}
+
+func NewDurableUsersRepo(j *journal.Journal) (*DurableUsersRepo, error) {
+	repo := &DurableUsersRepo{
+		UsersDataRepo: NewUsersRepo(),
+		mu:            &sync.Mutex{},
+		journal:       j,
+	}
+
+	err := j.Load(repo.restore, repo.apply)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (dr *DurableUsersRepo) restore(state json.RawMessage) error {
+	snap := &usersSnapshot{}
+	if err := json.Unmarshal(state, snap); err != nil {
+		return err
+	}
+	dr.LastID = snap.LastID
+	for _, rec := range snap.Data {
+		u, err := rec.user()
+		if err != nil {
+			return err
+		}
+		dr.Data[rec.Username] = u
+	}
+	if snap.Follows != nil {
+		dr.Follows = snap.Follows
+	}
+	return nil
+}
+
+func (dr *DurableUsersRepo) apply(op string, data json.RawMessage) error {
+	switch op {
+	case opFollow, opUnfollow:
+		e := &followEntry{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return err
+		}
+		if op == opFollow {
+			return dr.UsersDataRepo.Follow(&User{ID: e.Follower}, e.Login)
+		}
+		return dr.UsersDataRepo.Unfollow(&User{ID: e.Follower}, e.Login)
+	}
+	if op != opCreateUser {
+		return nil
+	}
+	rec := &userRecord{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return err
+	}
+	u, err := rec.user()
+	if err != nil {
+		return err
+	}
+	dr.Data[rec.Username] = u
+	dr.LastID = rec.ID
+	return nil
+}
+
+func (dr *DurableUsersRepo) CreateUser(login, pass string) (*User, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	u, err := dr.UsersDataRepo.CreateUser(login, pass)
+	if err != nil {
+		return nil, err
+	}
+	return u, dr.journal.Append(opCreateUser, &userRecord{
+		ID:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.password,
+	})
+}
+
+func (dr *DurableUsersRepo) Follow(follower *User, login string) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.UsersDataRepo.Follow(follower, login); err != nil {
+		return err
+	}
+	return dr.journal.Append(opFollow, &followEntry{Follower: follower.ID, Login: login})
+}
+
+func (dr *DurableUsersRepo) Unfollow(follower *User, login string) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if err := dr.UsersDataRepo.Unfollow(follower, login); err != nil {
+		return err
+	}
+	return dr.journal.Append(opUnfollow, &followEntry{Follower: follower.ID, Login: login})
+}
+
+func (dr *DurableUsersRepo) Snapshot() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.UsersDataRepo.mu.RLock()
+	snap := &usersSnapshot{
+		LastID:  dr.LastID,
+		Data:    make([]*userRecord, 0, len(dr.Data)),
+		Follows: dr.Follows,
+	}
+	for _, u := range dr.Data {
+		snap.Data = append(snap.Data, &userRecord{
+			ID:           u.ID,
+			Username:     u.Username,
+			PasswordHash: u.password,
+		})
+	}
+	err := dr.journal.Compact(snap)
+	dr.UsersDataRepo.mu.RUnlock()
+	return err
+}
+
+func (rec *userRecord) user() (*User, error) {
+	hash := rec.PasswordHash
+	if hash == "" {
+		var err error
+		if hash, err = hashPassword(rec.Password); err != nil {
+			return nil, err
+		}
+	}
+	return &User{
+		ID:       rec.ID,
+		Username: rec.Username,
+		password: hash,
+	}, nil
+}
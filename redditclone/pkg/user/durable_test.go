@@ -0,0 +1,117 @@
+package user_test
+
+import (
+	"fakereddit/redditclone/pkg/journal"
+	"fakereddit/redditclone/pkg/user"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func openUsers(t *testing.T, dir string) (*user.DurableUsersRepo, *journal.Journal) {
+	t.Helper()
+	j, err := journal.Open(dir, "users")
+	if err != nil {
+		t.Fatalf("Open journal: %v", err)
+	}
+	repo, err := user.NewDurableUsersRepo(j)
+	if err != nil {
+		t.Fatalf("NewDurableUsersRepo: %v", err)
+	}
+	return repo, j
+}
+
+func checkUsers(t *testing.T, name string, got, want *user.DurableUsersRepo) {
+	t.Helper()
+	if got.LastID != want.LastID || !reflect.DeepEqual(got.Data, want.Data) || !reflect.DeepEqual(got.Follows, want.Follows) {
+		t.Fatalf("%v: got %v %+v %v, want %v %+v %v", name,
+			got.LastID, got.Data, got.Follows, want.LastID, want.Data, want.Follows)
+	}
+	for login := range want.Data {
+		if _, err := got.Authorize(login, "pass-"+login); err != nil {
+			t.Fatalf("%v: Authorize %v: %v", name, login, err)
+		}
+	}
+}
+
+func TestDurableUsersReplay(t *testing.T) {
+	dir := t.TempDir()
+	repo, j := openUsers(t, dir)
+	alex, _ := repo.CreateUser("alex", "pass-alex")
+	bob, _ := repo.CreateUser("bob", "pass-bob")
+	repo.Follow(alex, "bob")
+	if err := repo.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	repo.CreateUser("carol", "pass-carol")
+	repo.Follow(bob, "carol")
+	repo.Follow(alex, "carol")
+	repo.Unfollow(alex, "bob")
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close journal: %v", err)
+	}
+
+	reopened, j := openUsers(t, dir)
+	checkUsers(t, "Replayed state", reopened, repo)
+	j.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, "users.log"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Open log: %v", err)
+	}
+	f.WriteString(`{"seq":99,"op":"create","data":{"us`)
+	f.Close()
+
+	reopened, j = openUsers(t, dir)
+	defer j.Close()
+	checkUsers(t, "State with a truncated record", reopened, repo)
+	dave, err := reopened.CreateUser("dave", "pass-dave")
+	if err != nil || dave.ID != 4 {
+		t.Fatalf("CreateUser after the truncated record: got %+v, %v", dave, err)
+	}
+}
+
+// TestDurableUsersPasswords checks that the journal and the snapshot keep
+// only hashes and that records of older versions, which kept the password
+// itself, still load.
+func TestDurableUsersPasswords(t *testing.T) {
+	dir := t.TempDir()
+	repo, j := openUsers(t, dir)
+	repo.CreateUser("alex", "pass-alex")
+	if err := repo.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	repo.CreateUser("bob", "pass-bob")
+	j.Close()
+
+	for _, name := range []string{"users.log", "users.snapshot"} {
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Read %v: %v", name, err)
+		}
+		if strings.Contains(string(raw), "pass-") {
+			t.Fatalf("%v keeps a password: %s", name, raw)
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, "users.log"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Open log: %v", err)
+	}
+	f.WriteString(`{"seq":99,"op":"create","data":{"id":3,"username":"carol","password":"pass-carol"}}` + "\n")
+	f.Close()
+
+	reopened, j := openUsers(t, dir)
+	defer j.Close()
+	for _, login := range []string{"alex", "bob", "carol"} {
+		if _, err = reopened.Authorize(login, "pass-"+login); err != nil {
+			t.Fatalf("Authorize %v: %v", login, err)
+		}
+		if _, err = reopened.Authorize(login, "pass-"+login+"x"); err != user.ErrWrongPassword {
+			t.Fatalf("Authorize %v with wrong password: got %v, want %v", login, err, user.ErrWrongPassword)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"errors"
 	"log"
+	"sort"
 	"sync"
 )
 
@@ -10,19 +11,23 @@ var (
 	ErrNoUser        = errors.New("no user found")
 	ErrWrongPassword = errors.New("invalid password")
 	ErrAlreadyExist  = errors.New("user already exists")
+	ErrSelfFollow    = errors.New("can't follow yourself")
 )
 
 type UsersDataRepo struct {
 	mu     *sync.RWMutex
 	LastID uint32
 	Data   map[string]*User
+	// Follows are ids of followed users by follower id
+	Follows map[uint32]map[uint32]bool
 }
 
 func NewUsersRepo() *UsersDataRepo {
 	log.Printf("NewUsersRepo: created UsersDataRepo")
 	return &UsersDataRepo{
-		Data: make(map[string]*User),
-		mu:   &sync.RWMutex{},
+		Data:    make(map[string]*User),
+		Follows: make(map[uint32]map[uint32]bool),
+		mu:      &sync.RWMutex{},
 	}
 }
 
@@ -35,8 +40,7 @@ func (ur *UsersDataRepo) Authorize(login, password string) (*User, error) {
 		return nil, ErrNoUser
 	}
 
-	if password != u.password {
-		log.Printf("ERROR: Authorize: invalid password for user '%v'", login)
+	if !u.checkPassword(password) {
 		return nil, ErrWrongPassword
 	}
 	log.Printf("Authorize for '%v'", login)
@@ -44,10 +48,13 @@ func (ur *UsersDataRepo) Authorize(login, password string) (*User, error) {
 }
 
 func (ur *UsersDataRepo) CreateUser(login, pass string) (*User, error) {
+	hash, err := hashPassword(pass)
+	if err != nil {
+		return nil, err
+	}
 	newUser := new(User)
 	ur.mu.Lock()
-	ur.LastID++
-	newUser.ID = ur.LastID
+	defer ur.mu.Unlock()
 	_, ok := ur.Data[login]
 
 	if ok {
@@ -55,10 +62,11 @@ func (ur *UsersDataRepo) CreateUser(login, pass string) (*User, error) {
 		return nil, ErrAlreadyExist
 	}
 
+	ur.LastID++
+	newUser.ID = ur.LastID
 	newUser.Username = login
-	newUser.password = pass
+	newUser.password = hash
 	ur.Data[login] = newUser
-	ur.mu.Unlock()
 	log.Printf("CreateUser: created '%v'", login)
 	return newUser, nil
 }
@@ -73,3 +81,63 @@ func (ur *UsersDataRepo) Get(login string) (*User, error) {
 	}
 	return elem, nil
 }
+
+func (ur *UsersDataRepo) Follow(follower *User, login string) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	u, ok := ur.Data[login]
+	if !ok {
+		log.Printf("ERROR: Follow: no user '%v'", login)
+		return ErrNoUser
+	}
+	if u.ID == follower.ID {
+		return ErrSelfFollow
+	}
+	if ur.Follows[follower.ID] == nil {
+		ur.Follows[follower.ID] = make(map[uint32]bool)
+	}
+	ur.Follows[follower.ID][u.ID] = true
+	log.Printf("Follow: user %v follows '%v'", follower.ID, login)
+	return nil
+}
+
+func (ur *UsersDataRepo) Unfollow(follower *User, login string) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	u, ok := ur.Data[login]
+	if !ok {
+		log.Printf("ERROR: Unfollow: no user '%v'", login)
+		return ErrNoUser
+	}
+	delete(ur.Follows[follower.ID], u.ID)
+	log.Printf("Unfollow: user %v unfollows '%v'", follower.ID, login)
+	return nil
+}
+
+func (ur *UsersDataRepo) Followers(login string) ([]*User, error) {
+	return ur.follows(login, func(u, other *User) bool { return ur.Follows[other.ID][u.ID] })
+}
+
+func (ur *UsersDataRepo) Following(login string) ([]*User, error) {
+	return ur.follows(login, func(u, other *User) bool { return ur.Follows[u.ID][other.ID] })
+}
+
+// follows lists the users linked to login, sorted by username.
+func (ur *UsersDataRepo) follows(login string, linked func(u, other *User) bool) ([]*User, error) {
+	ur.mu.RLock()
+	u, ok := ur.Data[login]
+	if !ok {
+		ur.mu.RUnlock()
+		log.Printf("follows: no user '%v'", login)
+		return nil, ErrNoUser
+	}
+	res := make([]*User, 0)
+	for _, other := range ur.Data {
+		if linked(u, other) {
+			res = append(res, other)
+		}
+	}
+	ur.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Username < res[j].Username })
+	return res, nil
+}
@@ -0,0 +1,206 @@
+package user
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+const usersSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT    NOT NULL UNIQUE,
+	password TEXT    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS follows (
+	follower_id INTEGER NOT NULL REFERENCES users (id),
+	followee_id INTEGER NOT NULL REFERENCES users (id),
+	PRIMARY KEY (follower_id, followee_id)
+);
+CREATE INDEX IF NOT EXISTS follows_followee ON follows (followee_id);`
+
+type UsersSQLiteRepo struct {
+	db *sql.DB
+}
+
+func NewUsersSQLiteRepo(db *sql.DB) (*UsersSQLiteRepo, error) {
+	if _, err := db.Exec(usersSchema); err != nil {
+		return nil, err
+	}
+	if err := hashStored(db); err != nil {
+		return nil, err
+	}
+	log.Printf("NewUsersSQLiteRepo: created UsersSQLiteRepo")
+	return &UsersSQLiteRepo{db: db}, nil
+}
+
+// hashStored hashes the passwords older versions stored as they were.
+func hashStored(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, password FROM users`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	plain := make(map[uint32]string)
+	for rows.Next() {
+		var (
+			id   uint32
+			pass string
+		)
+		if err = rows.Scan(&id, &pass); err != nil {
+			return err
+		}
+		if !isHash(pass) {
+			plain[id] = pass
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, pass := range plain {
+		hash, err := hashPassword(pass)
+		if err != nil {
+			return err
+		}
+		if _, err = db.Exec(`UPDATE users SET password = ? WHERE id = ?`, hash, id); err != nil {
+			return err
+		}
+	}
+	if len(plain) != 0 {
+		log.Printf("hashStored: hashed %v stored passwords", len(plain))
+	}
+	return nil
+}
+
+func (ur *UsersSQLiteRepo) Authorize(login, password string) (*User, error) {
+	u, err := ur.get(login)
+	if err == sql.ErrNoRows {
+		log.Printf("ERROR: Authorize: no user '%v' found", login)
+		return nil, ErrNoUser
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !u.checkPassword(password) {
+		return nil, ErrWrongPassword
+	}
+	log.Printf("Authorize for '%v'", login)
+	return u, nil
+}
+
+func (ur *UsersSQLiteRepo) CreateUser(login, pass string) (*User, error) {
+	hash, err := hashPassword(pass)
+	if err != nil {
+		return nil, err
+	}
+	res, err := ur.db.Exec(`INSERT INTO users (username, password) VALUES (?, ?)`, login, hash)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			log.Printf("ERROR: CreateUser, login already exists: '%v'", login)
+			return nil, ErrAlreadyExist
+		}
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("CreateUser: created '%v'", login)
+	return &User{
+		ID:       uint32(id),
+		Username: login,
+		password: hash,
+	}, nil
+}
+
+func (ur *UsersSQLiteRepo) Get(login string) (*User, error) {
+	u, err := ur.get(login)
+	if err == sql.ErrNoRows {
+		log.Printf("Get user: no user '%v'", login)
+		return nil, ErrNoUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (ur *UsersSQLiteRepo) get(login string) (*User, error) {
+	u := &User{}
+	err := ur.db.QueryRow(`SELECT id, username, password FROM users WHERE username = ?`, login).
+		Scan(&u.ID, &u.Username, &u.password)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (ur *UsersSQLiteRepo) Follow(follower *User, login string) error {
+	u, err := ur.Get(login)
+	if err != nil {
+		log.Printf("ERROR: Follow: no user '%v'", login)
+		return err
+	}
+	if u.ID == follower.ID {
+		return ErrSelfFollow
+	}
+	_, err = ur.db.Exec(`INSERT OR IGNORE INTO follows (follower_id, followee_id) VALUES (?, ?)`, follower.ID, u.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Follow: user %v follows '%v'", follower.ID, login)
+	return nil
+}
+
+func (ur *UsersSQLiteRepo) Unfollow(follower *User, login string) error {
+	u, err := ur.Get(login)
+	if err != nil {
+		log.Printf("ERROR: Unfollow: no user '%v'", login)
+		return err
+	}
+	_, err = ur.db.Exec(`DELETE FROM follows WHERE follower_id = ? AND followee_id = ?`, follower.ID, u.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Unfollow: user %v unfollows '%v'", follower.ID, login)
+	return nil
+}
+
+func (ur *UsersSQLiteRepo) Followers(login string) ([]*User, error) {
+	return ur.follows(login, `SELECT u.id, u.username, u.password FROM follows f
+		JOIN users u ON u.id = f.follower_id WHERE f.followee_id = ? ORDER BY u.username`)
+}
+
+func (ur *UsersSQLiteRepo) Following(login string) ([]*User, error) {
+	return ur.follows(login, `SELECT u.id, u.username, u.password FROM follows f
+		JOIN users u ON u.id = f.followee_id WHERE f.follower_id = ? ORDER BY u.username`)
+}
+
+// follows runs query with the id of the user login.
+func (ur *UsersSQLiteRepo) follows(login, query string) ([]*User, error) {
+	u, err := ur.Get(login)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ur.db.Query(query, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*User, 0)
+	for rows.Next() {
+		other := &User{}
+		if err = rows.Scan(&other.ID, &other.Username, &other.password); err != nil {
+			return nil, err
+		}
+		res = append(res, other)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,51 @@
+package user_test
+
+import (
+	"database/sql"
+	"fakereddit/redditclone/pkg/user"
+	_ "github.com/mattn/go-sqlite3"
+	"strings"
+	"testing"
+)
+
+// TestSQLitePasswords checks that only hashes are stored and that the
+// passwords older versions stored as they were are hashed on start.
+func TestSQLitePasswords(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:userspasswords?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	repo, err := user.NewUsersSQLiteRepo(db)
+	if err != nil {
+		t.Fatalf("NewUsersSQLiteRepo: %v", err)
+	}
+	if _, err = repo.CreateUser("alex", "pass-alex"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err = db.Exec(`INSERT INTO users (username, password) VALUES ('bob', 'pass-bob')`); err != nil {
+		t.Fatalf("Insert plain password: %v", err)
+	}
+
+	repo, err = user.NewUsersSQLiteRepo(db)
+	if err != nil {
+		t.Fatalf("NewUsersSQLiteRepo on old rows: %v", err)
+	}
+	for _, login := range []string{"alex", "bob"} {
+		var stored string
+		if err = db.QueryRow(`SELECT password FROM users WHERE username = ?`, login).Scan(&stored); err != nil {
+			t.Fatalf("Select password of %v: %v", login, err)
+		}
+		if strings.Contains(stored, "pass-"+login) {
+			t.Fatalf("stored password of %v: got %q, want a hash", login, stored)
+		}
+		if _, err = repo.Authorize(login, "pass-"+login); err != nil {
+			t.Fatalf("Authorize %v: %v", login, err)
+		}
+		if _, err = repo.Authorize(login, "pass-"+login+"x"); err != user.ErrWrongPassword {
+			t.Fatalf("Authorize %v with wrong password: got %v, want %v", login, err, user.ErrWrongPassword)
+		}
+	}
+}
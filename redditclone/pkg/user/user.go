@@ -1,8 +1,11 @@
 package user
 
+import "golang.org/x/crypto/bcrypt"
+
 type User struct {
 	ID       uint32 `json:"id"`
 	Username string `json:"username"`
+	// password is the salted bcrypt hash, never the password itself
 	password string
 }
 
@@ -10,4 +13,33 @@ type UsersRepo interface {
 	Authorize(login, pass string) (*User, error)
 	CreateUser(login, pass string) (*User, error)
 	Get(login string) (*User, error)
+	// Follow makes follower see posts and comments of the user login
+	Follow(follower *User, login string) error
+	Unfollow(follower *User, login string) error
+	// Followers and Following are sorted by username
+	Followers(login string) ([]*User, error)
+	Following(login string) ([]*User, error)
+}
+
+// PasswordCost is the bcrypt cost of new hashes, tests which create many
+// users lower it.
+var PasswordCost = bcrypt.DefaultCost
+
+func hashPassword(pass string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), PasswordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// isHash tells a stored hash from a password older versions kept as it was.
+func isHash(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// checkPassword compares in constant time, like every bcrypt check.
+func (u *User) checkPassword(pass string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.password), []byte(pass)) == nil
 }